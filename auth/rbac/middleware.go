@@ -0,0 +1,80 @@
+package rbac
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Enforcer denies the requests a Policy doesn't allow, before they reach the handlers.
+// Handler is the middleware for net/http, a ServeMux as well as a gorilla/mux router
+// (router.Use(enforcer.Handler)); Gin is the one for gin.
+type Enforcer struct {
+	Policy *Policy
+
+	// User returns who makes the request, "" for anonymous; a nil User takes every
+	// request as anonymous. Authentication has to run before the Enforcer.
+	User func(req *http.Request) string
+
+	// Realm, when set, answers the anonymous requests denied with 401 Unauthorized and a
+	// Basic challenge for that realm, since signing in may get them through; all others
+	// are answered with 403 Forbidden.
+	Realm string
+}
+
+// check returns the HTTP status code and error to deny req with, nil when it is allowed
+func (e *Enforcer) check(req *http.Request) (int, error) {
+	user := ""
+
+	if e.User != nil {
+		user = e.User(req)
+	}
+
+	err := e.Policy.Check(user, req.Method, req.URL.Path)
+
+	if err == nil {
+		return http.StatusOK, nil
+	}
+
+	if user == "" && e.Realm != "" {
+		return http.StatusUnauthorized, fmt.Errorf("sign in: %w", err)
+	}
+
+	return http.StatusForbidden, err
+}
+
+func (e *Enforcer) challenge(header http.Header, status int) {
+	if status == http.StatusUnauthorized {
+		header.Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", e.Realm))
+	}
+}
+
+// Handler passes the requests the policy allows on to next
+func (e *Enforcer) Handler(next http.Handler) http.Handler {
+	wrappedFunc := func(rsp http.ResponseWriter, req *http.Request) {
+		if status, err := e.check(req); err != nil {
+			e.challenge(rsp.Header(), status)
+			http.Error(rsp, err.Error(), status)
+			return
+		}
+
+		next.ServeHTTP(rsp, req)
+	}
+
+	return http.HandlerFunc(wrappedFunc)
+}
+
+// Gin returns the gin middleware passing the requests the policy allows on
+func (e *Enforcer) Gin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if status, err := e.check(c.Request); err != nil {
+			e.challenge(c.Writer.Header(), status)
+			c.String(status, err.Error())
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,336 @@
+// Package rbac checks requests against a role-based access control policy: roles are
+// granted permissions on methods and routes, and users are given roles.
+package rbac
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Permission allows one method, or every method for *, on the paths matching a route.
+// A route is made of segments: {name} matches any one segment of a path and a last *
+// matches whatever follows, nothing included; trailing slashes are ignored.
+type Permission struct {
+	Method string
+	Route  string
+
+	segments []string
+}
+
+// ParsePermission parses a permission written "<method> <route>", like "GET /task/{id}"
+func ParsePermission(s string) (Permission, error) {
+	fields := strings.Fields(s)
+
+	if len(fields) != 2 {
+		return Permission{}, fmt.Errorf("permission %q: expect <method> <route>, like GET /task/{id}", s)
+	}
+
+	method, route := strings.ToUpper(fields[0]), fields[1]
+
+	if !strings.HasPrefix(route, "/") {
+		return Permission{}, fmt.Errorf("permission %q: expect a route starting with /", s)
+	}
+
+	segments := splitPath(route)
+
+	for i, segment := range segments {
+		if segment == "*" && i != len(segments)-1 {
+			return Permission{}, fmt.Errorf("permission %q: * only goes last", s)
+		}
+	}
+
+	return Permission{Method: method, Route: route, segments: segments}, nil
+}
+
+func (p Permission) String() string {
+	return p.Method + " " + p.Route
+}
+
+// Allows reports whether the permission covers a request with method on path
+func (p Permission) Allows(method, path string) bool {
+	if p.Method != "*" && p.Method != method {
+		return false
+	}
+
+	parts := splitPath(path)
+
+	for i, segment := range p.segments {
+		if segment == "*" {
+			return true
+		}
+
+		if i >= len(parts) {
+			return false
+		}
+
+		if !isParam(segment) && segment != parts[i] {
+			return false
+		}
+	}
+
+	return len(parts) == len(p.segments)
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+
+	if path == "" {
+		return nil
+	}
+
+	return strings.Split(path, "/")
+}
+
+func isParam(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+// Policy is a set of roles and the roles of each user. Build one with LoadPolicy or
+// ParsePolicy; it is safe to use concurrently.
+type Policy struct {
+	roles     map[string][]Permission // with the permissions of the roles they inherit
+	inherits  map[string][]string     // every role each role inherits, directly or not
+	users     map[string][]string
+	anonymous []string
+}
+
+// policyFile is the JSON form of a Policy:
+//
+//	{
+//	  "roles": {
+//	    "viewer": {"permissions": ["GET /task/", "GET /task/{id}"]},
+//	    "editor": {"inherits": ["viewer"], "permissions": ["POST /task/", "DELETE /task/{id}"]}
+//	  },
+//	  "users": {"john": ["editor"]},
+//	  "anonymous": ["viewer"]
+//	}
+type policyFile struct {
+	Roles map[string]struct {
+		Inherits    []string `json:"inherits"`
+		Permissions []string `json:"permissions"`
+	} `json:"roles"`
+	// Users lists the roles of each user; signed in users left out have none
+	Users map[string][]string `json:"users"`
+	// Anonymous lists the roles of the requests nobody signed in to
+	Anonymous []string `json:"anonymous"`
+}
+
+// LoadPolicy reads a policy from a JSON file, see ParsePolicy
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := ParsePolicy(data)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return policy, nil
+}
+
+// ParsePolicy parses a JSON policy: its roles, each with the permissions it is granted
+// and the roles it inherits the permissions of, the roles of each user, and those of
+// anonymous requests. Unknown fields, malformed permissions, roles that don't exist and
+// roles inheriting from themselves are errors.
+func ParsePolicy(data []byte) (*Policy, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var file policyFile
+
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+
+	policy := &Policy{roles: make(map[string][]Permission), inherits: make(map[string][]string), users: file.Users, anonymous: file.Anonymous}
+	granted := make(map[string][]Permission)
+
+	for name, role := range file.Roles {
+		for _, s := range role.Permissions {
+			permission, err := ParsePermission(s)
+
+			if err != nil {
+				return nil, fmt.Errorf("role %s: %w", name, err)
+			}
+
+			granted[name] = append(granted[name], permission)
+		}
+
+		for _, parent := range role.Inherits {
+			if _, ok := file.Roles[parent]; !ok {
+				return nil, fmt.Errorf("role %s inherits unknown role %s", name, parent)
+			}
+		}
+	}
+
+	// resolve walks the roles a role inherits, depth first, to catch cycles; it returns the
+	// permissions of the role and the roles it inherits
+	var resolve func(name string, path []string) ([]Permission, []string, error)
+
+	resolve = func(name string, path []string) ([]Permission, []string, error) {
+		for _, seen := range path {
+			if seen == name {
+				return nil, nil, fmt.Errorf("role %s inherits from itself: %s", name, strings.Join(append(path, name), " -> "))
+			}
+		}
+
+		permissions := append([]Permission(nil), granted[name]...)
+		var ancestors []string
+
+		for _, parent := range file.Roles[name].Inherits {
+			inherited, grandparents, err := resolve(parent, append(path, name))
+
+			if err != nil {
+				return nil, nil, err
+			}
+
+			permissions = append(permissions, inherited...)
+			ancestors = append(append(ancestors, parent), grandparents...)
+		}
+
+		return permissions, ancestors, nil
+	}
+
+	for name := range file.Roles {
+		permissions, ancestors, err := resolve(name, nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		policy.roles[name] = permissions
+		policy.inherits[name] = ancestors
+	}
+
+	for user, roles := range file.Users {
+		if err := policy.checkRoles(roles); err != nil {
+			return nil, fmt.Errorf("user %s: %w", user, err)
+		}
+	}
+
+	if err := policy.checkRoles(file.Anonymous); err != nil {
+		return nil, fmt.Errorf("anonymous: %w", err)
+	}
+
+	return policy, nil
+}
+
+func (p *Policy) checkRoles(roles []string) error {
+	for _, role := range roles {
+		if _, ok := p.roles[role]; !ok {
+			return fmt.Errorf("unknown role %s", role)
+		}
+	}
+
+	return nil
+}
+
+// Roles returns the roles of user, those of anonymous requests for ""
+func (p *Policy) Roles(user string) []string {
+	if user == "" {
+		return p.anonymous
+	}
+
+	return p.users[user]
+}
+
+// HasRole reports whether user, "" for anonymous, has role: as one of their roles, or
+// inherited by one of them
+func (p *Policy) HasRole(user, role string) bool {
+	for _, own := range p.Roles(user) {
+		if own == role {
+			return true
+		}
+
+		for _, inherited := range p.inherits[own] {
+			if inherited == role {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Check returns nil when a role of user, "" for anonymous, is granted method on path, and
+// a *DeniedError saying what is missing otherwise.
+func (p *Policy) Check(user, method, path string) error {
+	roles := p.Roles(user)
+
+	for _, role := range roles {
+		for _, permission := range p.roles[role] {
+			if permission.Allows(method, path) {
+				return nil
+			}
+		}
+	}
+
+	denied := &DeniedError{User: user, Roles: roles, Method: method, Path: path}
+
+	for role, permissions := range p.roles {
+		for _, permission := range permissions {
+			if !permission.Allows(method, path) {
+				continue
+			}
+
+			if denied.Permission.Route == "" {
+				denied.Permission = permission
+			}
+
+			denied.GrantedTo = append(denied.GrantedTo, role)
+			break
+		}
+	}
+
+	sort.Strings(denied.GrantedTo)
+
+	return denied
+}
+
+// DeniedError is a request the roles of its user don't allow
+type DeniedError struct {
+	User   string // "" for anonymous requests
+	Roles  []string
+	Method string
+	Path   string
+
+	// Permission is one that would allow the request, zero when no role has one
+	Permission Permission
+	// GrantedTo are the roles allowed to make the request
+	GrantedTo []string
+}
+
+func (e *DeniedError) Error() string {
+	who := "anonymous users"
+
+	if e.User != "" {
+		who = "user " + e.User
+	}
+
+	roles := "no role"
+
+	if len(e.Roles) > 0 {
+		roles = "role " + strings.Join(e.Roles, ", ")
+	}
+
+	if len(e.GrantedTo) == 0 {
+		return fmt.Sprintf("%s (%s) may not %s %s: no role is allowed to", who, roles, e.Method, e.Path)
+	}
+
+	grantedTo := "role " + e.GrantedTo[0] + " has"
+
+	if len(e.GrantedTo) > 1 {
+		grantedTo = "roles " + strings.Join(e.GrantedTo, ", ") + " have"
+	}
+
+	return fmt.Sprintf("%s (%s) may not %s %s: it takes permission %q, which %s",
+		who, roles, e.Method, e.Path, e.Permission.String(), grantedTo)
+}
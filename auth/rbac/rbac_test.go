@@ -0,0 +1,215 @@
+package rbac
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testPolicy = `{
+  "roles": {
+    "viewer": {"permissions": ["GET /task/", "GET /task/{id}", "GET /due/*"]},
+    "editor": {"inherits": ["viewer"], "permissions": ["POST /task/", "DELETE /task/{id}"]},
+    "admin":  {"inherits": ["editor"], "permissions": ["DELETE /task/"]}
+  },
+  "users": {"shien": ["admin"], "john": ["editor"], "nobody": []},
+  "anonymous": ["viewer"]
+}`
+
+func mustParse(t *testing.T) *Policy {
+	t.Helper()
+
+	policy, err := ParsePolicy([]byte(testPolicy))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return policy
+}
+
+func TestPermissionAllows(t *testing.T) {
+	tests := []struct {
+		permission, method, path string
+		want                     bool
+	}{
+		{"GET /task/", "GET", "/task/", true},
+		{"GET /task/", "GET", "/task", true},
+		{"GET /task/", "POST", "/task/", false},
+		{"get /task/{id}", "GET", "/task/3", true},
+		{"GET /task/{id}", "GET", "/task/", false},
+		{"GET /task/{id}", "GET", "/task/3/history", false},
+		{"GET /due/*", "GET", "/due/", true},
+		{"GET /due/*", "GET", "/due/2021/8/1", true},
+		{"GET /due/*", "GET", "/overdue/", false},
+		{"* /trash/{id}/restore", "POST", "/trash/4/restore", true},
+	}
+
+	for _, test := range tests {
+		permission, err := ParsePermission(test.permission)
+
+		if err != nil {
+			t.Fatalf("ParsePermission(%q): %v", test.permission, err)
+		}
+
+		if got := permission.Allows(test.method, test.path); got != test.want {
+			t.Errorf("%q allows %s %s = %v, want %v", test.permission, test.method, test.path, got, test.want)
+		}
+	}
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	tests := []struct {
+		policy, want string
+	}{
+		{`{"roles": {"a": {"inherits": ["b"]}, "b": {"inherits": ["a"]}}}`, "inherits from itself"},
+		{`{"roles": {"a": {"inherits": ["z"]}}}`, "inherits unknown role z"},
+		{`{"roles": {"a": {"permissions": ["GET /x/*/y"]}}}`, "* only goes last"},
+		{`{"roles": {"a": {"permissions": ["GET"]}}}`, "expect <method> <route>"},
+		{`{"roles": {"a": {"permissions": ["GET task"]}}}`, "starting with /"},
+		{`{"users": {"john": ["a"]}}`, "user john: unknown role a"},
+		{`{"anonymous": ["a"]}`, "anonymous: unknown role a"},
+		{`{"rolez": {}}`, "unknown field"},
+	}
+
+	for _, test := range tests {
+		if _, err := ParsePolicy([]byte(test.policy)); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("ParsePolicy(%s): err = %v, want one saying %q", test.policy, err, test.want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	policy := mustParse(t)
+
+	tests := []struct {
+		user, method, path string
+		want               string // "" when allowed
+	}{
+		{"", "GET", "/task/", ""},
+		{"", "GET", "/due/2021/8/1", ""},
+		{"john", "DELETE", "/task/3", ""},
+		{"shien", "DELETE", "/task/", ""},
+		{"", "POST", "/task/", `anonymous users (role viewer) may not POST /task/: it takes permission "POST /task/", which roles admin, editor have`},
+		{"john", "DELETE", "/task/", `user john (role editor) may not DELETE /task/: it takes permission "DELETE /task/", which role admin has`},
+		{"nobody", "GET", "/task/", `user nobody (no role) may not GET /task/`},
+		{"stranger", "GET", "/task/", `user stranger (no role) may not GET /task/`},
+		{"shien", "GET", "/search/", `user shien (role admin) may not GET /search/: no role is allowed to`},
+	}
+
+	for _, test := range tests {
+		err := policy.Check(test.user, test.method, test.path)
+
+		if test.want == "" {
+			if err != nil {
+				t.Errorf("Check(%q, %s %s): %v", test.user, test.method, test.path, err)
+			}
+
+			continue
+		}
+
+		var denied *DeniedError
+
+		if !errors.As(err, &denied) || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("Check(%q, %s %s) = %v, want %s", test.user, test.method, test.path, err, test.want)
+		}
+	}
+}
+
+func TestHasRole(t *testing.T) {
+	policy := mustParse(t)
+
+	tests := []struct {
+		user, role string
+		want       bool
+	}{
+		{"shien", "admin", true},
+		{"shien", "viewer", true}, // inherited through editor
+		{"john", "editor", true},
+		{"john", "admin", false},
+		{"", "viewer", true},
+		{"", "editor", false},
+		{"nobody", "viewer", false},
+		{"stranger", "viewer", false},
+	}
+
+	for _, test := range tests {
+		if got := policy.HasRole(test.user, test.role); got != test.want {
+			t.Errorf("HasRole(%q, %s) = %v, want %v", test.user, test.role, got, test.want)
+		}
+	}
+}
+
+// userHeader takes the user of a request from its X-User header, for the tests
+func userHeader(req *http.Request) string {
+	return req.Header.Get("X-User")
+}
+
+// enforcerTests are the requests run through both middlewares of an Enforcer with Realm set
+var enforcerTests = []struct {
+	user, method, path string
+	status             int
+}{
+	{"", "GET", "/task/", http.StatusOK},
+	{"", "DELETE", "/task/", http.StatusUnauthorized},
+	{"john", "DELETE", "/task/", http.StatusForbidden},
+	{"john", "DELETE", "/task/3", http.StatusOK},
+	{"shien", "DELETE", "/task/", http.StatusOK},
+}
+
+func TestEnforcerHandler(t *testing.T) {
+	enforcer := &Enforcer{Policy: mustParse(t), User: userHeader, Realm: "api"}
+	handler := enforcer.Handler(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {}))
+
+	for _, test := range enforcerTests {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		req.Header.Set("X-User", test.user)
+		rsp := httptest.NewRecorder()
+		handler.ServeHTTP(rsp, req)
+
+		if rsp.Code != test.status {
+			t.Errorf("%q %s %s: status %d, want %d (%s)", test.user, test.method, test.path, rsp.Code, test.status, rsp.Body)
+		}
+
+		if challenge := rsp.Header().Get("WWW-Authenticate"); (rsp.Code == http.StatusUnauthorized) != (challenge == `Basic realm="api"`) {
+			t.Errorf("%q %s %s: WWW-Authenticate %q with status %d", test.user, test.method, test.path, challenge, rsp.Code)
+		}
+	}
+
+	// without a realm, anonymous requests are forbidden too
+	enforcer.Realm = ""
+	rsp := httptest.NewRecorder()
+	handler.ServeHTTP(rsp, httptest.NewRequest("DELETE", "/task/", nil))
+
+	if rsp.Code != http.StatusForbidden || !strings.Contains(rsp.Body.String(), `it takes permission "DELETE /task/"`) {
+		t.Errorf("anonymous DELETE /task/ without a realm: %d %s", rsp.Code, rsp.Body)
+	}
+}
+
+func TestEnforcerGin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	enforcer := &Enforcer{Policy: mustParse(t), User: userHeader, Realm: "api"}
+	router := gin.New()
+	router.Use(enforcer.Gin())
+
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/task/", ok)
+	router.DELETE("/task/", ok)
+	router.DELETE("/task/:id", ok)
+
+	for _, test := range enforcerTests {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		req.Header.Set("X-User", test.user)
+		rsp := httptest.NewRecorder()
+		router.ServeHTTP(rsp, req)
+
+		if rsp.Code != test.status {
+			t.Errorf("%q %s %s: status %d, want %d (%s)", test.user, test.method, test.path, rsp.Code, test.status, rsp.Body)
+		}
+	}
+}
@@ -12,33 +12,74 @@ import (
 
 	"github.com/shien/restserver/auth/taskstore-auth/middleware"
 	"github.com/shien/restserver/auth/taskstore-auth/taskserver"
+	"github.com/shien/restserver/taskstore"
+	"github.com/shien/restserver/taskstore/backend"
 )
 
 func main() {
 	certFile := flag.String("certfile", "cert.pem", "certificate PEM file")
 	keyFile := flag.String("keyfile", "key.pem", "key PEM file")
+	policyFile := flag.String("policy", "", "role-based access control policy JSON file, like auth/taskstore-auth/policy.json; required")
+	storeFlags := backend.RegisterFlags()
 	flag.Parse()
 
+	// unlike the other servers this one always checks a policy, which names its admins too
+	if *policyFile == "" {
+		log.Fatal("-policy is required: give the role-based access control policy JSON file, like auth/taskstore-auth/policy.json")
+	}
+
+	store, err := storeFlags.Open()
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	auth, err := middleware.LoadAuthorization(*policyFile)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	router := mux.NewRouter()
 	router.StrictSlash(true)
-	taskServer := taskserver.NewTaskServerForRouter()
+	// every user reaches their own tasks only, anonymous users those nobody owns
+	taskServer := taskserver.NewTaskServerForRouter(taskstore.NewScoped(store))
 
-	router.Handle("/task/", middleware.BasicAuth(http.HandlerFunc(taskServer.CreateTaskHandler))).Methods("POST")
+	router.HandleFunc("/task/", taskServer.CreateTaskHandler).Methods("POST")
 
 	router.HandleFunc("/task/", taskServer.GetAllTasksHandler).Methods("GET")
 	router.HandleFunc("/task/", taskServer.DeleteAllTasksHandler).Methods("DELETE")
 
 	router.HandleFunc("/task/{id:[0-9]+}", taskServer.GetTaskHandler).Methods("GET")
 	router.HandleFunc("/task/{id:[0-9]+}", taskServer.DeleteTaskHandler).Methods("DELETE")
+	router.HandleFunc("/task/{id:[0-9]+}", taskServer.UpdateTaskHandler).Methods("PUT")
+	router.HandleFunc("/task/{id:[0-9]+}", taskServer.PatchTaskHandler).Methods("PATCH")
+	router.HandleFunc("/task/{id:[0-9]+}/complete", taskServer.CompleteTaskHandler).Methods("POST")
+	router.HandleFunc("/task/{id:[0-9]+}/reopen", taskServer.ReopenTaskHandler).Methods("POST")
+	router.HandleFunc("/task/{id:[0-9]+}/history", taskServer.GetHistoryHandler).Methods("GET")
+	router.HandleFunc("/task/{id:[0-9]+}/revert", taskServer.RevertTaskHandler).Methods("POST")
 
 	router.HandleFunc("/tag/{tag}", taskServer.TagHandler).Methods("GET")
 
+	// signed in users get their days matched in their own time zone
 	router.HandleFunc("/due/{year:[0-9]+}/{month:[0-9]+}/{day:[0-9]+}", taskServer.DueHandler).Methods("GET")
+	router.HandleFunc("/due/", taskServer.DueRangeHandler).Methods("GET")
+	router.HandleFunc("/overdue/", taskServer.OverdueHandler).Methods("GET")
+	router.HandleFunc("/search/", taskServer.SearchHandler).Methods("GET")
+
+	router.HandleFunc("/trash/", taskServer.GetTrashHandler).Methods("GET")
+	router.HandleFunc("/trash/{id:[0-9]+}/restore", taskServer.RestoreTaskHandler).Methods("POST")
 
 	router.Use(func(next http.Handler) http.Handler {
 		return handlers.LoggingHandler(os.Stdout, next)
 	})
 
+	router.Use(auth.Handler)
+	// users with the admin role reach the tasks of every user
+	router.Use(middleware.Admins(func(username string) bool {
+		return auth.Policy.HasRole(username, "admin")
+	}))
+
 	addr := "localhost:9090"
 	server := &http.Server{
 		Addr:    addr,
@@ -1,6 +1,9 @@
 package authdb
 
 import (
+	"log"
+	"time"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -11,6 +14,30 @@ var usersPasswords = map[string][]byte{
 	"john":  []byte("$2a$12$l398tX477zeEBP6Se0mAv.ZLR8.LZZehuDgbtw2yoQeMjIyCNCsRW"),
 }
 
+// the zone each user's due dates are matched in when a request names no tz
+var usersTimeZones = map[string]string{
+	"shien": "Asia/Taipei",
+	"john":  "America/New_York",
+}
+
+// UserTimeZone returns the user's time zone, false when the user has none
+func UserTimeZone(username string) (*time.Location, bool) {
+	name, ok := usersTimeZones[username]
+
+	if !ok {
+		return nil, false
+	}
+
+	loc, err := time.LoadLocation(name)
+
+	if err != nil {
+		log.Printf("time zone %q of user %s: %v", name, username, err)
+		return nil, false
+	}
+
+	return loc, true
+}
+
 func VerifyUserPassword(username string, password string) bool {
 	targetPassword, hasPassword := usersPasswords[username]
 
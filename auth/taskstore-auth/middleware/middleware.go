@@ -4,7 +4,10 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/gin-gonic/gin"
+
 	"github.com/shien/restserver/auth/taskstore-auth/authdb"
+	"github.com/shien/restserver/taskstore"
 )
 
 /*
@@ -14,21 +17,105 @@ the username, if the user was properly authenticated with a password.
 */
 const UserContextKey = "user"
 
+// UserOf returns the user the request was authenticated for, "" when nobody signed in
+func UserOf(req *http.Request) string {
+	username, _ := req.Context().Value(UserContextKey).(string)
+
+	return username
+}
+
 // BasicAuth is middleware that verifies the request has appropriate basic auth
-// set up with a user:password pair verified by authdb.
+// set up with a user:password pair verified by authdb. Requests a middleware further
+// up, like OptionalBasicAuth on a whole router, already signed in pass through as they
+// are: their password is not hashed a second time.
 func BasicAuth(next http.Handler) http.Handler {
 	wrappedFunc := func(rsp http.ResponseWriter, req *http.Request) {
-		username, password, ok := req.BasicAuth()
-
-		if ok && authdb.VerifyUserPassword(username, password) {
-			// make a key/value pair in a new Context, and pass it to the next goroutine
-			newctx := context.WithValue(req.Context(), UserContextKey, username)
-			next.ServeHTTP(rsp, req.WithContext(newctx))
-		} else {
-			rsp.Header().Set("WWW-Authenticate", `Basic realm="api"`)
-			http.Error(rsp, "Unauthorized", http.StatusUnauthorized)
+		if UserOf(req) != "" {
+			next.ServeHTTP(rsp, req)
+			return
+		}
+
+		authenticate(rsp, req, next)
+	}
+
+	return http.HandlerFunc(wrappedFunc)
+}
+
+// OptionalBasicAuth is like BasicAuth for endpoints open to anonymous users too:
+// requests without credentials pass through unauthenticated, while wrong
+// credentials are still rejected.
+func OptionalBasicAuth(next http.Handler) http.Handler {
+	wrappedFunc := func(rsp http.ResponseWriter, req *http.Request) {
+		if _, _, ok := req.BasicAuth(); !ok {
+			next.ServeHTTP(rsp, req)
+			return
 		}
+
+		authenticate(rsp, req, next)
 	}
 
 	return http.HandlerFunc(wrappedFunc)
 }
+
+// authenticate passes the request on to next with the user, and the user's time zone
+// for due dates, in its context; or answers 401 Unauthorized.
+func authenticate(rsp http.ResponseWriter, req *http.Request, next http.Handler) {
+	username, password, ok := req.BasicAuth()
+
+	if !ok || !authdb.VerifyUserPassword(username, password) {
+		rsp.Header().Set("WWW-Authenticate", `Basic realm="api"`)
+		http.Error(rsp, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// make a key/value pair in a new Context, and pass it to the next goroutine
+	newctx := context.WithValue(req.Context(), UserContextKey, username)
+	// the store records the changes made with this request as made by the user, and
+	// keeps it to the user's own tasks unless Admins says otherwise
+	newctx = taskstore.WithAuthor(newctx, username)
+	newctx = taskstore.WithTenant(newctx, taskstore.Tenant{Owner: username})
+
+	if loc, ok := authdb.UserTimeZone(username); ok {
+		newctx = taskstore.WithDefaultZone(newctx, loc)
+	}
+
+	next.ServeHTTP(rsp, req.WithContext(newctx))
+}
+
+// Admins is middleware letting the signed in users isAdmin reports on reach the tasks of
+// every user through a taskstore.Scoped; it runs after the authentication.
+func Admins(isAdmin func(username string) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		wrappedFunc := func(rsp http.ResponseWriter, req *http.Request) {
+			if username := UserOf(req); username != "" && isAdmin(username) {
+				tenant := taskstore.TenantOf(req.Context())
+				tenant.Admin = true
+				req = req.WithContext(taskstore.WithTenant(req.Context(), tenant))
+			}
+
+			next.ServeHTTP(rsp, req)
+		}
+
+		return http.HandlerFunc(wrappedFunc)
+	}
+}
+
+// Gin turns net/http middleware, like OptionalBasicAuth, into gin middleware: the gin
+// handlers run with the request it passes on, and none of them runs when it answers itself.
+func Gin(wrap func(http.Handler) http.Handler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		passed := false
+
+		next := func(rsp http.ResponseWriter, req *http.Request) {
+			passed = true
+			c.Request = req
+			c.Next()
+		}
+
+		wrap(http.HandlerFunc(next)).ServeHTTP(c.Writer, c.Request)
+
+		if !passed {
+			c.Abort()
+		}
+	}
+}
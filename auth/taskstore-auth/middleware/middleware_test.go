@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/mux"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+// the requests run through the shipped policy, as the task servers wire it
+var policyTests = []struct {
+	name           string
+	user, password string // no credentials for an empty user
+	method, path   string
+	status         int
+}{
+	{"anonymous read", "", "", "GET", "/task/", http.StatusOK},
+	{"anonymous write", "", "", "POST", "/task/", http.StatusUnauthorized},
+	{"anonymous wipe", "", "", "DELETE", "/task/", http.StatusUnauthorized},
+	{"wrong password", "shien", "4321", "GET", "/task/", http.StatusUnauthorized},
+	{"admin wipe", "shien", "1234", "DELETE", "/task/", http.StatusOK},
+	{"admin delete", "shien", "1234", "DELETE", "/task/3", http.StatusOK},
+}
+
+func newAuthorization(t *testing.T) *Authorization {
+	t.Helper()
+
+	auth, err := LoadAuthorization("../policy.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return auth
+}
+
+// ok answers 200 with the signed in user
+func ok(rsp http.ResponseWriter, req *http.Request) {
+	rsp.Write([]byte(UserOf(req)))
+}
+
+func runPolicyTests(t *testing.T, handler http.Handler) {
+	for _, test := range policyTests {
+		req := httptest.NewRequest(test.method, test.path, nil)
+
+		if test.user != "" {
+			req.SetBasicAuth(test.user, test.password)
+		}
+
+		rsp := httptest.NewRecorder()
+		handler.ServeHTTP(rsp, req)
+
+		if rsp.Code != test.status {
+			t.Errorf("%s, %s %s: status %d, want %d (%s)", test.name, test.method, test.path, rsp.Code, test.status, rsp.Body)
+		}
+
+		if rsp.Code == http.StatusOK && rsp.Body.String() != test.user {
+			t.Errorf("%s, %s %s: handled for user %q, want %q", test.name, test.method, test.path, rsp.Body, test.user)
+		}
+	}
+}
+
+func TestNoPolicy(t *testing.T) {
+	if auth, err := LoadAuthorization(""); auth != nil || err != nil {
+		t.Errorf("LoadAuthorization without a file = %+v, %v; want nothing to check", auth, err)
+	}
+
+	if _, err := LoadAuthorization("no-such-policy.json"); err == nil {
+		t.Error("LoadAuthorization of a missing file: err = nil")
+	}
+}
+
+func TestPolicyServeMux(t *testing.T) {
+	serveMux := http.NewServeMux()
+	serveMux.HandleFunc("/task/", ok)
+
+	runPolicyTests(t, newAuthorization(t).Handler(serveMux))
+}
+
+func TestPolicyRouter(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/task/", ok).Methods("GET", "POST", "DELETE")
+	router.HandleFunc("/task/{id:[0-9]+}", ok).Methods("DELETE")
+	router.Use(newAuthorization(t).Handler)
+
+	runPolicyTests(t, router)
+}
+
+func TestPolicyGin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(newAuthorization(t).Gin())
+
+	handler := func(c *gin.Context) { ok(c.Writer, c.Request) }
+	router.GET("/task/", handler)
+	router.POST("/task/", handler)
+	router.DELETE("/task/", handler)
+	router.DELETE("/task/:id", handler)
+
+	runPolicyTests(t, router)
+}
+
+func TestBasicAuthAfterOptionalBasicAuth(t *testing.T) {
+	router := mux.NewRouter()
+	// the credentials are gone by the time BasicAuth runs: it goes by the user signed in
+	// further up instead of checking them again
+	router.Handle("/ws", BasicAuth(http.HandlerFunc(ok)))
+	router.Use(OptionalBasicAuth)
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+			req.Header.Del("Authorization")
+			next.ServeHTTP(rsp, req)
+		})
+	})
+
+	req := httptest.NewRequest("GET", "/ws", nil)
+	req.SetBasicAuth("shien", "1234")
+	rsp := httptest.NewRecorder()
+	router.ServeHTTP(rsp, req)
+
+	if rsp.Code != http.StatusOK || rsp.Body.String() != "shien" {
+		t.Errorf("signed in: status %d, user %q; want 200 for shien", rsp.Code, rsp.Body)
+	}
+
+	rsp = httptest.NewRecorder()
+	router.ServeHTTP(rsp, httptest.NewRequest("GET", "/ws", nil))
+
+	if rsp.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous: status %d, want 401", rsp.Code)
+	}
+}
+
+func TestAdmins(t *testing.T) {
+	policy := newAuthorization(t).Policy
+	admin := func(rsp http.ResponseWriter, req *http.Request) {
+		if taskstore.TenantOf(req.Context()).Admin {
+			rsp.Write([]byte("admin"))
+		}
+	}
+	handler := OptionalBasicAuth(Admins(func(username string) bool {
+		return policy.HasRole(username, "admin")
+	})(http.HandlerFunc(admin)))
+
+	for _, test := range []struct {
+		user, want string
+	}{{"shien", "admin"}, {"", ""}} {
+		req := httptest.NewRequest("GET", "/task/", nil)
+
+		if test.user != "" {
+			req.SetBasicAuth(test.user, "1234")
+		}
+
+		rsp := httptest.NewRecorder()
+		handler.ServeHTTP(rsp, req)
+
+		if rsp.Body.String() != test.want {
+			t.Errorf("user %q: tenant admin = %q, want %q", test.user, rsp.Body, test.want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"flag"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/shien/restserver/auth/rbac"
+)
+
+// RegisterPolicyFlag defines the -policy flag of the servers checking an rbac.Policy on
+// the default command-line flag set; call it before flag.Parse and pass the file to
+// LoadAuthorization.
+func RegisterPolicyFlag() *string {
+	return flag.String("policy", "", "role-based access control policy JSON file, requests signing in with the users of authdb; none is checked when empty")
+}
+
+// Authorization is the access control of a server: requests sign in with
+// OptionalBasicAuth, then the policy decides which routes they may call. Anonymous
+// requests get the roles the policy gives them, and are asked to sign in when these
+// don't allow the call.
+type Authorization struct {
+	Policy *rbac.Policy
+
+	enforcer *rbac.Enforcer
+}
+
+// LoadAuthorization returns the Authorization of the policy file, nil for an empty file
+// name: the server checks nothing then.
+func LoadAuthorization(file string) (*Authorization, error) {
+	if file == "" {
+		return nil, nil
+	}
+
+	policy, err := rbac.LoadPolicy(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Authorization{
+		Policy:   policy,
+		enforcer: &rbac.Enforcer{Policy: policy, User: UserOf, Realm: "api"},
+	}, nil
+}
+
+// Handler is the middleware for net/http, a ServeMux as well as a gorilla/mux router
+// (router.Use(auth.Handler))
+func (a *Authorization) Handler(next http.Handler) http.Handler {
+	return OptionalBasicAuth(a.enforcer.Handler(next))
+}
+
+// Gin returns Handler as gin middleware
+func (a *Authorization) Gin() gin.HandlerFunc {
+	return Gin(a.Handler)
+}
@@ -15,12 +15,10 @@ import (
 
 // Backend server wraps the database like taskstore
 type TaskServerForRouter struct {
-	Datastore *taskstore.TaskStore
+	Datastore taskstore.Store
 }
 
-func NewTaskServerForRouter() *TaskServerForRouter {
-	store := taskstore.New()
-
+func NewTaskServerForRouter(store taskstore.Store) *TaskServerForRouter {
 	return &TaskServerForRouter{Datastore: store}
 }
 
@@ -61,7 +59,12 @@ func (ts *TaskServerForRouter) CreateTaskHandler(rsp http.ResponseWriter, req *h
 		return
 	}
 
-	id := ts.Datastore.CreateTask(rt.Text, rt.Tags, rt.Due)
+	id, err := ts.Datastore.CreateTask(req.Context(), rt.Text, rt.Tags, rt.Due)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	taskserver.MarshalAndPrepareHTTPResponse(RequestTaskID{Id: id}, rsp)
 }
@@ -71,22 +74,46 @@ func (ts *TaskServerForRouter) DeleteTaskHandler(rsp http.ResponseWriter, req *h
 
 	id, _ := strconv.Atoi(mux.Vars(req)["id"])
 
-	err := ts.Datastore.DeleteTask(id)
+	version, status, err := taskserver.ExpectedVersion(req.Context(), ts.Datastore, id, req)
 
 	if err != nil {
-		http.Error(rsp, err.Error(), http.StatusNotFound)
+		http.Error(rsp, err.Error(), status)
+		return
+	}
+
+	err = ts.Datastore.DeleteTask(req.Context(), id, version)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), taskserver.StatusForStoreError(err))
 	}
 }
 
 func (ts *TaskServerForRouter) DeleteAllTasksHandler(rsp http.ResponseWriter, req *http.Request) {
 	log.Printf("Handling delete all tasks at %s\n", req.URL.Path)
-	ts.Datastore.DeleteAllTasks()
+
+	if err := taskserver.ConfirmDeleteAll(req); err != nil {
+		http.Error(rsp, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := ts.Datastore.DeleteAllTasks(req.Context()); err != nil {
+		http.Error(rsp, err.Error(), taskserver.StatusForStoreError(err))
+	}
 }
 
 func (ts *TaskServerForRouter) GetAllTasksHandler(rsp http.ResponseWriter, req *http.Request) {
 	log.Printf("Handling get all tasks at %s\n", req.URL.Path)
 
-	allTasks := ts.Datastore.GetAllTasks() // 1. backend service
+	allTasks, status, err := taskserver.ListTasks(req.Context(), ts.Datastore, req) // 1. backend service
+
+	if err == nil {
+		allTasks, status, err = taskserver.PageTasks(rsp, req, allTasks, taskserver.ByID)
+	}
+
+	if err != nil {
+		http.Error(rsp, err.Error(), status)
+		return
+	}
 
 	taskserver.MarshalAndPrepareHTTPResponse(allTasks, rsp)
 }
@@ -96,22 +123,94 @@ func (ts *TaskServerForRouter) GetTaskHandler(rsp http.ResponseWriter, req *http
 
 	id, _ := strconv.Atoi(mux.Vars(req)["id"])
 
-	task, err := ts.Datastore.GetTask(id)
+	task, err := ts.Datastore.GetTask(req.Context(), id)
 
 	if err != nil {
-		http.Error(rsp, err.Error(), http.StatusNotFound)
+		http.Error(rsp, err.Error(), taskserver.StatusForStoreError(err))
+		return
+	}
+
+	rsp.Header().Set("ETag", taskserver.ETag(task))
+
+	if taskserver.NotModified(req, task) {
+		rsp.WriteHeader(http.StatusNotModified)
 		return
 	}
 
 	taskserver.MarshalAndPrepareHTTPResponse(task, rsp) // 2. Prepare the HTTP response to client
 }
 
+func (ts *TaskServerForRouter) UpdateTaskHandler(rsp http.ResponseWriter, req *http.Request) {
+	log.Printf("Handling update a task at %s\n", req.URL.Path)
+
+	type RequestTask struct {
+		Text   string           `json:"text"`
+		Tags   []string         `json:"tags"`
+		Due    time.Time        `json:"due"`
+		Status taskstore.Status `json:"status"` // optional, keeps the current status when left out
+	}
+
+	id, _ := strconv.Atoi(mux.Vars(req)["id"])
+
+	var rt RequestTask
+
+	if status, err := taskserver.DecodeJSONBody(req, &rt); err != nil {
+		http.Error(rsp, err.Error(), status)
+		return
+	}
+
+	version, status, err := taskserver.ExpectedVersion(req.Context(), ts.Datastore, id, req)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), status)
+		return
+	}
+
+	task, err := ts.Datastore.UpdateTask(req.Context(), taskstore.Task{ID: id, Text: rt.Text, Tags: rt.Tags, Due: rt.Due, Version: version, Status: rt.Status})
+
+	if err != nil {
+		http.Error(rsp, err.Error(), taskserver.StatusForStoreError(err))
+		return
+	}
+
+	rsp.Header().Set("ETag", taskserver.ETag(task))
+	taskserver.MarshalAndPrepareHTTPResponse(task, rsp)
+}
+
+func (ts *TaskServerForRouter) PatchTaskHandler(rsp http.ResponseWriter, req *http.Request) {
+	log.Printf("Handling patch a task at %s\n", req.URL.Path)
+
+	id, _ := strconv.Atoi(mux.Vars(req)["id"])
+
+	task, status, err := taskserver.PatchStoredTask(req.Context(), ts.Datastore, id, req)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), status)
+		return
+	}
+
+	rsp.Header().Set("ETag", taskserver.ETag(task))
+	taskserver.MarshalAndPrepareHTTPResponse(task, rsp)
+}
+
 func (ts *TaskServerForRouter) TagHandler(rsp http.ResponseWriter, req *http.Request) {
 	log.Printf("Handling get a task by tag at %s\n", req.URL.Path)
 
 	tag := mux.Vars(req)["tag"]
 
-	tasks := ts.Datastore.GetTaskByTag(tag)
+	tasks, err := ts.Datastore.GetTaskByTag(req.Context(), tag)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), taskserver.StatusForStoreError(err))
+		return
+	}
+
+	tasks, status, err := taskserver.PageTasks(rsp, req, tasks, taskserver.ByID)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), status)
+		return
+	}
 
 	taskserver.MarshalAndPrepareHTTPResponse(tasks, rsp)
 }
@@ -125,7 +224,159 @@ func (ts *TaskServerForRouter) DueHandler(rsp http.ResponseWriter, req *http.Req
 	month, _ := strconv.Atoi(vars["month"])
 	day, _ := strconv.Atoi(vars["day"])
 
-	tasks := ts.Datastore.GetTaskByDueDate(year, time.Month(month), day)
+	tasks, status, err := taskserver.ListTasksDueOn(req.Context(), ts.Datastore, req, year, time.Month(month), day)
+
+	if err == nil {
+		tasks, status, err = taskserver.PageTasks(rsp, req, tasks, taskserver.ByDue)
+	}
+
+	if err != nil {
+		http.Error(rsp, err.Error(), status)
+		return
+	}
+
+	taskserver.MarshalAndPrepareHTTPResponse(tasks, rsp)
+}
+
+func (ts *TaskServerForRouter) DueRangeHandler(rsp http.ResponseWriter, req *http.Request) {
+	log.Printf("Handling get tasks by due range at %s\n", req.URL.Path)
+
+	tasks, status, err := taskserver.ListTasksDue(req.Context(), ts.Datastore, req)
+
+	if err == nil {
+		tasks, status, err = taskserver.PageTasks(rsp, req, tasks, taskserver.ByDue)
+	}
+
+	if err != nil {
+		http.Error(rsp, err.Error(), status)
+		return
+	}
+
+	taskserver.MarshalAndPrepareHTTPResponse(tasks, rsp)
+}
+
+func (ts *TaskServerForRouter) OverdueHandler(rsp http.ResponseWriter, req *http.Request) {
+	log.Printf("Handling get overdue tasks at %s\n", req.URL.Path)
+
+	tasks, err := taskstore.GetOverdueTasks(req.Context(), ts.Datastore, time.Now())
+
+	if err != nil {
+		http.Error(rsp, err.Error(), taskserver.StatusForStoreError(err))
+		return
+	}
+
+	tasks, status, err := taskserver.PageTasks(rsp, req, tasks, taskserver.ByDue)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), status)
+		return
+	}
+
+	taskserver.MarshalAndPrepareHTTPResponse(tasks, rsp)
+}
+
+func (ts *TaskServerForRouter) SearchHandler(rsp http.ResponseWriter, req *http.Request) {
+	log.Printf("Handling search tasks at %s\n", req.URL.Path)
+
+	results, status, err := taskserver.SearchTasks(req.Context(), ts.Datastore, req)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), status)
+		return
+	}
+
+	taskserver.MarshalAndPrepareHTTPResponse(results, rsp)
+}
+
+func (ts *TaskServerForRouter) GetTrashHandler(rsp http.ResponseWriter, req *http.Request) {
+	log.Printf("Handling get the trash at %s\n", req.URL.Path)
+
+	tasks, err := ts.Datastore.GetTrash(req.Context())
+
+	if err != nil {
+		http.Error(rsp, err.Error(), taskserver.StatusForStoreError(err))
+		return
+	}
+
+	tasks, status, err := taskserver.PageTasks(rsp, req, tasks, taskserver.ByDeleted)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), status)
+		return
+	}
 
 	taskserver.MarshalAndPrepareHTTPResponse(tasks, rsp)
 }
+
+func (ts *TaskServerForRouter) RestoreTaskHandler(rsp http.ResponseWriter, req *http.Request) {
+	log.Printf("Handling restore a task at %s\n", req.URL.Path)
+
+	id, _ := strconv.Atoi(mux.Vars(req)["id"])
+
+	task, err := ts.Datastore.RestoreTask(req.Context(), id)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), taskserver.StatusForStoreError(err))
+		return
+	}
+
+	rsp.Header().Set("ETag", taskserver.ETag(task))
+	taskserver.MarshalAndPrepareHTTPResponse(task, rsp)
+}
+
+func (ts *TaskServerForRouter) GetHistoryHandler(rsp http.ResponseWriter, req *http.Request) {
+	log.Printf("Handling get the history of a task at %s\n", req.URL.Path)
+
+	id, _ := strconv.Atoi(mux.Vars(req)["id"])
+
+	revs, err := ts.Datastore.GetHistory(req.Context(), id)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), taskserver.StatusForStoreError(err))
+		return
+	}
+
+	taskserver.MarshalAndPrepareHTTPResponse(revs, rsp)
+}
+
+func (ts *TaskServerForRouter) RevertTaskHandler(rsp http.ResponseWriter, req *http.Request) {
+	log.Printf("Handling revert a task at %s\n", req.URL.Path)
+
+	id, _ := strconv.Atoi(mux.Vars(req)["id"])
+
+	task, status, err := taskserver.RevertStoredTask(req.Context(), ts.Datastore, id, req)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), status)
+		return
+	}
+
+	rsp.Header().Set("ETag", taskserver.ETag(task))
+	taskserver.MarshalAndPrepareHTTPResponse(task, rsp)
+}
+
+func (ts *TaskServerForRouter) CompleteTaskHandler(rsp http.ResponseWriter, req *http.Request) {
+	log.Printf("Handling complete a task at %s\n", req.URL.Path)
+
+	ts.transitionTask(rsp, req, taskstore.StatusDone)
+}
+
+func (ts *TaskServerForRouter) ReopenTaskHandler(rsp http.ResponseWriter, req *http.Request) {
+	log.Printf("Handling reopen a task at %s\n", req.URL.Path)
+
+	ts.transitionTask(rsp, req, taskstore.StatusOpen)
+}
+
+func (ts *TaskServerForRouter) transitionTask(rsp http.ResponseWriter, req *http.Request, status taskstore.Status) {
+	id, _ := strconv.Atoi(mux.Vars(req)["id"])
+
+	task, code, err := taskserver.TransitionStoredTask(req.Context(), ts.Datastore, id, status, req)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), code)
+		return
+	}
+
+	rsp.Header().Set("ETag", taskserver.ETag(task))
+	taskserver.MarshalAndPrepareHTTPResponse(task, rsp)
+}
@@ -0,0 +1,77 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shien/restserver/graphql/graph/model"
+	"github.com/shien/restserver/taskstore"
+)
+
+var (
+	byID  = taskstore.Order{Field: taskstore.SortByID}
+	byDue = taskstore.Order{Field: taskstore.SortByDue}
+)
+
+// taskOrder returns the order orderBy asks for, defaultOrder when it is left out
+func taskOrder(orderBy *model.TaskOrder, defaultOrder taskstore.Order) taskstore.Order {
+	if orderBy == nil {
+		return defaultOrder
+	}
+
+	order := taskstore.Order{Field: taskstore.SortField(strings.ToLower(string(orderBy.Field)))}
+
+	if orderBy.Direction != nil && *orderBy.Direction == model.SortDirectionDesc {
+		order.Desc = true
+	}
+
+	return order
+}
+
+// taskConnection sorts tasks and returns the page selected by first and after as a
+// Relay connection; pagination works as for the REST servers, see taskstore.Page.
+func taskConnection(tasks []*model.Task, orderBy *model.TaskOrder, defaultOrder taskstore.Order, first *int, after *string) (*model.TaskConnection, error) {
+	order := taskOrder(orderBy, defaultOrder)
+	limit, cursor := 0, ""
+
+	if first != nil {
+		if *first < 1 || *first > taskstore.MaxPageLimit {
+			return nil, fmt.Errorf("expect first from 1 to %d, got %d", taskstore.MaxPageLimit, *first)
+		}
+
+		limit = *first
+	}
+
+	if after != nil {
+		cursor = *after
+	}
+
+	key := func(i int) taskstore.SortKey {
+		return taskstore.SortKey{ID: tasks[i].ID, Due: tasks[i].Due, Text: tasks[i].Text}
+	}
+
+	start, end, next, err := taskstore.Page(len(tasks), key,
+		func(i, j int) { tasks[i], tasks[j] = tasks[j], tasks[i] },
+		order, cursor, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	connection := &model.TaskConnection{
+		Edges:      make([]*model.TaskEdge, 0, end-start),
+		PageInfo:   &model.PageInfo{HasNextPage: next != "", HasPreviousPage: start > 0},
+		TotalCount: len(tasks),
+	}
+
+	for i := start; i < end; i++ {
+		connection.Edges = append(connection.Edges, &model.TaskEdge{Cursor: order.Cursor(key(i)), Node: tasks[i]})
+	}
+
+	if len(connection.Edges) > 0 {
+		connection.PageInfo.StartCursor = &connection.Edges[0].Cursor
+		connection.PageInfo.EndCursor = &connection.Edges[len(connection.Edges)-1].Cursor
+	}
+
+	return connection, nil
+}
@@ -3,6 +3,9 @@
 package model
 
 import (
+	"fmt"
+	"io"
+	"strconv"
 	"time"
 )
 
@@ -25,10 +28,222 @@ type NewTask struct {
 	Attachments []*NewAttachment `json:"Attachments"`
 }
 
+type PageInfo struct {
+	HasNextPage     bool    `json:"hasNextPage"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor"`
+	EndCursor       *string `json:"endCursor"`
+}
+
+type SearchResult struct {
+	Task    *Task   `json:"task"`
+	Score   float64 `json:"score"`
+	Snippet string  `json:"snippet"`
+}
+
 type Task struct {
 	ID          int           `json:"Id"`
 	Text        string        `json:"Text"`
 	Tags        []string      `json:"Tags"`
 	Due         time.Time     `json:"Due"`
 	Attachments []*Attachment `json:"Attachments"`
+	Status      TaskStatus    `json:"Status"`
+	CompletedAt *time.Time    `json:"CompletedAt"`
+}
+
+type TaskConnection struct {
+	Edges      []*TaskEdge `json:"edges"`
+	PageInfo   *PageInfo   `json:"pageInfo"`
+	TotalCount int         `json:"totalCount"`
+}
+
+type TaskEdge struct {
+	Cursor string `json:"cursor"`
+	Node   *Task  `json:"node"`
+}
+
+type TaskEvent struct {
+	Type TaskEventType `json:"type"`
+	Task *Task         `json:"task"`
+}
+
+type TaskOrder struct {
+	Field     TaskSortField  `json:"field"`
+	Direction *SortDirection `json:"direction"`
+}
+
+type SortDirection string
+
+const (
+	SortDirectionAsc  SortDirection = "ASC"
+	SortDirectionDesc SortDirection = "DESC"
+)
+
+var AllSortDirection = []SortDirection{
+	SortDirectionAsc,
+	SortDirectionDesc,
+}
+
+func (e SortDirection) IsValid() bool {
+	switch e {
+	case SortDirectionAsc, SortDirectionDesc:
+		return true
+	}
+	return false
+}
+
+func (e SortDirection) String() string {
+	return string(e)
+}
+
+func (e *SortDirection) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SortDirection(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SortDirection", str)
+	}
+	return nil
+}
+
+func (e SortDirection) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type TaskEventType string
+
+const (
+	TaskEventTypeCreated TaskEventType = "CREATED"
+	TaskEventTypeUpdated TaskEventType = "UPDATED"
+	TaskEventTypeDeleted TaskEventType = "DELETED"
+)
+
+var AllTaskEventType = []TaskEventType{
+	TaskEventTypeCreated,
+	TaskEventTypeUpdated,
+	TaskEventTypeDeleted,
+}
+
+func (e TaskEventType) IsValid() bool {
+	switch e {
+	case TaskEventTypeCreated, TaskEventTypeUpdated, TaskEventTypeDeleted:
+		return true
+	}
+	return false
+}
+
+func (e TaskEventType) String() string {
+	return string(e)
+}
+
+func (e *TaskEventType) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = TaskEventType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid TaskEventType", str)
+	}
+	return nil
+}
+
+func (e TaskEventType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type TaskSortField string
+
+const (
+	TaskSortFieldID      TaskSortField = "ID"
+	TaskSortFieldDue     TaskSortField = "DUE"
+	TaskSortFieldText    TaskSortField = "TEXT"
+	TaskSortFieldCreated TaskSortField = "CREATED"
+)
+
+var AllTaskSortField = []TaskSortField{
+	TaskSortFieldID,
+	TaskSortFieldDue,
+	TaskSortFieldText,
+	TaskSortFieldCreated,
+}
+
+func (e TaskSortField) IsValid() bool {
+	switch e {
+	case TaskSortFieldID, TaskSortFieldDue, TaskSortFieldText, TaskSortFieldCreated:
+		return true
+	}
+	return false
+}
+
+func (e TaskSortField) String() string {
+	return string(e)
+}
+
+func (e *TaskSortField) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = TaskSortField(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid TaskSortField", str)
+	}
+	return nil
+}
+
+func (e TaskSortField) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type TaskStatus string
+
+const (
+	TaskStatusOpen       TaskStatus = "OPEN"
+	TaskStatusInProgress TaskStatus = "IN_PROGRESS"
+	TaskStatusBlocked    TaskStatus = "BLOCKED"
+	TaskStatusDone       TaskStatus = "DONE"
+	TaskStatusCancelled  TaskStatus = "CANCELLED"
+)
+
+var AllTaskStatus = []TaskStatus{
+	TaskStatusOpen,
+	TaskStatusInProgress,
+	TaskStatusBlocked,
+	TaskStatusDone,
+	TaskStatusCancelled,
+}
+
+func (e TaskStatus) IsValid() bool {
+	switch e {
+	case TaskStatusOpen, TaskStatusInProgress, TaskStatusBlocked, TaskStatusDone, TaskStatusCancelled:
+		return true
+	}
+	return false
+}
+
+func (e TaskStatus) String() string {
+	return string(e)
+}
+
+func (e *TaskStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = TaskStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid TaskStatus", str)
+	}
+	return nil
+}
+
+func (e TaskStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
 }
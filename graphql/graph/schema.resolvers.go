@@ -5,10 +5,12 @@ package graph
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/shien/restserver/graphql/graph/generated"
 	"github.com/shien/restserver/graphql/graph/model"
+	"github.com/shien/restserver/taskstore"
 )
 
 func (r *mutationResolver) CreateTask(ctx context.Context, input model.NewTask) (*model.Task, error) {
@@ -32,6 +34,18 @@ func (r *mutationResolver) DeleteAllTasks(ctx context.Context) (*bool, error) {
 	return nil, r.Store.DeleteAllTasks()
 }
 
+func (r *mutationResolver) CompleteTask(ctx context.Context, id int) (*model.Task, error) {
+	return r.Store.SetTaskStatus(id, model.TaskStatusDone)
+}
+
+func (r *mutationResolver) ReopenTask(ctx context.Context, id int) (*model.Task, error) {
+	return r.Store.SetTaskStatus(id, model.TaskStatusOpen)
+}
+
+func (r *mutationResolver) SetTaskStatus(ctx context.Context, id int, status model.TaskStatus) (*model.Task, error) {
+	return r.Store.SetTaskStatus(id, status)
+}
+
 func (r *queryResolver) GetAllTasks(ctx context.Context) ([]*model.Task, error) {
 	return r.Store.GetAllTasks(), nil
 }
@@ -44,8 +58,72 @@ func (r *queryResolver) GetTasksByTag(ctx context.Context, tag string) ([]*model
 	return r.Store.GetTaskByTag(tag), nil
 }
 
-func (r *queryResolver) GetTasksByDue(ctx context.Context, due time.Time) ([]*model.Task, error) {
-	return r.Store.GetTaskByDueDate(due.Year(), due.Month(), due.Day()), nil
+func (r *queryResolver) GetTasksByDue(ctx context.Context, due time.Time, tz *string) ([]*model.Task, error) {
+	loc := taskstore.DefaultZone(ctx)
+
+	if tz != nil {
+		var err error
+
+		if loc, err = time.LoadLocation(*tz); err != nil {
+			return nil, fmt.Errorf("expect tz as an IANA time zone like Europe/Paris, got %q", *tz)
+		}
+	}
+
+	if loc == nil {
+		return r.Store.GetTaskByDueDate(due.Year(), due.Month(), due.Day()), nil
+	}
+
+	from, to := taskstore.DayRange(due.Year(), due.Month(), due.Day(), loc)
+
+	return r.Store.GetTaskDueBetween(&from, &to, true, false), nil
+}
+
+func (r *queryResolver) GetTasksByStatus(ctx context.Context, status model.TaskStatus) ([]*model.Task, error) {
+	return r.Store.GetTaskByStatus(status), nil
+}
+
+func (r *queryResolver) GetTasksDueBetween(ctx context.Context, from *time.Time, to *time.Time, includeFrom bool, includeTo bool) ([]*model.Task, error) {
+	return r.Store.GetTaskDueBetween(from, to, includeFrom, includeTo), nil
+}
+
+func (r *queryResolver) Tasks(ctx context.Context, first *int, after *string, orderBy *model.TaskOrder) (*model.TaskConnection, error) {
+	return taskConnection(r.Store.GetAllTasks(), orderBy, byID, first, after)
+}
+
+func (r *queryResolver) TasksByTag(ctx context.Context, tag string, first *int, after *string, orderBy *model.TaskOrder) (*model.TaskConnection, error) {
+	return taskConnection(r.Store.GetTaskByTag(tag), orderBy, byID, first, after)
+}
+
+func (r *queryResolver) TasksDueBetween(ctx context.Context, from *time.Time, to *time.Time, includeFrom bool, includeTo bool, first *int, after *string, orderBy *model.TaskOrder) (*model.TaskConnection, error) {
+	return taskConnection(r.Store.GetTaskDueBetween(from, to, includeFrom, includeTo), orderBy, byDue, first, after)
+}
+
+func (r *queryResolver) SearchTasks(ctx context.Context, query string, first *int) ([]*model.SearchResult, error) {
+	limit := 0
+
+	if first != nil {
+		if *first < 1 || *first > taskstore.MaxPageLimit {
+			return nil, fmt.Errorf("expect first from 1 to %d, got %d", taskstore.MaxPageLimit, *first)
+		}
+
+		limit = *first
+	}
+
+	return r.Store.SearchTasks(query, limit)
+}
+
+func (r *subscriptionResolver) TaskCreated(ctx context.Context) (<-chan *model.Task, error) {
+	return r.watchTaskEvents(ctx, model.TaskEventTypeCreated), nil
+}
+
+func (r *subscriptionResolver) TaskDeleted(ctx context.Context) (<-chan *model.Task, error) {
+	return r.watchTaskEvents(ctx, model.TaskEventTypeDeleted), nil
+}
+
+func (r *subscriptionResolver) TaskChanged(ctx context.Context, tag *string) (<-chan *model.TaskEvent, error) {
+	return r.watchTasks(ctx, func(event *model.TaskEvent) bool {
+		return tag == nil || hasTag(event.Task, *tag)
+	}), nil
 }
 
 // Mutation returns generated.MutationResolver implementation.
@@ -54,5 +132,9 @@ func (r *Resolver) Mutation() generated.MutationResolver { return &mutationResol
 // Query returns generated.QueryResolver implementation.
 func (r *Resolver) Query() generated.QueryResolver { return &queryResolver{r} }
 
+// Subscription returns generated.SubscriptionResolver implementation.
+func (r *Resolver) Subscription() generated.SubscriptionResolver { return &subscriptionResolver{r} }
+
 type mutationResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
+type subscriptionResolver struct{ *Resolver }
@@ -0,0 +1,59 @@
+package graph
+
+import (
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/shien/restserver/graphql/graph/generated"
+	"github.com/shien/restserver/graphql/taskstore"
+)
+
+func TestSearchTasks(t *testing.T) {
+	store := taskstore.New()
+
+	for _, text := range []string{"Write the quarterly report", "Report the reports to the boss", "Buy milk"} {
+		store.CreateTask(text, nil, time.Now(), nil)
+	}
+
+	c := client.New(handler.NewDefaultServer(generated.NewExecutableSchema(generated.Config{Resolvers: &Resolver{Store: store}})))
+
+	var resp struct {
+		SearchTasks []struct {
+			Task    struct{ Id string }
+			Score   float64
+			Snippet string
+		}
+	}
+
+	c.MustPost(`{ searchTasks(query: "report") { task { Id } score snippet } }`, &resp)
+
+	if len(resp.SearchTasks) != 2 {
+		t.Fatalf("got %+v, want the two reports", resp.SearchTasks)
+	}
+
+	// more occurrences of the word rank higher
+	if best := resp.SearchTasks[0]; best.Task.Id != "1" || best.Snippet != "<mark>Report</mark> the <mark>reports</mark> to the boss" {
+		t.Errorf("best result = %+v, want task 1 with both words marked", best)
+	}
+
+	if resp.SearchTasks[0].Score <= resp.SearchTasks[1].Score {
+		t.Errorf("scores %v and %v, want the best first", resp.SearchTasks[0].Score, resp.SearchTasks[1].Score)
+	}
+
+	c.MustPost(`{ searchTasks(query: "report", first: 1) { task { Id } score snippet } }`, &resp)
+
+	if len(resp.SearchTasks) != 1 || resp.SearchTasks[0].Task.Id != "1" {
+		t.Errorf("first: 1 got %+v, want task 1 alone", resp.SearchTasks)
+	}
+
+	for _, query := range []string{
+		`{ searchTasks(query: "") { score } }`,
+		`{ searchTasks(query: "report", first: 0) { score } }`,
+	} {
+		if err := c.Post(query, &resp); err == nil {
+			t.Errorf("%s: no error", query)
+		}
+	}
+}
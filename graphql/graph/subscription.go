@@ -0,0 +1,66 @@
+package graph
+
+import (
+	"context"
+
+	"github.com/shien/restserver/graphql/graph/model"
+)
+
+// watchTasks forwards the events of the store that keep says to keep, until ctx is done
+// or the store drops the subscriber for falling behind; either way the channel is closed,
+// which completes the subscription.
+func (r *Resolver) watchTasks(ctx context.Context, keep func(*model.TaskEvent) bool) <-chan *model.TaskEvent {
+	events := r.Store.Subscribe(ctx)
+	kept := make(chan *model.TaskEvent, 1)
+
+	go func() {
+		defer close(kept)
+
+		for event := range events {
+			if !keep(event) {
+				continue
+			}
+
+			select {
+			case kept <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return kept
+}
+
+// watchTaskEvents is like watchTasks for the events of one type, sending their tasks
+func (r *Resolver) watchTaskEvents(ctx context.Context, eventType model.TaskEventType) <-chan *model.Task {
+	events := r.watchTasks(ctx, func(event *model.TaskEvent) bool {
+		return event.Type == eventType
+	})
+	tasks := make(chan *model.Task, 1)
+
+	go func() {
+		defer close(tasks)
+
+		for event := range events {
+			select {
+			case tasks <- event.Task:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return tasks
+}
+
+// hasTag reports whether task is tagged tag
+func hasTag(task *model.Task, tag string) bool {
+	for _, taskTag := range task.Tags {
+		if taskTag == tag {
+			return true
+		}
+	}
+
+	return false
+}
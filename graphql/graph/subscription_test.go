@@ -0,0 +1,107 @@
+package graph
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/shien/restserver/graphql/graph/generated"
+	"github.com/shien/restserver/graphql/graph/model"
+	"github.com/shien/restserver/graphql/taskstore"
+)
+
+type taskChanged struct {
+	TaskChanged struct {
+		Type string
+		Task struct {
+			Id   string
+			Text string
+		}
+	}
+}
+
+// receiveEvents reads the events of sub into a channel, which is closed once sub fails
+func receiveEvents(sub *client.Subscription) <-chan taskChanged {
+	events := make(chan taskChanged)
+
+	go func() {
+		defer close(events)
+
+		for {
+			var resp taskChanged
+			if err := sub.Next(&resp); err != nil {
+				return
+			}
+			events <- resp
+		}
+	}()
+
+	return events
+}
+
+func nextEvent(t *testing.T, events <-chan taskChanged) taskChanged {
+	t.Helper()
+
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("subscription ended")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+	}
+	return taskChanged{}
+}
+
+func TestTaskChangedSubscription(t *testing.T) {
+	store := taskstore.New()
+	srv := handler.NewDefaultServer(generated.NewExecutableSchema(generated.Config{Resolvers: &Resolver{Store: store}}))
+	c := client.New(srv)
+
+	sub := c.Websocket(`subscription { taskChanged(tag: "work") { type task { Id Text } } }`)
+	defer sub.Close()
+	events := receiveEvents(sub)
+
+	// the server registers the subscription asynchronously: create tagged tasks until one
+	// is seen, then catch up to the last of them
+	var last int
+	var event taskChanged
+wait:
+	for {
+		last = store.CreateTask("warm up", []string{"work"}, time.Now(), nil)
+		select {
+		case event = <-events:
+			break wait
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	for event.TaskChanged.Task.Id != strconv.Itoa(last) {
+		event = nextEvent(t, events)
+	}
+
+	store.CreateTask("untagged", nil, time.Now(), nil)
+	id := store.CreateTask("write report", []string{"home", "work"}, time.Now(), nil)
+	event = nextEvent(t, events)
+	if event.TaskChanged.Type != string(model.TaskEventTypeCreated) || event.TaskChanged.Task.Text != "write report" {
+		t.Fatalf("got %+v, want the creation of the tagged task", event)
+	}
+
+	if _, err := store.SetTaskStatus(id, model.TaskStatusDone); err != nil {
+		t.Fatal(err)
+	}
+	event = nextEvent(t, events)
+	if event.TaskChanged.Type != string(model.TaskEventTypeUpdated) || event.TaskChanged.Task.Id != strconv.Itoa(id) {
+		t.Fatalf("got %+v, want the update of task %d", event, id)
+	}
+
+	if err := store.DeleteTask(id); err != nil {
+		t.Fatal(err)
+	}
+	event = nextEvent(t, events)
+	if event.TaskChanged.Type != string(model.TaskEventTypeDeleted) || event.TaskChanged.Task.Id != strconv.Itoa(id) {
+		t.Fatalf("got %+v, want the deletion of task %d", event, id)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	_ "time/tzdata" // getTasksByDue resolves tz names even without a system zoneinfo database
 
 	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/playground"
@@ -23,6 +24,7 @@ func main() {
 	resoler := &graph.Resolver{
 		Store: taskstore.New(),
 	}
+	// serves subscriptions at /query too, over graphql-ws web sockets kept alive every 10s
 	srv := handler.NewDefaultServer(generated.NewExecutableSchema(generated.Config{Resolvers: resoler}))
 
 	http.Handle("/", playground.Handler("GraphQL playground", "/query"))
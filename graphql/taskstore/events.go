@@ -0,0 +1,69 @@
+package taskstore
+
+import (
+	"context"
+
+	"github.com/shien/restserver/graphql/graph/model"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before it is dropped
+const subscriberBuffer = 64
+
+type subscriber struct {
+	events chan *model.TaskEvent
+	done   chan struct{} // closed once the subscriber is dropped
+}
+
+// Subscribe returns a channel receiving a TaskEvent for every change made to the store
+// from now on. It is closed once ctx is done, or as soon as the subscriber falls more than
+// subscriberBuffer events behind: publishing never waits for subscribers.
+func (ts *TaskStore) Subscribe(ctx context.Context) <-chan *model.TaskEvent {
+	sub := &subscriber{
+		events: make(chan *model.TaskEvent, subscriberBuffer),
+		done:   make(chan struct{}),
+	}
+
+	ts.Lock()
+	ts.subs[sub] = struct{}{}
+	ts.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			ts.Lock()
+			ts.drop(sub)
+			ts.Unlock()
+		case <-sub.done:
+		}
+	}()
+
+	return sub.events
+}
+
+// drop closes the channel of sub; ts is locked
+func (ts *TaskStore) drop(sub *subscriber) {
+	if _, ok := ts.subs[sub]; !ok {
+		return
+	}
+
+	delete(ts.subs, sub)
+	close(sub.events)
+	close(sub.done)
+}
+
+// publish sends a copy of task, as the change left it, to the subscribers; ts is locked
+func (ts *TaskStore) publish(eventType model.TaskEventType, task *model.Task) {
+	if len(ts.subs) == 0 {
+		return
+	}
+
+	event := &model.TaskEvent{Type: eventType, Task: copyTask(task)}
+
+	for sub := range ts.subs {
+		select {
+		case sub.events <- event:
+		default:
+			ts.drop(sub)
+		}
+	}
+}
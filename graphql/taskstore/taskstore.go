@@ -2,23 +2,32 @@ package taskstore
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/shien/restserver/graphql/graph/model"
+	"github.com/shien/restserver/taskstore"
 )
 
+// TaskStore keeps its tasks in memory. A stored task is never changed in place: changes
+// store a new copy, and callers get copies of their own, which they read without the lock.
 type TaskStore struct {
 	sync.Mutex
 
 	tasks  map[int]*model.Task
+	due    taskstore.DueIndex
+	text   taskstore.TextIndex
 	nextID int
+	subs   map[*subscriber]struct{}
 }
 
 func New() *TaskStore {
 	ts := &TaskStore{}
 	ts.tasks = make(map[int]*model.Task)
 	ts.nextID = 0
+	ts.subs = make(map[*subscriber]struct{})
 
 	return ts
 }
@@ -31,13 +40,17 @@ func (ts *TaskStore) CreateTask(text string, tags []string, due time.Time, attac
 		ID:          ts.nextID,
 		Text:        text,
 		Due:         due,
-		Attachments: attachments}
+		Attachments: attachments,
+		Status:      model.TaskStatusOpen}
 
 	task.Tags = make([]string, len(tags))
 	copy(task.Tags, tags)
 
 	ts.tasks[ts.nextID] = task
+	ts.due.Insert(task.Due, task.ID)
+	ts.text.Add(task.ID, task.Text)
 	ts.nextID++
+	ts.publish(model.TaskEventTypeCreated, task)
 
 	return task.ID
 }
@@ -49,7 +62,7 @@ func (ts *TaskStore) GetTask(id int) (*model.Task, error) {
 	task, ok := ts.tasks[id]
 
 	if ok {
-		return task, nil
+		return copyTask(task), nil
 	} else {
 		return nil, fmt.Errorf("task with id = %d not found", id)
 	}
@@ -63,7 +76,7 @@ func (ts *TaskStore) GetAllTasks() []*model.Task {
 	allTasks := make([]*model.Task, 0, len(ts.tasks))
 
 	for _, task := range ts.tasks {
-		allTasks = append(allTasks, task)
+		allTasks = append(allTasks, copyTask(task))
 	}
 
 	return allTasks
@@ -73,20 +86,40 @@ func (ts *TaskStore) DeleteTask(id int) error {
 	ts.Lock()
 	defer ts.Unlock()
 
-	if _, ok := ts.tasks[id]; !ok {
+	task, ok := ts.tasks[id]
+
+	if !ok {
 		return fmt.Errorf("task with id = %d not found", id)
 	}
 
+	ts.due.Remove(task.Due, id)
+	ts.text.Remove(id, task.Text)
 	delete(ts.tasks, id)
+	ts.publish(model.TaskEventTypeDeleted, task)
 
 	return nil
 }
 
+// DeleteAllTasks publishes the deletion of every task, in id order
 func (ts *TaskStore) DeleteAllTasks() error {
 	ts.Lock()
 	defer ts.Unlock()
 
+	ids := make([]int, 0, len(ts.tasks))
+
+	for id := range ts.tasks {
+		ids = append(ids, id)
+	}
+
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		ts.publish(model.TaskEventTypeDeleted, ts.tasks[id])
+	}
+
 	ts.tasks = make(map[int]*model.Task)
+	ts.due.Reset()
+	ts.text.Reset()
 
 	return nil
 }
@@ -101,7 +134,7 @@ TaskLoop:
 	for _, task := range ts.tasks {
 		for _, taskTag := range task.Tags {
 			if taskTag == tag {
-				tasks = append(tasks, task)
+				tasks = append(tasks, copyTask(task))
 				continue TaskLoop
 			}
 		}
@@ -120,9 +153,125 @@ func (ts *TaskStore) GetTaskByDueDate(year int, month time.Month, day int) []*mo
 		y, m, d := task.Due.Date()
 
 		if y == year && m == month && d == day {
-			tasks = append(tasks, task)
+			tasks = append(tasks, copyTask(task))
 		}
 	}
 
 	return tasks
 }
+
+func (ts *TaskStore) GetTaskByStatus(status model.TaskStatus) []*model.Task {
+	ts.Lock()
+	defer ts.Unlock()
+
+	var tasks []*model.Task
+
+	for _, task := range ts.tasks {
+		if task.Status == status {
+			tasks = append(tasks, copyTask(task))
+		}
+	}
+
+	return tasks
+}
+
+// SetTaskStatus moves the task to status, following the same lifecycle as the REST
+// servers' tasks (see taskstore.CheckTransition), and keeps CompletedAt in step.
+func (ts *TaskStore) SetTaskStatus(id int, status model.TaskStatus) (*model.Task, error) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	current, ok := ts.tasks[id]
+
+	if !ok {
+		return nil, fmt.Errorf("task with id = %d not found", id)
+	}
+
+	if err := taskstore.CheckTransition(lifecycleStatus(current.Status), lifecycleStatus(status)); err != nil {
+		return nil, fmt.Errorf("task with id = %d: %w", id, err)
+	}
+
+	if current.Status == status {
+		return copyTask(current), nil // nothing changes, nothing to publish
+	}
+
+	task := copyTask(current)
+
+	if status != model.TaskStatusDone {
+		task.CompletedAt = nil
+	} else if current.Status != model.TaskStatusDone {
+		now := time.Now().UTC()
+		task.CompletedAt = &now
+	}
+
+	task.Status = status
+	ts.tasks[id] = task
+	ts.publish(model.TaskEventTypeUpdated, task)
+
+	return copyTask(task), nil
+}
+
+// copyTask returns a copy of a stored task for a caller to keep; the slices are shared,
+// the store never changes them.
+func copyTask(task *model.Task) *model.Task {
+	copied := *task
+
+	return &copied
+}
+
+// lifecycleStatus maps a GraphQL enum value (IN_PROGRESS) to its taskstore.Status (in_progress)
+func lifecycleStatus(status model.TaskStatus) taskstore.Status {
+	return taskstore.Status(strings.ToLower(string(status)))
+}
+
+// GetTaskDueBetween returns the tasks due from from to to ordered by due time, with from
+// and to themselves in the range if includeFrom and includeTo; a nil from or to leaves
+// that end of the range open.
+func (ts *TaskStore) GetTaskDueBetween(from, to *time.Time, includeFrom, includeTo bool) []*model.Task {
+	ts.Lock()
+	defer ts.Unlock()
+
+	var start, end time.Time
+
+	if from != nil {
+		start = *from
+	}
+
+	if to != nil {
+		end = *to
+	}
+
+	var tasks []*model.Task
+
+	for _, id := range ts.due.Between(start, end, taskstore.Bounds{IncludeFrom: includeFrom, IncludeTo: includeTo}) {
+		tasks = append(tasks, copyTask(ts.tasks[id]))
+	}
+
+	return tasks
+}
+
+// SearchTasks returns the tasks whose text has every word of query, best first,
+// at most limit of them (0 for all); see taskstore.TextIndex.
+func (ts *TaskStore) SearchTasks(query string, limit int) ([]*model.SearchResult, error) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	hits, err := ts.text.Search(query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	results := make([]*model.SearchResult, 0, len(hits))
+
+	for _, hit := range hits {
+		task := copyTask(ts.tasks[hit.ID])
+		results = append(results, &model.SearchResult{Task: task, Score: hit.Score, Snippet: taskstore.Snippet(task.Text, query)})
+	}
+
+	return results, nil
+}
@@ -1,19 +1,38 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"net/http"
 
 	"github.com/gorilla/mux"
 
+	"github.com/shien/restserver/auth/taskstore-auth/middleware"
 	"github.com/shien/restserver/router/taskserver"
+	"github.com/shien/restserver/taskstore/backend"
 )
 
 // Routing rules are not hardcoded any more, just use 3rd-party router package to handle it for us
 // We just need to provide the handler functions to the routings
 func main() {
+	policyFile := middleware.RegisterPolicyFlag()
+	storeFlags := backend.RegisterFlags()
+	flag.Parse()
+
+	store, err := storeFlags.Open()
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	auth, err := middleware.LoadAuthorization(*policyFile)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	router := mux.NewRouter()
-	server := taskserver.NewTaskServerForRouter()
+	server := taskserver.NewTaskServerForRouter(store)
 
 	// By tacking a Methods call onto a route, we can easily direct different methods
 	// on the same path to different handlers.
@@ -23,10 +42,29 @@ func main() {
 
 	router.HandleFunc("/task/{id:[0-9]+}", server.GetTaskHandler).Methods("GET")
 	router.HandleFunc("/task/{id:[0-9]+}", server.DeleteTaskHandler).Methods("DELETE")
+	router.HandleFunc("/task/{id:[0-9]+}", server.UpdateTaskHandler).Methods("PUT")
+	router.HandleFunc("/task/{id:[0-9]+}", server.PatchTaskHandler).Methods("PATCH")
+	router.HandleFunc("/task/{id:[0-9]+}/complete", server.CompleteTaskHandler).Methods("POST")
+	router.HandleFunc("/task/{id:[0-9]+}/reopen", server.ReopenTaskHandler).Methods("POST")
+	router.HandleFunc("/task/{id:[0-9]+}/history", server.GetHistoryHandler).Methods("GET")
+	router.HandleFunc("/task/{id:[0-9]+}/revert", server.RevertTaskHandler).Methods("POST")
 
 	router.HandleFunc("/tag/{tag}", server.TagHandler).Methods("GET")
 
 	router.HandleFunc("/due/{year:[0-9]+}/{month:[0-9]+}/{day:[0-9]+}", server.DueHandler).Methods("GET")
+	router.HandleFunc("/due/", server.DueRangeHandler).Methods("GET")
+	router.HandleFunc("/overdue/", server.OverdueHandler).Methods("GET")
+	router.HandleFunc("/search/", server.SearchHandler).Methods("GET")
+
+	router.HandleFunc("/trash/", server.GetTrashHandler).Methods("GET")
+	router.HandleFunc("/trash/{id:[0-9]+}/restore", server.RestoreTaskHandler).Methods("POST")
+
+	// changes pushed and commands taken over one connection, for signed in users
+	router.Handle("/ws", middleware.BasicAuth(http.HandlerFunc(server.WebSocketHandler))).Methods("GET")
+
+	if auth != nil {
+		router.Use(auth.Handler)
+	}
 
 	const PORT = "9090"
 
@@ -0,0 +1,409 @@
+package taskserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/shien/restserver/stdlib-REST-server/taskserver"
+	"github.com/shien/restserver/taskstore"
+)
+
+const (
+	wsWriteWait  = 10 * time.Second    // how long a client may take to accept a message
+	wsPongWait   = 60 * time.Second    // how long a client may go without answering a ping
+	wsPingPeriod = wsPongWait * 9 / 10 // how often the server pings
+	wsMaxMessage = 64 << 10            // largest message a client may send
+	wsSendQueue  = 64                  // messages queued for a client before the server stops reading from it
+)
+
+var upgrader = websocket.Upgrader{ReadBufferSize: 4096, WriteBufferSize: 4096}
+
+// WSMessage is the envelope of every message on /ws, both ways. Commands of the client
+// carry an ID of its choosing that comes back on their reply: a result, or an error.
+type WSMessage struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Error   *WSError        `json:"error,omitempty"`
+}
+
+// WSError is what went wrong with a command, with the HTTP status code it would have got
+type WSError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+// Types of WSMessage
+const (
+	// from the client
+	wsSubscribe   = "subscribe"   // payload {"after": <seq>, "tag": <tag>}, both optional
+	wsUnsubscribe = "unsubscribe" // stops the events
+	wsCreate      = "create"      // payload {"text", "tags", "due"} as for POST /task/
+	wsDelete      = "delete"      // payload {"id": <id>, "version": <version>}, version optional
+
+	// from the server
+	wsResult = "result" // the reply to a command that went through
+	wsError  = "error"  // the reply to a command that failed, or to a message that is no command
+	wsEvent  = "event"  // payload a taskstore.Event
+	wsReset  = "reset"  // payload {"after": <seq>, "error": <why>}; events were lost, read the tasks again
+)
+
+// wsConn is one client of /ws: the handler goroutine reads its commands, another one
+// writes to it and a third, while subscribed, pumps the events of the feed.
+type wsConn struct {
+	ts      *TaskServerForRouter
+	watcher taskstore.Watcher
+	conn    *websocket.Conn
+
+	ctx    context.Context // done once the connection is going away
+	cancel context.CancelFunc
+	out    chan WSMessage
+
+	// only used by the reading goroutine
+	unsubscribe context.CancelFunc // stops the event pump
+	pumped      chan struct{}      // closed once the event pump returned
+}
+
+// WebSocketHandler serves /ws, where a client subscribes to the task changes and sends
+// create and delete commands, all as WSMessage JSON text messages. A client that doesn't
+// take its messages in time stops having its commands read, and is sent a reset when it
+// has fallen too far behind on events; one that doesn't answer pings is disconnected.
+func (ts *TaskServerForRouter) WebSocketHandler(rsp http.ResponseWriter, req *http.Request) {
+	log.Printf("Handling web socket at %s\n", req.URL.Path)
+
+	watcher, ok := ts.Datastore.(taskstore.Watcher)
+
+	if !ok {
+		http.Error(rsp, "the task store does not publish its changes", http.StatusNotImplemented)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(rsp, req, nil)
+
+	if err != nil {
+		return // the upgrader answered the client already
+	}
+
+	// keeps the author the authentication middleware put in the request context
+	ctx, cancel := context.WithCancel(req.Context())
+
+	c := &wsConn{ts: ts, watcher: watcher, conn: conn, ctx: ctx, cancel: cancel, out: make(chan WSMessage, wsSendQueue)}
+	written := make(chan struct{})
+
+	go func() {
+		c.writeLoop()
+		close(written)
+	}()
+
+	c.readLoop()
+	cancel()
+	<-written
+}
+
+// send queues msg for the client, waiting while the queue is full; false once the
+// connection is going away
+func (c *wsConn) send(msg WSMessage) bool {
+	select {
+	case c.out <- msg:
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
+}
+
+// sendEvent is send for the event pump, which stops sending once ctx is done
+func (c *wsConn) sendEvent(ctx context.Context, msg WSMessage) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	select {
+	case c.out <- msg:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (c *wsConn) writeLoop() {
+	ping := time.NewTicker(wsPingPeriod)
+
+	defer func() {
+		ping.Stop()
+		c.cancel()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case msg := <-c.out:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+
+			if err := c.conn.WriteJSON(msg); err != nil {
+				return
+			}
+
+		case <-ping.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+
+		case <-c.ctx.Done():
+			c.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(wsWriteWait))
+			return
+		}
+	}
+}
+
+func (c *wsConn) readLoop() {
+	defer c.stopEvents()
+
+	c.conn.SetReadLimit(wsMaxMessage)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("web socket: %v", err)
+			}
+
+			return
+		}
+
+		var msg WSMessage
+
+		if err := json.Unmarshal(data, &msg); err != nil {
+			if !c.send(errorMessage("", http.StatusBadRequest, fmt.Errorf("expect a JSON message: %w", err))) {
+				return
+			}
+
+			continue
+		}
+
+		if !c.handle(msg) {
+			return
+		}
+	}
+}
+
+// handle runs a command of the client and sends its reply; false once the connection is
+// going away
+func (c *wsConn) handle(msg WSMessage) bool {
+	var result interface{}
+	var status int
+	var err error
+
+	switch msg.Type {
+	case wsSubscribe:
+		return c.subscribe(msg)
+	case wsUnsubscribe:
+		c.stopEvents()
+	case wsCreate:
+		result, status, err = c.create(msg.Payload)
+	case wsDelete:
+		status, err = c.delete(msg.Payload)
+	default:
+		status, err = http.StatusBadRequest, fmt.Errorf("unknown message type %q, expect one of %s, %s, %s or %s",
+			msg.Type, wsSubscribe, wsUnsubscribe, wsCreate, wsDelete)
+	}
+
+	return c.send(replyMessage(msg.ID, result, status, err))
+}
+
+func replyMessage(id string, result interface{}, status int, err error) WSMessage {
+	if err != nil {
+		return errorMessage(id, status, err)
+	}
+
+	reply := WSMessage{Type: wsResult, ID: id}
+
+	if result != nil {
+		reply.Payload, _ = json.Marshal(result)
+	}
+
+	return reply
+}
+
+func errorMessage(id string, status int, err error) WSMessage {
+	return WSMessage{Type: wsError, ID: id, Error: &WSError{Status: status, Message: err.Error()}}
+}
+
+// decodePayload decodes the payload of a command into v; a missing payload leaves v as is
+func decodePayload(payload json.RawMessage, v interface{}) error {
+	if len(payload) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(payload, v); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+
+	return nil
+}
+
+// subscribe starts pumping the events after the sequence number asked for, instead of
+// those of any earlier subscription; the reply, sent before the events, has the sequence
+// number they start after.
+func (c *wsConn) subscribe(msg WSMessage) bool {
+	var request struct {
+		After uint64 `json:"after"`
+		Tag   string `json:"tag"`
+	}
+
+	if err := decodePayload(msg.Payload, &request); err != nil {
+		return c.send(errorMessage(msg.ID, http.StatusBadRequest, err))
+	}
+
+	// no event of the earlier subscription may follow the reply
+	c.stopEvents()
+
+	var keep func(taskstore.Event) bool
+
+	if tag := request.Tag; tag != "" {
+		keep = func(event taskstore.Event) bool { return event.Task.HasTag(tag) }
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	sub, lost, err := taskserver.ResumeEvents(ctx, c.watcher, request.After, keep)
+
+	if err != nil {
+		cancel()
+		return c.send(errorMessage(msg.ID, taskserver.StatusForStoreError(err), err))
+	}
+
+	if (lost != nil && !c.send(resetMessage(sub.After(), lost))) ||
+		!c.send(replyMessage(msg.ID, map[string]uint64{"after": sub.After()}, http.StatusOK, nil)) {
+		cancel()
+		sub.Close()
+		return false
+	}
+
+	pumped := make(chan struct{})
+	c.unsubscribe, c.pumped = cancel, pumped
+
+	go func() {
+		c.pump(ctx, sub, keep)
+		close(pumped)
+	}()
+
+	return true
+}
+
+// stopEvents stops the event pump, if any, and waits for it to return
+func (c *wsConn) stopEvents() {
+	if c.unsubscribe == nil {
+		return
+	}
+
+	c.unsubscribe()
+	<-c.pumped
+	c.unsubscribe, c.pumped = nil, nil
+}
+
+func resetMessage(after uint64, lost error) WSMessage {
+	payload, _ := json.Marshal(map[string]interface{}{"after": after, "error": lost.Error()})
+
+	return WSMessage{Type: wsReset, Payload: payload}
+}
+
+// pump sends the events of sub, which keeps those keep returns true for, until ctx is
+// done. While the client is slow its queue fills up and the feed drops the subscription;
+// the pump then resumes after the last event sent, or resets the client when it can't.
+func (c *wsConn) pump(ctx context.Context, sub *taskstore.Subscription, keep func(taskstore.Event) bool) {
+	defer func() { sub.Close() }()
+
+	last := sub.After()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case event, ok := <-sub.Events():
+			if !ok {
+				if ctx.Err() != nil {
+					return
+				}
+
+				var lost, err error
+
+				if sub, lost, err = taskserver.ResumeEvents(ctx, c.watcher, last, keep); err != nil {
+					return
+				}
+
+				if lost != nil {
+					last = sub.After()
+
+					if !c.sendEvent(ctx, resetMessage(last, lost)) {
+						return
+					}
+				}
+
+				continue
+			}
+
+			last = event.Seq
+			payload, err := json.Marshal(event)
+
+			if err != nil {
+				return
+			}
+
+			if !c.sendEvent(ctx, WSMessage{Type: wsEvent, Payload: payload}) {
+				return
+			}
+		}
+	}
+}
+
+func (c *wsConn) create(payload json.RawMessage) (interface{}, int, error) {
+	var request struct {
+		Text string    `json:"text"`
+		Tags []string  `json:"tags"`
+		Due  time.Time `json:"due"`
+	}
+
+	if err := decodePayload(payload, &request); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	id, err := c.ts.Datastore.CreateTask(c.ctx, request.Text, request.Tags, request.Due)
+
+	if err != nil {
+		return nil, taskserver.StatusForStoreError(err), err
+	}
+
+	return map[string]int{"id": id}, http.StatusOK, nil
+}
+
+func (c *wsConn) delete(payload json.RawMessage) (int, error) {
+	var request struct {
+		ID      *int `json:"id"`
+		Version int  `json:"version"`
+	}
+
+	if err := decodePayload(payload, &request); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if request.ID == nil {
+		return http.StatusBadRequest, fmt.Errorf("expect the id of the task to delete")
+	}
+
+	if err := c.ts.Datastore.DeleteTask(c.ctx, *request.ID, request.Version); err != nil {
+		return taskserver.StatusForStoreError(err), err
+	}
+
+	return http.StatusOK, nil
+}
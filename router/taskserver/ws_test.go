@@ -0,0 +1,277 @@
+package taskserver
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/shien/restserver/auth/taskstore-auth/middleware"
+	"github.com/shien/restserver/taskstore"
+)
+
+// dialWS starts /ws behind BasicAuth, as the router server serves it, on a store
+// publishing its changes, and signs in to it
+func dialWS(t *testing.T, opts taskstore.FeedOptions) (*taskstore.Feed, *websocket.Conn) {
+	t.Helper()
+
+	feed := taskstore.NewFeed(taskstore.New(), opts)
+	server := httptest.NewServer(middleware.BasicAuth(http.HandlerFunc(NewTaskServerForRouter(feed).WebSocketHandler)))
+	t.Cleanup(server.Close)
+
+	header := http.Header{}
+	header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("shien:1234")))
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(server), header)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	return feed, conn
+}
+
+func wsURL(server *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+}
+
+func sendWS(t *testing.T, conn *websocket.Conn, typ, id, payload string) {
+	t.Helper()
+
+	if err := conn.WriteJSON(WSMessage{Type: typ, ID: id, Payload: json.RawMessage(payload)}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readWS(t *testing.T, conn *websocket.Conn) WSMessage {
+	t.Helper()
+
+	var msg WSMessage
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+
+	return msg
+}
+
+// readEvent reads the next message, which must be an event
+func readEvent(t *testing.T, conn *websocket.Conn) taskstore.Event {
+	t.Helper()
+
+	msg := readWS(t, conn)
+
+	if msg.Type != wsEvent {
+		t.Fatalf("got %+v, want an event", msg)
+	}
+
+	var event taskstore.Event
+
+	if err := json.Unmarshal(msg.Payload, &event); err != nil {
+		t.Fatal(err)
+	}
+
+	return event
+}
+
+func TestWebSocketCommands(t *testing.T) {
+	_, conn := dialWS(t, taskstore.DefaultFeedOptions)
+
+	tests := []struct {
+		typ, id, payload string
+		reply            string
+		status           int
+		result           string
+	}{
+		{wsCreate, "c1", `{"text": "buy milk", "tags": ["home"]}`, wsResult, 0, `{"id":0}`},
+		{wsCreate, "c2", `{"text": 1}`, wsError, http.StatusBadRequest, ""},
+		{wsDelete, "d1", `{"id": 0, "version": 2}`, wsError, http.StatusPreconditionFailed, ""},
+		{wsDelete, "d2", `{"id": 0}`, wsResult, 0, ""},
+		{wsDelete, "d3", `{"id": 0}`, wsError, http.StatusNotFound, ""},
+		{wsDelete, "d4", `{}`, wsError, http.StatusBadRequest, ""},
+		{"update", "u1", `{}`, wsError, http.StatusBadRequest, ""},
+	}
+
+	for _, test := range tests {
+		sendWS(t, conn, test.typ, test.id, test.payload)
+		reply := readWS(t, conn)
+
+		// every reply comes back with the id of its command
+		if reply.Type != test.reply || reply.ID != test.id || string(reply.Payload) != test.result {
+			t.Errorf("%s %s: reply %+v, want %s with payload %s", test.typ, test.payload, reply, test.reply, test.result)
+		}
+
+		if test.status != 0 && (reply.Error == nil || reply.Error.Status != test.status) {
+			t.Errorf("%s %s: error %+v, want status %d", test.typ, test.payload, reply.Error, test.status)
+		}
+	}
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("not JSON")); err != nil {
+		t.Fatal(err)
+	}
+
+	if reply := readWS(t, conn); reply.Type != wsError || reply.Error == nil || reply.Error.Status != http.StatusBadRequest {
+		t.Errorf("reply to a message that is no JSON = %+v", reply)
+	}
+}
+
+func TestWebSocketSubscribe(t *testing.T) {
+	feed, conn := dialWS(t, taskstore.DefaultFeedOptions)
+	ctx := context.Background()
+
+	sendWS(t, conn, wsSubscribe, "s1", `{"tag": "work"}`)
+
+	if reply := readWS(t, conn); reply.Type != wsResult || reply.ID != "s1" || !strings.Contains(string(reply.Payload), `"after":`) {
+		t.Fatalf("reply to subscribe = %+v", reply)
+	}
+
+	for _, tag := range []string{"home", "work"} {
+		if _, err := feed.CreateTask(ctx, "a task at "+tag, []string{tag}, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if event := readEvent(t, conn); event.Type != taskstore.EventCreated || event.Task.Text != "a task at work" {
+		t.Errorf("event = %+v, want the task at work only", event)
+	}
+
+	// the subscription for work ends before the reply to the one for home
+	sendWS(t, conn, wsSubscribe, "s2", `{"tag": "home"}`)
+
+	if reply := readWS(t, conn); reply.Type != wsResult || reply.ID != "s2" {
+		t.Fatalf("reply to the second subscribe = %+v", reply)
+	}
+
+	for _, tag := range []string{"work", "home"} {
+		if _, err := feed.CreateTask(ctx, "another task at "+tag, []string{tag}, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if event := readEvent(t, conn); event.Task.Text != "another task at home" {
+		t.Errorf("event after subscribing anew = %+v, want the task at home only", event)
+	}
+
+	// commands go on while subscribed, their events arrive with their replies
+	sendWS(t, conn, wsCreate, "c1", `{"text": "through the socket", "tags": ["home"]}`)
+	got := map[string]bool{}
+
+	for i := 0; i < 2; i++ {
+		got[readWS(t, conn).Type] = true
+	}
+
+	if !got[wsResult] || !got[wsEvent] {
+		t.Errorf("messages after a create while subscribed = %v, want a result and an event", got)
+	}
+
+	sendWS(t, conn, wsUnsubscribe, "u1", "")
+
+	if reply := readWS(t, conn); reply.Type != wsResult || reply.ID != "u1" {
+		t.Fatalf("reply to unsubscribe = %+v", reply)
+	}
+
+	if _, err := feed.CreateTask(ctx, "unseen", []string{"home"}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	sendWS(t, conn, "ping", "p1", "")
+
+	if reply := readWS(t, conn); reply.ID != "p1" {
+		t.Errorf("after unsubscribing got %+v, want the reply to p1", reply)
+	}
+}
+
+func TestWebSocketNeedsSignIn(t *testing.T) {
+	server := httptest.NewServer(middleware.BasicAuth(http.HandlerFunc(NewTaskServerForRouter(taskstore.NewFeed(taskstore.New(), taskstore.DefaultFeedOptions)).WebSocketHandler)))
+	defer server.Close()
+
+	conn, rsp, err := websocket.DefaultDialer.Dial(wsURL(server), nil)
+
+	if err == nil {
+		conn.Close()
+		t.Fatal("dialed /ws without signing in")
+	}
+
+	if rsp == nil || rsp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("dialing without signing in: %v, response %v; want 401", err, rsp)
+	}
+}
+
+func TestWebSocketSlowClientIsReset(t *testing.T) {
+	feed, conn := dialWS(t, taskstore.FeedOptions{Backlog: 1, Buffer: 1})
+	ctx := context.Background()
+
+	sendWS(t, conn, wsSubscribe, "s1", "")
+
+	if reply := readWS(t, conn); reply.Type != wsResult {
+		t.Fatalf("reply to subscribe = %+v", reply)
+	}
+
+	// far more events than the send queue and the socket buffers hold, all published
+	// while the client reads nothing
+	text := strings.Repeat("x", 64<<10)
+	const tasks = 300
+
+	for i := 0; i < tasks; i++ {
+		if _, err := feed.CreateTask(ctx, text, nil, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the client catches up with the latest event through resets
+	final := feed.Seq()
+	resets := 0
+
+	for caught := false; !caught; {
+		msg := readWS(t, conn)
+
+		switch msg.Type {
+		case wsReset:
+			var reset struct {
+				After uint64 `json:"after"`
+			}
+
+			if err := json.Unmarshal(msg.Payload, &reset); err != nil {
+				t.Fatal(err)
+			}
+
+			resets++
+			caught = reset.After == final
+
+		case wsEvent:
+			var event taskstore.Event
+
+			if err := json.Unmarshal(msg.Payload, &event); err != nil {
+				t.Fatal(err)
+			}
+
+			caught = event.Seq == final
+
+		default:
+			t.Fatalf("got %+v, want an event or a reset", msg)
+		}
+	}
+
+	if resets == 0 {
+		t.Fatal("got every event, no reset")
+	}
+
+	// and the events go on from there
+	if _, err := feed.CreateTask(ctx, "after the reset", nil, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	if event := readEvent(t, conn); event.Task.Text != "after the reset" {
+		t.Errorf("event after catching up = %+v", event)
+	}
+}
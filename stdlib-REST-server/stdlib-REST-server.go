@@ -1,28 +1,62 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
 	"net/http"
 	"time"
 
+	authmiddleware "github.com/shien/restserver/auth/taskstore-auth/middleware"
 	"github.com/shien/restserver/stdlib-REST-server/middleware"
 	"github.com/shien/restserver/stdlib-REST-server/taskserver"
+	"github.com/shien/restserver/taskstore/backend"
 )
 
 func main() {
+	policyFile := authmiddleware.RegisterPolicyFlag()
+	storeFlags := backend.RegisterFlags()
+	flag.Parse()
+
+	store, err := storeFlags.Open()
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	auth, err := authmiddleware.LoadAuthorization(*policyFile)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	mux := http.NewServeMux()
-	server := taskserver.NewTaskServer()
+	server := taskserver.NewTaskServer(store)
 
 	mux.HandleFunc("/task/", server.TaskHandler)
 	mux.HandleFunc("/tag/", server.TagHandler)
 	mux.HandleFunc("/due/", server.DueHandler)
+	mux.HandleFunc("/overdue/", server.OverdueHandler)
+	mux.HandleFunc("/search/", server.SearchHandler)
+	mux.HandleFunc("/trash/", server.TrashHandler)
+	mux.HandleFunc("/events/", server.EventsHandler)
+	mux.HandleFunc("/sync/", server.SyncHandler)
 
-	tags := []string{"BBBB", "BBBB"}
-	server.Datastore.CreateTask("AAAAAAA", tags, time.Now())
+	// only seed the in-memory store, a durable one would get a new copy on every restart
+	if storeFlags.DataDir == "" {
+		tags := []string{"BBBB", "BBBB"}
+		server.Datastore.CreateTask(context.Background(), "AAAAAAA", tags, time.Now())
+	}
 
 	const PORT = "9090"
 
-	handler := middleware.Loggin(mux)
+	var handler http.Handler = mux
+
+	if auth != nil {
+		handler = auth.Handler(handler)
+	}
+
+	handler = middleware.Loggin(handler)
 	handler = middleware.PanicRecover(handler)
 
 	log.Println("REST Server starting to listen on " + "localhost:" + PORT)
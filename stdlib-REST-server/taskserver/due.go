@@ -0,0 +1,111 @@
+package taskserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+// ParseTimeParam parses a time given in a query parameter: an RFC 3339 timestamp,
+// or a date (YYYY-MM-DD) which stands for its midnight in loc, UTC when loc is nil.
+func ParseTimeParam(name, value string, loc *time.Location) (time.Time, error) {
+	// an unescaped "+01:00" offset reaches us as " 01:00"
+	value = strings.Replace(value, " ", "+", 1)
+
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", value, loc); err == nil {
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("expect %s as an RFC 3339 time or a YYYY-MM-DD date, got %q", name, value)
+}
+
+// DueRange parses the from and to query parameters of GET /due/; either may be left out
+// to leave that end of the range open. Dates are taken in DueZone. include_from and
+// include_to tell whether the range holds from and to themselves, by default it is [from, to).
+func DueRange(req *http.Request) (time.Time, time.Time, taskstore.Bounds, error) {
+	var times [2]time.Time
+
+	loc, err := DueZone(req)
+
+	if err != nil {
+		return time.Time{}, time.Time{}, taskstore.Bounds{}, err
+	}
+
+	for i, name := range []string{"from", "to"} {
+		value := req.URL.Query().Get(name)
+
+		if value == "" {
+			continue
+		}
+
+		t, err := ParseTimeParam(name, value, loc)
+
+		if err != nil {
+			return time.Time{}, time.Time{}, taskstore.Bounds{}, err
+		}
+
+		times[i] = t
+	}
+
+	from, to := times[0], times[1]
+
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return time.Time{}, time.Time{}, taskstore.Bounds{}, fmt.Errorf("expect from before to, got from %s and to %s",
+			from.Format(time.RFC3339Nano), to.Format(time.RFC3339Nano))
+	}
+
+	bounds := taskstore.HalfOpen
+
+	for _, param := range []struct {
+		name    string
+		include *bool
+	}{{"include_from", &bounds.IncludeFrom}, {"include_to", &bounds.IncludeTo}} {
+		value := req.URL.Query().Get(param.name)
+
+		if value == "" {
+			continue
+		}
+
+		include, err := strconv.ParseBool(value)
+
+		if err != nil {
+			return time.Time{}, time.Time{}, taskstore.Bounds{}, fmt.Errorf("expect %s as true or false, got %q", param.name, value)
+		}
+
+		*param.include = include
+	}
+
+	return from, to, bounds, nil
+}
+
+// ListTasksDue answers GET /due/?from=<time>&to=<time>: the tasks due in [from, to),
+// or with include_from=false and include_to=true, in (from, to] and so on, ordered
+// by due time. On failure it returns the HTTP status code to answer with.
+func ListTasksDue(ctx context.Context, store taskstore.Store, req *http.Request) ([]taskstore.Task, int, error) {
+	from, to, bounds, err := DueRange(req)
+
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	tasks, err := store.GetTaskByDueRange(ctx, from, to, bounds)
+
+	if err != nil {
+		return nil, StatusForStoreError(err), err
+	}
+
+	return tasks, http.StatusOK, nil
+}
@@ -0,0 +1,200 @@
+package taskserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+// newDueServer returns a server with tasks due around the New York DST changes of 2021
+func newDueServer(t *testing.T) (*TaskServer, map[string]int) {
+	est := time.FixedZone("EST", -5*60*60)
+	edt := time.FixedZone("EDT", -4*60*60)
+
+	dues := map[string]time.Time{
+		"before spring": time.Date(2021, time.March, 13, 23, 30, 0, 0, est),
+		"after jump":    time.Date(2021, time.March, 14, 3, 30, 0, 0, edt),
+		"spring late":   time.Date(2021, time.March, 15, 3, 30, 0, 0, time.UTC), // 23:30 EDT
+		"second 01:30":  time.Date(2021, time.November, 7, 1, 30, 0, 0, est),
+		"fall late":     time.Date(2021, time.November, 7, 23, 30, 0, 0, est),
+		"after fall":    time.Date(2021, time.November, 8, 0, 0, 0, 0, est),
+	}
+
+	server := NewTaskServer(taskstore.New())
+	ids := make(map[string]int)
+
+	for text, due := range dues {
+		id, err := server.Datastore.CreateTask(context.Background(), text, nil, due)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids[text] = id
+	}
+
+	return server, ids
+}
+
+// getDue runs req on the DueHandler and returns the status and the ids answered
+func getDue(t *testing.T, server *TaskServer, req *http.Request) (int, []int) {
+	rsp := httptest.NewRecorder()
+	server.DueHandler(rsp, req)
+
+	if rsp.Code != http.StatusOK {
+		return rsp.Code, nil
+	}
+
+	var tasks []taskstore.Task
+
+	if err := json.Unmarshal(rsp.Body.Bytes(), &tasks); err != nil {
+		t.Fatalf("GET %s: %v", req.URL, err)
+	}
+
+	ids := make([]int, 0, len(tasks))
+
+	for _, task := range tasks {
+		ids = append(ids, task.ID)
+	}
+
+	return rsp.Code, ids
+}
+
+func TestDueRangeBounds(t *testing.T) {
+	server := NewTaskServer(taskstore.New())
+	ids := make(map[string]int)
+
+	for text, due := range map[string]time.Time{
+		"at from": time.Date(2021, time.August, 1, 0, 0, 0, 0, time.UTC),
+		"between": time.Date(2021, time.August, 4, 12, 0, 0, 0, time.UTC),
+		"at to":   time.Date(2021, time.August, 8, 2, 0, 0, 0, time.FixedZone("CEST", 2*60*60)),
+	} {
+		id, err := server.Datastore.CreateTask(context.Background(), text, nil, due)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids[text] = id
+	}
+
+	tests := []struct {
+		query  string
+		status int
+		want   []string // in due order
+	}{
+		{"from=2021-08-01&to=2021-08-08", http.StatusOK, []string{"at from", "between"}},
+		{"from=2021-08-01&to=2021-08-08&include_from=true&include_to=false", http.StatusOK, []string{"at from", "between"}},
+		{"from=2021-08-01&to=2021-08-08&include_to=true", http.StatusOK, []string{"at from", "between", "at to"}},
+		{"from=2021-08-01&to=2021-08-08&include_from=false", http.StatusOK, []string{"between"}},
+		{"from=2021-08-01&to=2021-08-08&include_from=0&include_to=1", http.StatusOK, []string{"between", "at to"}},
+		{"from=2021-08-01&to=2021-08-01&include_to=true", http.StatusOK, []string{"at from"}},
+		{"from=2021-08-01&to=2021-08-01", http.StatusOK, nil},
+		{"to=2021-08-01&include_to=true", http.StatusOK, []string{"at from"}},
+		{"from=2021-08-01&include_to=maybe", http.StatusBadRequest, nil},
+		{"from=2021-08-01&include_from=", http.StatusOK, []string{"at from", "between", "at to"}},
+	}
+
+	for _, test := range tests {
+		status, got := getDue(t, server, httptest.NewRequest(http.MethodGet, "/due/?"+test.query, nil))
+
+		if status != test.status {
+			t.Errorf("GET /due/?%s: status %d, want %d", test.query, status, test.status)
+			continue
+		}
+
+		want := make([]int, 0, len(test.want))
+
+		for _, text := range test.want {
+			want = append(want, ids[text])
+		}
+
+		if !equalIDs(got, want) {
+			t.Errorf("GET /due/?%s = %v, want %v %v", test.query, got, want, test.want)
+		}
+	}
+}
+
+func TestDueInZoneAcrossDST(t *testing.T) {
+	server, ids := newDueServer(t)
+
+	tests := []struct {
+		target string
+		want   []string // in due order
+	}{
+		// springs forward: a 23 hour day
+		{"/due/2021/03/14?tz=America/New_York", []string{"after jump", "spring late"}},
+		{"/due/2021/03/13?tz=America/New_York", []string{"before spring"}},
+		{"/due/2021/03/14?tz=UTC", []string{"before spring", "after jump"}},
+		// falls back: a 25 hour day
+		{"/due/2021/11/07?tz=America/New_York", []string{"second 01:30", "fall late"}},
+		{"/due/?from=2021-11-07&to=2021-11-08&tz=America/New_York", []string{"second 01:30", "fall late"}},
+		{"/due/?from=2021-03-14&to=2021-03-15&tz=America/New_York", []string{"after jump", "spring late"}},
+	}
+
+	for _, test := range tests {
+		status, got := getDue(t, server, httptest.NewRequest(http.MethodGet, test.target, nil))
+
+		if status != http.StatusOK {
+			t.Errorf("GET %s: status %d, want 200", test.target, status)
+			continue
+		}
+
+		want := make([]int, 0, len(test.want))
+
+		for _, text := range test.want {
+			want = append(want, ids[text])
+		}
+
+		if !equalIDs(got, want) {
+			t.Errorf("GET %s = %v, want %v %v", test.target, got, want, test.want)
+		}
+	}
+}
+
+func TestDueDefaultZone(t *testing.T) {
+	server, ids := newDueServer(t)
+	ny, err := time.LoadLocation("America/New_York")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/due/2021/03/14", nil)
+	req = req.WithContext(taskstore.WithDefaultZone(req.Context(), ny))
+
+	if _, got := getDue(t, server, req); !equalIDs(got, []int{ids["after jump"], ids["spring late"]}) {
+		t.Errorf("GET /due/2021/03/14 in the default zone New York = %v", got)
+	}
+
+	// tz wins over the default zone
+	req = httptest.NewRequest(http.MethodGet, "/due/2021/03/14?tz=UTC", nil)
+	req = req.WithContext(taskstore.WithDefaultZone(req.Context(), ny))
+
+	if _, got := getDue(t, server, req); !equalIDs(got, []int{ids["before spring"], ids["after jump"]}) {
+		t.Errorf("GET /due/2021/03/14?tz=UTC in the default zone New York = %v", got)
+	}
+
+	if status, _ := getDue(t, server, httptest.NewRequest(http.MethodGet, "/due/2021/03/14?tz=Mars/Olympus", nil)); status != http.StatusBadRequest {
+		t.Errorf("GET /due/2021/03/14?tz=Mars/Olympus: status %d, want 400", status)
+	}
+}
+
+func equalIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,93 @@
+package taskserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+// ETag returns the strong entity tag of a task, derived from its version
+func ETag(task taskstore.Task) string {
+	return fmt.Sprintf(`"%d"`, task.Version)
+}
+
+// NotModified reports whether the If-None-Match header of a GET request says the client
+// already has this version of the task, in which case the answer is 304 Not Modified.
+func NotModified(req *http.Request, task taskstore.Task) bool {
+	header := req.Header.Get("If-None-Match")
+
+	// If-None-Match uses the weak comparison: W/"3" matches "3"
+	return header != "" && matchETag(header, ETag(task), true)
+}
+
+// ExpectedVersion turns the If-Match header of a mutating request on the task id into the
+// version to hand to Store.UpdateTask or Store.DeleteTask; it is 0, any version, without
+// If-Match. On failure it returns the HTTP status code to answer with: 404 when the task
+// does not exist, 412 Precondition Failed when it is at another version.
+func ExpectedVersion(ctx context.Context, store taskstore.Store, id int, req *http.Request) (int, int, error) {
+	header := req.Header.Get("If-Match")
+
+	if header == "" {
+		return 0, http.StatusOK, nil
+	}
+
+	task, err := store.GetTask(ctx, id)
+
+	if err != nil {
+		return 0, StatusForStoreError(err), err
+	}
+
+	version, err := ifMatchVersion(req, task)
+
+	if err != nil {
+		return 0, http.StatusPreconditionFailed, err
+	}
+
+	return version, http.StatusOK, nil
+}
+
+// ifMatchVersion checks the If-Match header of req against task and returns the version
+// it pins the request to, 0 without If-Match.
+func ifMatchVersion(req *http.Request, task taskstore.Task) (int, error) {
+	header := req.Header.Get("If-Match")
+
+	if header == "" {
+		return 0, nil
+	}
+
+	// If-Match uses the strong comparison, a weak tag never matches
+	if !matchETag(header, ETag(task), false) {
+		return 0, fmt.Errorf("task with id = %d has ETag %s, If-Match asks for %s", task.ID, ETag(task), header)
+	}
+
+	return task.Version, nil
+}
+
+// matchETag reports whether the comma separated list of entity tags in header,
+// or "*", matches etag.
+func matchETag(header, etag string, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,121 @@
+package taskserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// serveConditional runs a request with a conditional header on the TaskHandler
+func serveConditional(server *TaskServer, method, target, header, value string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+
+	switch method {
+	case http.MethodPut:
+		req = httptest.NewRequest(method, target, strings.NewReader(`{"text": "buy bread"}`))
+		req.Header.Set("Content-Type", "application/json")
+	case http.MethodPatch:
+		req = httptest.NewRequest(method, target, strings.NewReader(`{"text": "buy bread"}`))
+		req.Header.Set("Content-Type", MergePatchType)
+	}
+
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+
+	rsp := httptest.NewRecorder()
+	server.TaskHandler(rsp, req)
+
+	return rsp
+}
+
+func TestGetETag(t *testing.T) {
+	server, id := newPatchServer(t)
+	target := "/task/" + strconv.Itoa(id)
+
+	rsp := serveConditional(server, http.MethodGet, target, "", "")
+
+	if rsp.Code != http.StatusOK || rsp.Header().Get("ETag") != `"1"` {
+		t.Fatalf("GET %s: status %d, ETag %q; want 200 and \"1\"", target, rsp.Code, rsp.Header().Get("ETag"))
+	}
+
+	tests := []struct {
+		ifNoneMatch string
+		status      int
+	}{
+		{`"1"`, http.StatusNotModified},
+		{`W/"1"`, http.StatusNotModified}, // If-None-Match compares weakly
+		{`"3", "1"`, http.StatusNotModified},
+		{`*`, http.StatusNotModified},
+		{`"2"`, http.StatusOK},
+		{`1`, http.StatusOK}, // not a quoted entity tag
+	}
+
+	for _, test := range tests {
+		rsp := serveConditional(server, http.MethodGet, target, "If-None-Match", test.ifNoneMatch)
+
+		if rsp.Code != test.status {
+			t.Errorf("GET with If-None-Match: %s: status %d, want %d", test.ifNoneMatch, rsp.Code, test.status)
+		}
+
+		if rsp.Code == http.StatusNotModified && (rsp.Body.Len() != 0 || rsp.Header().Get("ETag") != `"1"`) {
+			t.Errorf("GET with If-None-Match: %s: 304 with body %q and ETag %q", test.ifNoneMatch, rsp.Body, rsp.Header().Get("ETag"))
+		}
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	methods := []string{http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+	tests := []struct {
+		ifMatch string
+		status  int
+	}{
+		{`"1"`, http.StatusOK},
+		{`"2", "1"`, http.StatusOK},
+		{`*`, http.StatusOK},
+		{`"2"`, http.StatusPreconditionFailed},
+		{`W/"1"`, http.StatusPreconditionFailed}, // If-Match compares strongly
+	}
+
+	for _, method := range methods {
+		for _, test := range tests {
+			server, id := newPatchServer(t)
+			target := "/task/" + strconv.Itoa(id)
+			rsp := serveConditional(server, method, target, "If-Match", test.ifMatch)
+
+			if rsp.Code != test.status {
+				t.Errorf("%s with If-Match: %s: status %d, want %d: %s", method, test.ifMatch, rsp.Code, test.status, rsp.Body)
+				continue
+			}
+
+			task, err := server.Datastore.GetTask(context.Background(), id)
+
+			switch {
+			case test.status != http.StatusOK:
+				if err != nil || task.Version != 1 {
+					t.Errorf("%s with If-Match: %s changed the task: %+v, %v", method, test.ifMatch, task, err)
+				}
+			case method == http.MethodDelete:
+				if err == nil {
+					t.Errorf("DELETE with If-Match: %s kept the task", test.ifMatch)
+				}
+			default:
+				if rsp.Header().Get("ETag") != `"2"` || err != nil || task.Version != 2 {
+					t.Errorf("%s with If-Match: %s: ETag %q, stored %+v, %v; want version 2", method, test.ifMatch, rsp.Header().Get("ETag"), task, err)
+				}
+			}
+		}
+	}
+
+	server, _ := newPatchServer(t)
+
+	for _, method := range methods {
+		if rsp := serveConditional(server, method, "/task/12345", "If-Match", `"1"`); rsp.Code != http.StatusNotFound {
+			t.Errorf("%s of a missing task with If-Match: status %d, want 404", method, rsp.Code)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package taskserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+// heartbeatInterval is how often GET /events/ writes a comment, so proxies don't close
+// a stream that is idle
+var heartbeatInterval = 15 * time.Second
+
+// EventsHandler serves GET /events/, a Server-Sent Events stream of the task changes.
+// Each event is named after its type (created, updated or deleted), has the feed sequence
+// number as id and a taskstore.Event as JSON data; ?tag=<tag> keeps the events of the
+// tasks with that tag. A client coming back with Last-Event-ID (or ?last_event_id=) gets
+// the events it missed, or a reset event when they are no longer kept, after which it
+// should read the tasks again. The stream ends when the client goes away.
+func (ts *TaskServer) EventsHandler(rsp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(rsp,
+			fmt.Sprintf("Expect method GET at /events/, got %v", req.Method),
+			http.StatusMethodNotAllowed)
+		return
+	}
+
+	watcher, ok := ts.Datastore.(taskstore.Watcher)
+
+	if !ok {
+		http.Error(rsp, "the task store does not publish its changes", http.StatusNotImplemented)
+		return
+	}
+
+	flusher, ok := rsp.(http.Flusher)
+
+	if !ok {
+		http.Error(rsp, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	after, err := lastEventID(req)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var keep func(taskstore.Event) bool
+
+	if tag := req.URL.Query().Get("tag"); tag != "" {
+		keep = func(event taskstore.Event) bool { return event.Task.HasTag(tag) }
+	}
+
+	ctx := req.Context()
+	sub, lost, err := ResumeEvents(ctx, watcher, after, keep)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), StatusForStoreError(err))
+		return
+	}
+
+	defer func() { sub.Close() }()
+
+	header := rsp.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no") // keep nginx from buffering the stream
+	rsp.WriteHeader(http.StatusOK)
+
+	if lost != nil {
+		writeReset(rsp, sub.After(), lost)
+	}
+
+	flusher.Flush()
+
+	last := sub.After()
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(rsp, ": heartbeat\n\n"); err != nil {
+				return
+			}
+
+		case event, ok := <-sub.Events():
+			if !ok {
+				// dropped for falling behind: pick up after the last event seen if the
+				// feed still has what followed it
+				if ctx.Err() != nil {
+					return
+				}
+
+				if sub, lost, err = ResumeEvents(ctx, watcher, last, keep); err != nil {
+					return
+				}
+
+				if lost != nil {
+					last = sub.After()
+					writeReset(rsp, last, lost)
+					flusher.Flush()
+				}
+
+				continue
+			}
+
+			last = event.Seq
+
+			data, err := json.Marshal(event)
+
+			if err != nil {
+				return
+			}
+
+			if _, err := fmt.Fprintf(rsp, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Type, data); err != nil {
+				return
+			}
+		}
+
+		flusher.Flush()
+	}
+}
+
+// lastEventID returns the sequence number a client resumes after, 0 for none
+func lastEventID(req *http.Request) (uint64, error) {
+	value := req.Header.Get("Last-Event-ID")
+
+	if value == "" {
+		value = req.URL.Query().Get("last_event_id")
+	}
+
+	if value == "" {
+		return 0, nil
+	}
+
+	after, err := strconv.ParseUint(value, 10, 64)
+
+	if err != nil {
+		return 0, fmt.Errorf("expect the Last-Event-ID of an event of this stream, got %q", value)
+	}
+
+	return after, nil
+}
+
+// ResumeEvents subscribes to the events keep returns true for after the sequence number
+// after, or from the latest event when the feed no longer has what followed it; lost then
+// says why, and the client should read the tasks again.
+func ResumeEvents(ctx context.Context, watcher taskstore.Watcher, after uint64, keep func(taskstore.Event) bool) (sub *taskstore.Subscription, lost error, err error) {
+	sub, err = watcher.SubscribeFunc(ctx, after, keep)
+
+	if !errors.Is(err, taskstore.ErrEventsLost) {
+		return sub, nil, err
+	}
+
+	lost = err
+	sub, err = watcher.SubscribeFunc(ctx, 0, keep)
+
+	return sub, lost, err
+}
+
+// writeReset tells the client it missed events and should read the tasks again; its id
+// is where the stream picks up.
+func writeReset(rsp http.ResponseWriter, seq uint64, lost error) {
+	data, _ := json.Marshal(map[string]string{"error": lost.Error()})
+
+	fmt.Fprintf(rsp, "id: %d\nevent: reset\ndata: %s\n\n", seq, data)
+}
@@ -0,0 +1,204 @@
+package taskserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+// streamEvents starts GET /events/ on a server for feed and returns the reader of the
+// stream, subscribed once it returns
+func streamEvents(t *testing.T, feed *taskstore.Feed, target, lastEventID string) *bufio.Reader {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(NewTaskServer(feed).EventsHandler))
+	t.Cleanup(server.Close)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+target, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	rsp, err := client.Do(req)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { rsp.Body.Close() })
+
+	if rsp.StatusCode != http.StatusOK || rsp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("GET %s: status %d, Content-Type %q", target, rsp.StatusCode, rsp.Header.Get("Content-Type"))
+	}
+
+	return bufio.NewReader(rsp.Body)
+}
+
+// sseEvent is an event of the stream as written on the wire
+type sseEvent struct {
+	id, event, data string
+}
+
+// readEvent reads the next event of the stream, skipping comments
+func readEvent(t *testing.T, stream *bufio.Reader) sseEvent {
+	t.Helper()
+
+	var event sseEvent
+
+	for {
+		line, err := stream.ReadString('\n')
+
+		if err != nil {
+			t.Fatalf("reading the stream: %v", err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "" && event != sseEvent{}:
+			return event
+		case strings.HasPrefix(line, "id: "):
+			event.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+// decodeEvent decodes the data of an event of a task change
+func decodeEvent(t *testing.T, event sseEvent) taskstore.Event {
+	t.Helper()
+
+	var decoded taskstore.Event
+
+	if err := json.Unmarshal([]byte(event.data), &decoded); err != nil {
+		t.Fatalf("data of %+v: %v", event, err)
+	}
+
+	if event.id != strconv.FormatUint(decoded.Seq, 10) || event.event != string(decoded.Type) {
+		t.Errorf("event %+v framed as id %s, event %s", decoded, event.id, event.event)
+	}
+
+	return decoded
+}
+
+func TestEventsStream(t *testing.T) {
+	ctx := context.Background()
+	feed := taskstore.NewFeed(taskstore.New(), taskstore.DefaultFeedOptions)
+	all := streamEvents(t, feed, "/events/", "")
+	work := streamEvents(t, feed, "/events/?tag=work", "")
+
+	home, err := feed.CreateTask(ctx, "clean up", []string{"home"}, time.Now())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	office, err := feed.CreateTask(ctx, "write the report", []string{"work"}, time.Now())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := feed.DeleteTask(ctx, office, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []struct {
+		typ taskstore.EventType
+		id  int
+	}{{taskstore.EventCreated, home}, {taskstore.EventCreated, office}, {taskstore.EventDeleted, office}} {
+		if event := decodeEvent(t, readEvent(t, all)); event.Type != want.typ || event.Task.ID != want.id {
+			t.Errorf("event %d = %s of task %d, want %s of task %d", i, event.Type, event.Task.ID, want.typ, want.id)
+		}
+	}
+
+	// ?tag=work skips the task at home
+	for i, typ := range []taskstore.EventType{taskstore.EventCreated, taskstore.EventDeleted} {
+		if event := decodeEvent(t, readEvent(t, work)); event.Type != typ || event.Task.ID != office {
+			t.Errorf("tagged event %d = %s of task %d, want %s of task %d", i, event.Type, event.Task.ID, typ, office)
+		}
+	}
+}
+
+func TestEventsResume(t *testing.T) {
+	ctx := context.Background()
+	feed := taskstore.NewFeed(taskstore.New(), taskstore.DefaultFeedOptions)
+
+	if _, err := feed.CreateTask(ctx, "seen", nil, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := feed.Seq()
+
+	if _, err := feed.CreateTask(ctx, "missed", nil, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	stream := streamEvents(t, feed, "/events/", strconv.FormatUint(seen, 10))
+
+	if event := decodeEvent(t, readEvent(t, stream)); event.Seq != seen+1 || event.Task.Text != "missed" {
+		t.Errorf("first event after Last-Event-ID %d = %+v, want the missed task", seen, event)
+	}
+
+	// ?last_event_id= does the same for clients that cannot set headers
+	stream = streamEvents(t, feed, "/events/?last_event_id="+strconv.FormatUint(seen, 10), "")
+
+	if event := decodeEvent(t, readEvent(t, stream)); event.Task.Text != "missed" {
+		t.Errorf("first event after last_event_id=%d = %+v, want the missed task", seen, event)
+	}
+}
+
+func TestEventsReset(t *testing.T) {
+	ctx := context.Background()
+	feed := taskstore.NewFeed(taskstore.New(), taskstore.FeedOptions{Backlog: 1, Buffer: 8})
+	start := feed.Seq()
+
+	for _, text := range []string{"first", "second"} {
+		if _, err := feed.CreateTask(ctx, text, nil, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the first event is no longer kept
+	stream := streamEvents(t, feed, "/events/", strconv.FormatUint(start, 10))
+	reset := readEvent(t, stream)
+
+	if reset.event != "reset" || reset.id != strconv.FormatUint(feed.Seq(), 10) || !strings.Contains(reset.data, "events lost") {
+		t.Errorf("event after a lost Last-Event-ID = %+v, want a reset picking up at %d", reset, feed.Seq())
+	}
+
+	// the stream goes on from there
+	if _, err := feed.CreateTask(ctx, "third", nil, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	if event := decodeEvent(t, readEvent(t, stream)); event.Seq != feed.Seq() || event.Task.Text != "third" {
+		t.Errorf("event after the reset = %+v, want the third task", event)
+	}
+
+	rsp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/events/", nil)
+	req.Header.Set("Last-Event-ID", "yesterday")
+	NewTaskServer(feed).EventsHandler(rsp, req)
+
+	if rsp.Code != http.StatusBadRequest {
+		t.Errorf("GET /events/ with Last-Event-ID yesterday: status %d, want 400", rsp.Code)
+	}
+}
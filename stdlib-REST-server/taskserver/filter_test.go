@@ -0,0 +1,70 @@
+package taskserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+func TestListFiltered(t *testing.T) {
+	server := NewTaskServer(taskstore.New())
+	due := time.Date(2021, time.August, 1, 9, 0, 0, 0, time.UTC)
+
+	for i, tags := range [][]string{{"work"}, {"work", "blocked"}, {"home"}} {
+		if _, err := server.Datastore.CreateTask(context.Background(), fmt.Sprint("task ", i), tags, due.AddDate(0, 0, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, status, err := TransitionStoredTask(context.Background(), server.Datastore, 0, taskstore.StatusDone, httptest.NewRequest(http.MethodPost, "/task/0/complete", nil)); err != nil {
+		t.Fatalf("completing task 0: %d %v", status, err)
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"filter=" + url.QueryEscape("tag:work AND NOT tag:blocked"), "[0]"},
+		{"filter=" + url.QueryEscape("tag:work OR due>=2021-08-03"), "[0 1 2]"},
+		{"filter=" + url.QueryEscape("tag:work") + "&status=open", "[1]"},
+	}
+
+	for _, test := range tests {
+		if got := fmt.Sprint(walkPages(t, server.TaskHandler, "/task/?"+test.query)); got != test.want {
+			t.Errorf("GET /task/?%s = %v, want %v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestListFilteredError(t *testing.T) {
+	server := NewTaskServer(taskstore.New())
+	rsp := httptest.NewRecorder()
+	server.TaskHandler(rsp, httptest.NewRequest(http.MethodGet, "/task/?filter="+url.QueryEscape("tag:work AND prio:1"), nil))
+
+	if rsp.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", rsp.Code)
+	}
+
+	// the column and token, then the filter with carets under the token
+	want := `invalid filter at column 14 ("prio"): unknown field "prio", expect one of [tag status due text id]` + "\n" +
+		"tag:work AND prio:1\n" +
+		"             ^^^^\n"
+
+	if got := rsp.Body.String(); got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+
+	rsp = httptest.NewRecorder()
+	server.TaskHandler(rsp, httptest.NewRequest(http.MethodGet, "/task/?tz=Mars/Olympus&filter=due:2021-08-01", nil))
+
+	if rsp.Code != http.StatusBadRequest || !strings.Contains(rsp.Body.String(), "tz") {
+		t.Errorf("unknown tz: status %d, body %q; want 400 about tz", rsp.Code, rsp.Body)
+	}
+}
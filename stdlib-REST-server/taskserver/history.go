@@ -0,0 +1,83 @@
+package taskserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+// RevertStoredTask answers POST /task/<id>/revert?revision=<n>: it puts the task id back
+// as revision n left it, honoring If-Match like PatchStoredTask. On failure it returns the
+// HTTP status code to answer with: 400 without a valid revision number, 404 when the task
+// or the revision does not exist, 409 when the task cannot move back to the status of the
+// revision.
+func RevertStoredTask(ctx context.Context, store taskstore.Store, id int, req *http.Request) (taskstore.Task, int, error) {
+	number, err := strconv.Atoi(req.URL.Query().Get("revision"))
+
+	if err != nil || number < 1 {
+		return taskstore.Task{}, http.StatusBadRequest, errors.New("expect ?revision=<n>, the number of a revision of the task from 1")
+	}
+
+	version, status, err := ExpectedVersion(ctx, store, id, req)
+
+	if err != nil {
+		return taskstore.Task{}, status, err
+	}
+
+	task, err := store.RevertTask(ctx, id, number, version)
+
+	if err != nil {
+		return taskstore.Task{}, StatusForStoreError(err), err
+	}
+
+	return task, http.StatusOK, nil
+}
+
+func (ts *TaskServer) getHistoryHandler(rsp http.ResponseWriter, req *http.Request, id int) {
+	revs, err := ts.Datastore.GetHistory(req.Context(), id)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), StatusForStoreError(err))
+		return
+	}
+
+	MarshalAndPrepareHTTPResponse(revs, rsp)
+}
+
+func (ts *TaskServer) revertTaskHandler(rsp http.ResponseWriter, req *http.Request, id int) {
+	task, status, err := RevertStoredTask(req.Context(), ts.Datastore, id, req)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), status)
+		return
+	}
+
+	rsp.Header().Set("ETag", ETag(task))
+	MarshalAndPrepareHTTPResponse(task, rsp)
+}
+
+// historyHandler serves GET /task/<id>/history and POST /task/<id>/revert
+func (ts *TaskServer) historyHandler(rsp http.ResponseWriter, req *http.Request, id int, action string) {
+	method := http.MethodGet
+
+	if action == "revert" {
+		method = http.MethodPost
+	}
+
+	if req.Method != method {
+		http.Error(rsp,
+			fmt.Sprintf("Expect method %s at /task/<id>/%s, got %v", method, action, req.Method),
+			http.StatusMethodNotAllowed)
+		return
+	}
+
+	if action == "revert" {
+		ts.revertTaskHandler(rsp, req, id)
+	} else {
+		ts.getHistoryHandler(rsp, req, id)
+	}
+}
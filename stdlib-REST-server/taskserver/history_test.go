@@ -0,0 +1,96 @@
+package taskserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+// getHistory answers GET /task/<id>/history
+func getHistory(t *testing.T, server *TaskServer, id int) []taskstore.Revision {
+	t.Helper()
+
+	rsp := httptest.NewRecorder()
+	server.TaskHandler(rsp, httptest.NewRequest(http.MethodGet, "/task/"+strconv.Itoa(id)+"/history", nil))
+
+	if rsp.Code != http.StatusOK {
+		t.Fatalf("GET /task/%d/history: status %d: %s", id, rsp.Code, rsp.Body)
+	}
+
+	var revs []taskstore.Revision
+
+	if err := json.Unmarshal(rsp.Body.Bytes(), &revs); err != nil {
+		t.Fatal(err)
+	}
+
+	return revs
+}
+
+func TestHistoryAndRevert(t *testing.T) {
+	server, id := newPatchServer(t)
+	target := "/task/" + strconv.Itoa(id)
+
+	// revision 2 is blocked, and a done task cannot go back to blocked
+	for _, patch := range []string{`{"text": "buy oat milk", "status": "blocked"}`, `{"status": "open"}`} {
+		decodeTask(t, serveTask(server, http.MethodPatch, target, MergePatchType, patch))
+	}
+
+	decodeTask(t, serveTask(server, http.MethodPost, target+"/complete", "", ""))
+
+	revs := getHistory(t, server, id)
+
+	if len(revs) != 4 {
+		t.Fatalf("got %d revisions, want 4", len(revs))
+	}
+
+	for i, rev := range revs {
+		if rev.Number != i+1 || rev.TaskID != id || rev.Task.Version != i+1 {
+			t.Errorf("revision %d = number %d of task %d at version %d", i, rev.Number, rev.TaskID, rev.Task.Version)
+		}
+	}
+
+	if revs[0].Action != taskstore.ActionCreated || revs[3].Task.Status != taskstore.StatusDone {
+		t.Errorf("history = %+v, want it to start with the creation and end done", revs)
+	}
+
+	tests := []struct {
+		name     string
+		revision string
+		ifMatch  string
+		status   int
+	}{
+		{"not a number", "first", "", http.StatusBadRequest},
+		{"unknown revision", "9", "", http.StatusNotFound},
+		{"stale If-Match", "1", `"3"`, http.StatusPreconditionFailed},
+		{"invalid transition", "2", "", http.StatusConflict},
+	}
+
+	for _, test := range tests {
+		if rsp := serveConditional(server, http.MethodPost, target+"/revert?revision="+test.revision, "If-Match", test.ifMatch); rsp.Code != test.status {
+			t.Errorf("%s: status %d, want %d: %s", test.name, rsp.Code, test.status, rsp.Body)
+		}
+	}
+
+	rsp := serveConditional(server, http.MethodPost, target+"/revert?revision=1", "If-Match", `"4"`)
+	task := decodeTask(t, rsp)
+
+	if task.Text != "buy milk" || task.Status != taskstore.StatusOpen || task.Version != 5 || rsp.Header().Get("ETag") != `"5"` {
+		t.Errorf("reverted task = %+v, ETag %s; want revision 1 back at version 5", task, rsp.Header().Get("ETag"))
+	}
+
+	// the failed reverts left no trace
+	if revs := getHistory(t, server, id); len(revs) != 5 || revs[4].Action != taskstore.ActionReverted {
+		t.Errorf("history after the revert = %+v, want a fifth revision for it", revs)
+	}
+
+	rsp = httptest.NewRecorder()
+	server.TaskHandler(rsp, httptest.NewRequest(http.MethodGet, "/task/12345/history", nil))
+
+	if rsp.Code != http.StatusNotFound {
+		t.Errorf("GET /task/12345/history: status %d, want 404", rsp.Code)
+	}
+}
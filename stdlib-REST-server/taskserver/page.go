@@ -0,0 +1,83 @@
+package taskserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+var (
+	// ByID is how /task/ and /tag/<tag> are sorted when the request names no sort
+	ByID = taskstore.Order{Field: taskstore.SortByID}
+	// ByDue is how /due/ and /overdue/ are sorted when the request names no sort
+	ByDue = taskstore.Order{Field: taskstore.SortByDue}
+	// ByDeleted is how /trash/ is sorted when the request names no sort
+	ByDeleted = taskstore.ByDeleted
+)
+
+// PageTasks sorts a listing by the sort query parameter (id, due, text or created, and
+// deleted for the trash, prefixed with - for descending; defaultOrder when absent) and
+// cuts out the page selected by the limit and cursor parameters. Without a limit every remaining task is returned. When more
+// tasks follow it sets a Link header with rel="next" pointing at the next page.
+// On failure it returns the HTTP status code to answer with.
+func PageTasks(rsp http.ResponseWriter, req *http.Request, tasks []taskstore.Task, defaultOrder taskstore.Order) ([]taskstore.Task, int, error) {
+	query := req.URL.Query()
+	order := defaultOrder
+
+	if value := query.Get("sort"); value != "" {
+		var err error
+
+		// only the trash, listed by ByDeleted unless told otherwise, sorts by deletion
+		fields := taskstore.SortFields
+
+		if defaultOrder.Field == taskstore.SortByDeleted {
+			fields = taskstore.TrashSortFields
+		}
+
+		if order, err = taskstore.ParseOrder(value, fields); err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+	}
+
+	limit := 0
+
+	if value := query.Get("limit"); value != "" {
+		var err error
+
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > taskstore.MaxPageLimit {
+			return nil, http.StatusBadRequest,
+				fmt.Errorf("expect limit as a number from 1 to %d, got %q", taskstore.MaxPageLimit, value)
+		}
+	}
+
+	tasks, next, err := taskstore.PageTasks(tasks, order, query.Get("cursor"), limit)
+
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if next != "" {
+		rsp.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", pageURL(req, next)))
+	}
+
+	return tasks, http.StatusOK, nil
+}
+
+// pageURL is the URL of the request with its cursor replaced by cursor
+func pageURL(req *http.Request, cursor string) string {
+	query := req.URL.Query()
+	query.Set("cursor", cursor)
+
+	scheme := "http"
+
+	if req.TLS != nil {
+		scheme = "https"
+	}
+
+	next := url.URL{Scheme: scheme, Host: req.Host, Path: req.URL.Path, RawQuery: query.Encode()}
+
+	return next.String()
+}
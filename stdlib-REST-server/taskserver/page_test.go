@@ -0,0 +1,133 @@
+package taskserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+var nextLink = regexp.MustCompile(`^<([^>]+)>; rel="next"$`)
+
+// walkPages gets target and every page its Link headers lead to, and returns the ids
+// of all of them in order
+func walkPages(t *testing.T, handler http.HandlerFunc, target string) []int {
+	t.Helper()
+
+	var ids []int
+
+	for pages := 0; ; pages++ {
+		if pages > 100 {
+			t.Fatalf("still getting Link headers after %d pages", pages)
+		}
+
+		rsp := httptest.NewRecorder()
+		handler(rsp, httptest.NewRequest(http.MethodGet, target, nil))
+
+		if rsp.Code != http.StatusOK {
+			t.Fatalf("GET %s: status %d: %s", target, rsp.Code, rsp.Body)
+		}
+
+		var tasks []taskstore.Task
+
+		if err := json.Unmarshal(rsp.Body.Bytes(), &tasks); err != nil {
+			t.Fatalf("GET %s: %v", target, err)
+		}
+
+		for _, task := range tasks {
+			ids = append(ids, task.ID)
+		}
+
+		link := rsp.Header().Get("Link")
+
+		if link == "" {
+			break
+		}
+
+		match := nextLink.FindStringSubmatch(link)
+
+		if match == nil {
+			t.Fatalf("GET %s: Link %q, want <url>; rel=\"next\"", target, link)
+		}
+
+		target = match[1]
+	}
+
+	return ids
+}
+
+func TestListingLinksToNextPage(t *testing.T) {
+	server := NewTaskServer(taskstore.New())
+	day := time.Date(2021, time.August, 1, 9, 0, 0, 0, time.UTC)
+
+	// ids 0 to 4 due on the hours 3, 1, 4, 1, 5
+	for i, hours := range []int{3, 1, 4, 1, 5} {
+		if _, err := server.Datastore.CreateTask(context.Background(), fmt.Sprint("task ", i), []string{"work"}, day.Add(time.Duration(hours)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		handler http.HandlerFunc
+		target  string
+		want    string
+	}{
+		{server.TaskHandler, "/task/?limit=2", "[0 1 2 3 4]"},
+		{server.TaskHandler, "/task/?limit=2&sort=-due", "[4 2 0 3 1]"},
+		{server.TaskHandler, "/task/?limit=1&sort=due", "[1 3 0 2 4]"},
+		{server.TaskHandler, "/task/?limit=5", "[0 1 2 3 4]"},
+		{server.TaskHandler, "/task/?sort=-created", "[4 3 2 1 0]"},
+		{server.TagHandler, "/tag/work?limit=3&sort=-id", "[4 3 2 1 0]"},
+		{server.DueHandler, "/due/?from=2021-08-01&limit=2", "[1 3 0 2 4]"},
+		{server.DueHandler, "/due/2021/08/01?limit=4&sort=text", "[0 1 2 3 4]"},
+	}
+
+	for _, test := range tests {
+		if got := fmt.Sprint(walkPages(t, test.handler, test.target)); got != test.want {
+			t.Errorf("walking from %s = %v, want %v", test.target, got, test.want)
+		}
+	}
+}
+
+func TestListingPageErrors(t *testing.T) {
+	server := NewTaskServer(taskstore.New())
+
+	if _, err := server.Datastore.CreateTask(context.Background(), "task", nil, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	byDue := taskstore.Order{Field: taskstore.SortByDue}.Cursor(taskstore.SortKey{ID: 0})
+
+	targets := []string{
+		"/task/?limit=0",
+		"/task/?limit=1001",
+		"/task/?limit=ten",
+		"/task/?sort=prio",
+		"/task/?sort=deleted",
+		"/task/?cursor=garbage",
+		// a cursor only goes with the sort it was handed out for
+		"/task/?sort=text&cursor=" + byDue,
+	}
+
+	for _, target := range targets {
+		rsp := httptest.NewRecorder()
+		server.TaskHandler(rsp, httptest.NewRequest(http.MethodGet, target, nil))
+
+		if rsp.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: status %d, want 400", target, rsp.Code)
+		}
+	}
+
+	rsp := httptest.NewRecorder()
+	server.TrashHandler(rsp, httptest.NewRequest(http.MethodGet, "/trash/?sort=deleted", nil))
+
+	if rsp.Code != http.StatusOK {
+		t.Errorf("GET /trash/?sort=deleted: status %d, want 200: %s", rsp.Code, rsp.Body)
+	}
+}
@@ -0,0 +1,177 @@
+package taskserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/shien/restserver/taskstore"
+)
+
+// Media types accepted by PATCH /task/<id>
+const (
+	MergePatchType = "application/merge-patch+json" // JSON Merge Patch, RFC 7396
+	JSONPatchType  = "application/json-patch+json"  // JSON Patch, RFC 6902
+)
+
+// DecodeJSONBody checks the request carries JSON and decodes its body into v, rejecting
+// unknown fields. On failure it returns the HTTP status code to answer with.
+func DecodeJSONBody(req *http.Request, v interface{}) (int, error) {
+	mediatype, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if mediatype != "application/json" {
+		return http.StatusUnsupportedMediaType, errors.New("expect application/json Content-Type")
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(v); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	return http.StatusOK, nil
+}
+
+// PatchStoredTask runs a PATCH request on the task id: the patch in the request body is
+// applied to the stored task, honoring If-Match, and the result is stored as a
+// compare-and-swap on the task version. A swap lost to a concurrent writer is retried
+// when the client sent no If-Match. On failure it returns the HTTP status code to answer with.
+func PatchStoredTask(ctx context.Context, store taskstore.Store, id int, req *http.Request) (taskstore.Task, int, error) {
+	const attempts = 3
+
+	patch, err := io.ReadAll(req.Body)
+
+	if err != nil {
+		return taskstore.Task{}, http.StatusBadRequest, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		task, err := store.GetTask(ctx, id)
+
+		if err != nil {
+			return taskstore.Task{}, StatusForStoreError(err), err
+		}
+
+		expected, err := ifMatchVersion(req, task)
+
+		if err != nil {
+			return taskstore.Task{}, http.StatusPreconditionFailed, err
+		}
+
+		patched, status, err := PatchTask(task, req.Header.Get("Content-Type"), patch)
+
+		if err != nil {
+			return taskstore.Task{}, status, err
+		}
+
+		task, err = store.UpdateTask(ctx, patched)
+
+		if err == nil {
+			return task, http.StatusOK, nil
+		}
+
+		if !errors.Is(err, taskstore.ErrVersionConflict) || expected != 0 || attempt == attempts {
+			return taskstore.Task{}, StatusForStoreError(err), err
+		}
+	}
+}
+
+// PatchTask applies the patch document, a JSON Merge Patch or a JSON Patch depending on
+// contentType, to the JSON form of task. On failure it returns the HTTP status code to
+// answer with: 415 for other media types, 400 for malformed documents, 409 when a JSON
+// Patch "test" operation fails and 422 when the patch cannot be applied to the task or
+// changes a field clients don't set: id, version, completed_at, deleted_at or owner.
+func PatchTask(task taskstore.Task, contentType string, patch []byte) (taskstore.Task, int, error) {
+	mediatype, _, err := mime.ParseMediaType(contentType)
+
+	if err != nil {
+		return taskstore.Task{}, http.StatusBadRequest, err
+	}
+
+	doc, err := json.Marshal(task)
+
+	if err != nil {
+		return taskstore.Task{}, http.StatusInternalServerError, err
+	}
+
+	var patched []byte
+
+	switch mediatype {
+	case MergePatchType:
+		if !json.Valid(patch) {
+			return taskstore.Task{}, http.StatusBadRequest, errors.New("malformed merge patch document")
+		}
+
+		if patched, err = jsonpatch.MergePatch(doc, patch); err != nil {
+			return taskstore.Task{}, http.StatusUnprocessableEntity, err
+		}
+	case JSONPatchType:
+		operations, err := jsonpatch.DecodePatch(patch)
+
+		if err != nil {
+			return taskstore.Task{}, http.StatusBadRequest, err
+		}
+
+		if patched, err = operations.Apply(doc); err != nil {
+			if errors.Is(err, jsonpatch.ErrTestFailed) {
+				return taskstore.Task{}, http.StatusConflict, err
+			}
+
+			return taskstore.Task{}, http.StatusUnprocessableEntity, err
+		}
+	default:
+		return taskstore.Task{}, http.StatusUnsupportedMediaType,
+			fmt.Errorf("expect %s or %s Content-Type", MergePatchType, JSONPatchType)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+
+	var result taskstore.Task
+
+	if err := decoder.Decode(&result); err != nil {
+		return taskstore.Task{}, http.StatusUnprocessableEntity, err
+	}
+
+	if result.ID != task.ID {
+		return taskstore.Task{}, http.StatusUnprocessableEntity, errors.New("the id of a task cannot be changed")
+	}
+
+	if result.Version != task.Version {
+		return taskstore.Task{}, http.StatusUnprocessableEntity, errors.New("the version of a task cannot be patched, use If-Match")
+	}
+
+	if !sameTime(result.CompletedAt, task.CompletedAt) {
+		return taskstore.Task{}, http.StatusUnprocessableEntity, errors.New("completed_at cannot be patched, it is set when the task is done")
+	}
+
+	if !sameTime(result.DeletedAt, task.DeletedAt) {
+		return taskstore.Task{}, http.StatusUnprocessableEntity, errors.New("deleted_at cannot be patched, use DELETE to move a task to the trash")
+	}
+
+	if result.Owner != task.Owner {
+		return taskstore.Task{}, http.StatusUnprocessableEntity, errors.New("the owner of a task cannot be changed")
+	}
+
+	return result, http.StatusOK, nil
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Equal(*b)
+}
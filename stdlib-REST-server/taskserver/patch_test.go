@@ -0,0 +1,248 @@
+package taskserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+// newPatchServer returns a server holding one task, tagged work and home
+func newPatchServer(t *testing.T) (*TaskServer, int) {
+	server := NewTaskServer(taskstore.New())
+	id, err := server.Datastore.CreateTask(context.Background(), "buy milk", []string{"work", "home"}, time.Date(2021, time.August, 1, 9, 0, 0, 0, time.UTC))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return server, id
+}
+
+// serveTask runs a request with body on the TaskHandler
+func serveTask(server *TaskServer, method, target, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	rsp := httptest.NewRecorder()
+	server.TaskHandler(rsp, req)
+
+	return rsp
+}
+
+// decodeTask decodes the task a successful response answered with
+func decodeTask(t *testing.T, rsp *httptest.ResponseRecorder) taskstore.Task {
+	t.Helper()
+
+	if rsp.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", rsp.Code, rsp.Body)
+	}
+
+	var task taskstore.Task
+
+	if err := json.Unmarshal(rsp.Body.Bytes(), &task); err != nil {
+		t.Fatal(err)
+	}
+
+	return task
+}
+
+func TestPutTask(t *testing.T) {
+	server, id := newPatchServer(t)
+	target := "/task/" + strconv.Itoa(id)
+
+	task := decodeTask(t, serveTask(server, http.MethodPut, target, "application/json",
+		`{"text": "buy bread", "tags": ["home"], "due": "2021-08-02T10:00:00Z"}`))
+
+	if task.ID != id || task.Text != "buy bread" || len(task.Tags) != 1 || task.Tags[0] != "home" || !task.Due.Equal(time.Date(2021, time.August, 2, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("PUT %s = %+v", target, task)
+	}
+
+	stored, err := server.Datastore.GetTask(context.Background(), id)
+
+	if err != nil || stored.Text != "buy bread" {
+		t.Errorf("stored task after PUT = %+v, %v", stored, err)
+	}
+
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"unknown task", "/task/12345", "application/json", `{"text": "x"}`, http.StatusNotFound},
+		{"unknown field", target, "application/json", `{"text": "x", "prio": 1}`, http.StatusBadRequest},
+		{"malformed", target, "application/json", `{"text": `, http.StatusBadRequest},
+		{"not JSON", target, "text/plain", `text`, http.StatusUnsupportedMediaType},
+	}
+
+	for _, test := range tests {
+		if rsp := serveTask(server, http.MethodPut, test.target, test.contentType, test.body); rsp.Code != test.status {
+			t.Errorf("PUT %s: status %d, want %d: %s", test.name, rsp.Code, test.status, rsp.Body)
+		}
+	}
+}
+
+func TestPatchTask(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		patch       string
+		text        string
+		tags        []string
+	}{
+		{"merge patch", MergePatchType, `{"text": "buy oat milk"}`, "buy oat milk", []string{"work", "home"}},
+		{"merge patch removing", MergePatchType, `{"tags": null}`, "buy milk", nil},
+		{"merge patch with parameters", MergePatchType + "; charset=utf-8", `{"text": "buy oat milk"}`, "buy oat milk", []string{"work", "home"}},
+		{"JSON patch", JSONPatchType, `[{"op": "replace", "path": "/text", "value": "buy oat milk"}]`, "buy oat milk", []string{"work", "home"}},
+		{"JSON patch on a tag", JSONPatchType, `[{"op": "remove", "path": "/tags/0"}]`, "buy milk", []string{"home"}},
+		{"JSON patch with a test", JSONPatchType, `[{"op": "test", "path": "/text", "value": "buy milk"}, {"op": "add", "path": "/tags/-", "value": "shop"}]`, "buy milk", []string{"work", "home", "shop"}},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			server, id := newPatchServer(t)
+			task := decodeTask(t, serveTask(server, http.MethodPatch, "/task/"+strconv.Itoa(id), test.contentType, test.patch))
+
+			if task.ID != id || task.Text != test.text || strings.Join(task.Tags, ",") != strings.Join(test.tags, ",") {
+				t.Errorf("PATCH with %s = %+v, want text %q and tags %v", test.patch, task, test.text, test.tags)
+			}
+
+			stored, err := server.Datastore.GetTask(context.Background(), id)
+
+			if err != nil || stored.Text != test.text {
+				t.Errorf("stored task after PATCH = %+v, %v", stored, err)
+			}
+		})
+	}
+}
+
+func TestPatchTaskErrors(t *testing.T) {
+	server, id := newPatchServer(t)
+	target := "/task/" + strconv.Itoa(id)
+
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		patch       string
+		status      int
+	}{
+		{"unknown task", "/task/12345", MergePatchType, `{"text": "x"}`, http.StatusNotFound},
+		{"plain JSON", target, "application/json", `{"text": "x"}`, http.StatusUnsupportedMediaType},
+		{"no content type", target, "", `{"text": "x"}`, http.StatusBadRequest},
+		{"malformed merge patch", target, MergePatchType, `{"text": `, http.StatusBadRequest},
+		{"malformed JSON patch", target, JSONPatchType, `{"op": "replace"}`, http.StatusBadRequest},
+		{"failed test", target, JSONPatchType, `[{"op": "test", "path": "/text", "value": "buy bread"}]`, http.StatusConflict},
+		{"missing path", target, JSONPatchType, `[{"op": "remove", "path": "/prio"}]`, http.StatusUnprocessableEntity},
+		{"unknown field", target, MergePatchType, `{"prio": 1}`, http.StatusUnprocessableEntity},
+		{"wrong type", target, MergePatchType, `{"text": 1}`, http.StatusUnprocessableEntity},
+		{"id by merge patch", target, MergePatchType, `{"id": 12345}`, http.StatusUnprocessableEntity},
+		{"id by JSON patch", target, JSONPatchType, `[{"op": "replace", "path": "/id", "value": 12345}]`, http.StatusUnprocessableEntity},
+		{"version", target, MergePatchType, `{"version": 7}`, http.StatusUnprocessableEntity},
+		{"completed_at", target, MergePatchType, `{"completed_at": "2021-08-01T10:00:00Z"}`, http.StatusUnprocessableEntity},
+		{"deleted_at", target, MergePatchType, `{"deleted_at": "2021-08-01T10:00:00Z"}`, http.StatusUnprocessableEntity},
+		{"owner", target, MergePatchType, `{"owner": "mallory"}`, http.StatusUnprocessableEntity},
+	}
+
+	for _, test := range tests {
+		if rsp := serveTask(server, http.MethodPatch, test.target, test.contentType, test.patch); rsp.Code != test.status {
+			t.Errorf("PATCH %s: status %d, want %d: %s", test.name, rsp.Code, test.status, rsp.Body)
+		}
+	}
+
+	// none of them changed the task
+	if task, err := server.Datastore.GetTask(context.Background(), id); err != nil || task.Text != "buy milk" || len(task.Tags) != 2 {
+		t.Errorf("task after the failed patches = %+v, %v", task, err)
+	}
+}
+
+// racingStore is a store where another writer updates a task right before each of the
+// first races calls to UpdateTask
+type racingStore struct {
+	taskstore.Store
+	races int
+}
+
+func (rs *racingStore) UpdateTask(ctx context.Context, task taskstore.Task) (taskstore.Task, error) {
+	if rs.races > 0 {
+		rs.races--
+
+		current, err := rs.Store.GetTask(ctx, task.ID)
+
+		if err != nil {
+			return taskstore.Task{}, err
+		}
+
+		current.Tags = append(current.Tags, "raced")
+
+		if _, err := rs.Store.UpdateTask(ctx, current); err != nil {
+			return taskstore.Task{}, err
+		}
+	}
+
+	return rs.Store.UpdateTask(ctx, task)
+}
+
+func TestPatchRetriesLostUpdates(t *testing.T) {
+	tests := []struct {
+		name    string
+		races   int
+		ifMatch string
+		status  int
+	}{
+		{"one race", 1, "", http.StatusOK},
+		{"two races", 2, "", http.StatusOK},
+		// three attempts at most
+		{"three races", 3, "", http.StatusPreconditionFailed},
+		// a client pinning the version gets to know at once
+		{"race after If-Match", 1, `"1"`, http.StatusPreconditionFailed},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			server, id := newPatchServer(t)
+			store := &racingStore{Store: server.Datastore, races: test.races}
+			server.Datastore = store
+
+			req := httptest.NewRequest(http.MethodPatch, "/task/"+strconv.Itoa(id), strings.NewReader(`{"text": "buy oat milk"}`))
+			req.Header.Set("Content-Type", MergePatchType)
+
+			if test.ifMatch != "" {
+				req.Header.Set("If-Match", test.ifMatch)
+			}
+
+			rsp := httptest.NewRecorder()
+			server.TaskHandler(rsp, req)
+
+			if rsp.Code != test.status {
+				t.Fatalf("status %d, want %d: %s", rsp.Code, test.status, rsp.Body)
+			}
+
+			if test.status != http.StatusOK {
+				return
+			}
+
+			// the patch went on top of the concurrent changes, none of them is lost
+			task := decodeTask(t, rsp)
+
+			if task.Text != "buy oat milk" || len(task.Tags) != 2+test.races || task.Version != 2+test.races {
+				t.Errorf("patched task = %+v, want the new text on top of %d concurrent updates", task, test.races)
+			}
+		})
+	}
+}
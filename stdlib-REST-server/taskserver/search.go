@@ -0,0 +1,43 @@
+package taskserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+// DefaultSearchLimit is how many results GET /search/ returns without a limit parameter
+const DefaultSearchLimit = 20
+
+// SearchTasks answers GET /search/?q=<words>[&limit=<n>]: the tasks whose text has every
+// word of q (or a word starting with it), best match first, with highlighted snippets.
+// On failure it returns the HTTP status code to answer with.
+func SearchTasks(ctx context.Context, store taskstore.Store, req *http.Request) ([]taskstore.SearchResult, int, error) {
+	query := req.URL.Query()
+	limit := DefaultSearchLimit
+
+	if value := query.Get("limit"); value != "" {
+		var err error
+
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > taskstore.MaxPageLimit {
+			return nil, http.StatusBadRequest,
+				fmt.Errorf("expect limit as a number from 1 to %d, got %q", taskstore.MaxPageLimit, value)
+		}
+	}
+
+	results, err := taskstore.Search(ctx, store, query.Get("q"), limit)
+
+	if errors.Is(err, taskstore.ErrEmptyQuery) {
+		return nil, http.StatusBadRequest, fmt.Errorf("expect words to search for in q: %w", err)
+	}
+
+	if err != nil {
+		return nil, StatusForStoreError(err), err
+	}
+
+	return results, http.StatusOK, nil
+}
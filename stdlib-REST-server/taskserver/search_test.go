@@ -0,0 +1,90 @@
+package taskserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+func newSearchServer(t *testing.T) *TaskServer {
+	t.Helper()
+
+	server := NewTaskServer(taskstore.New())
+
+	for _, text := range []string{"Write the quarterly report", "Report the reports to the boss", "Buy milk"} {
+		if _, err := server.Datastore.CreateTask(context.Background(), text, nil, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return server
+}
+
+func TestSearchHandler(t *testing.T) {
+	server := newSearchServer(t)
+
+	tests := []struct {
+		target   string
+		ids      []int
+		snippets []string
+	}{
+		// more occurrences of the word rank higher
+		{"/search/?q=report", []int{1, 0}, []string{
+			"<mark>Report</mark> the <mark>reports</mark> to the boss",
+			"Write the quarterly <mark>report</mark>",
+		}},
+		// every word has to be there, the last one as a prefix
+		{"/search/?q=report+bo", []int{1}, []string{"<mark>Report</mark> the <mark>reports</mark> to the <mark>boss</mark>"}},
+		{"/search/?q=report&limit=1", []int{1}, nil},
+		{"/search/?q=nothing", []int{}, nil},
+	}
+
+	for _, test := range tests {
+		rsp := httptest.NewRecorder()
+		server.SearchHandler(rsp, httptest.NewRequest(http.MethodGet, test.target, nil))
+
+		if rsp.Code != http.StatusOK {
+			t.Errorf("GET %s: status %d: %s", test.target, rsp.Code, rsp.Body)
+			continue
+		}
+
+		var results []taskstore.SearchResult
+
+		if err := json.Unmarshal(rsp.Body.Bytes(), &results); err != nil {
+			t.Fatalf("GET %s: %v", test.target, err)
+		}
+
+		if len(results) != len(test.ids) {
+			t.Errorf("GET %s: got %d results, want tasks %v", test.target, len(results), test.ids)
+			continue
+		}
+
+		for i, result := range results {
+			if result.Task.ID != test.ids[i] || result.Score <= 0 {
+				t.Errorf("GET %s: result %d = task %d with score %v, want task %d", test.target, i, result.Task.ID, result.Score, test.ids[i])
+			}
+
+			if test.snippets != nil && result.Snippet != test.snippets[i] {
+				t.Errorf("GET %s: snippet %d = %q, want %q", test.target, i, result.Snippet, test.snippets[i])
+			}
+		}
+	}
+}
+
+func TestSearchHandlerErrors(t *testing.T) {
+	server := newSearchServer(t)
+
+	for _, target := range []string{"/search/", "/search/?q=", "/search/?q=+-+", "/search/?q=report&limit=0", "/search/?q=report&limit=many"} {
+		rsp := httptest.NewRecorder()
+		server.SearchHandler(rsp, httptest.NewRequest(http.MethodGet, target, nil))
+
+		if rsp.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: status %d, want 400", target, rsp.Code)
+		}
+	}
+}
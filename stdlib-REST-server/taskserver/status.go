@@ -0,0 +1,160 @@
+package taskserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/shien/restserver/taskstore"
+	"github.com/shien/restserver/taskstore/filter"
+)
+
+// StatusFilter parses the status query parameter of GET /task/, a comma separated list
+// that may also be repeated (?status=open,in_progress&status=blocked); nil means any status.
+func StatusFilter(req *http.Request) ([]taskstore.Status, error) {
+	var statuses []taskstore.Status
+
+	for _, param := range req.URL.Query()["status"] {
+		for _, name := range strings.Split(param, ",") {
+			status, err := taskstore.ParseStatus(strings.TrimSpace(name))
+
+			if err != nil {
+				return nil, err
+			}
+
+			statuses = append(statuses, status)
+		}
+	}
+
+	return statuses, nil
+}
+
+// ListTasks answers GET /task/: every task, or only those in the statuses asked for
+// with the status query parameter and matching the filter parameter (see package filter).
+// On failure it returns the HTTP status code to answer with.
+func ListTasks(ctx context.Context, store taskstore.Store, req *http.Request) ([]taskstore.Task, int, error) {
+	statuses, err := StatusFilter(req)
+
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if value := req.URL.Query().Get("filter"); value != "" {
+		return listFiltered(ctx, store, req, value, statuses)
+	}
+
+	if len(statuses) == 0 {
+		tasks, err := store.GetAllTasks(ctx)
+
+		if err != nil {
+			return nil, StatusForStoreError(err), err
+		}
+
+		return tasks, http.StatusOK, nil
+	}
+
+	var tasks []taskstore.Task
+	seen := make(map[taskstore.Status]bool)
+
+	for _, status := range statuses {
+		if seen[status] {
+			continue
+		}
+
+		seen[status] = true
+
+		found, err := store.GetTaskByStatus(ctx, status)
+
+		if err != nil {
+			return nil, StatusForStoreError(err), err
+		}
+
+		tasks = append(tasks, found...)
+	}
+
+	return tasks, http.StatusOK, nil
+}
+
+// TransitionStoredTask moves the task id to status, as POST /task/<id>/complete and
+// /task/<id>/reopen do, honoring If-Match like PatchStoredTask. On failure it returns the
+// HTTP status code to answer with: 409 Conflict when the task cannot reach status.
+func TransitionStoredTask(ctx context.Context, store taskstore.Store, id int, status taskstore.Status, req *http.Request) (taskstore.Task, int, error) {
+	const attempts = 3
+
+	for attempt := 1; ; attempt++ {
+		task, err := store.GetTask(ctx, id)
+
+		if err != nil {
+			return taskstore.Task{}, StatusForStoreError(err), err
+		}
+
+		expected, err := ifMatchVersion(req, task)
+
+		if err != nil {
+			return taskstore.Task{}, http.StatusPreconditionFailed, err
+		}
+
+		// completing a done task is a no-op that keeps its version
+		if task.Status == status {
+			return task, http.StatusOK, nil
+		}
+
+		task.Status = status
+		task, err = store.UpdateTask(ctx, task)
+
+		if err == nil {
+			return task, http.StatusOK, nil
+		}
+
+		if !errors.Is(err, taskstore.ErrVersionConflict) || expected != 0 || attempt == attempts {
+			return taskstore.Task{}, StatusForStoreError(err), err
+		}
+	}
+}
+
+// listFiltered answers GET /task/?filter=, keeping only the tasks in statuses when there are any
+func listFiltered(ctx context.Context, store taskstore.Store, req *http.Request, value string, statuses []taskstore.Status) ([]taskstore.Task, int, error) {
+	loc, err := DueZone(req)
+
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	expr, err := filter.Parse(value, loc)
+
+	if err != nil {
+		// point at the offending token under the filter, for people reading the answer
+		var filterErr *filter.Error
+
+		if errors.As(err, &filterErr) {
+			err = fmt.Errorf("%v\n%s", err, filterErr.Pointer())
+		}
+
+		return nil, http.StatusBadRequest, err
+	}
+
+	tasks, err := filter.Eval(ctx, store, expr)
+
+	if err != nil {
+		return nil, StatusForStoreError(err), err
+	}
+
+	if len(statuses) == 0 {
+		return tasks, http.StatusOK, nil
+	}
+
+	kept := tasks[:0]
+
+	for _, task := range tasks {
+		for _, status := range statuses {
+			if task.Status == status {
+				kept = append(kept, task)
+				break
+			}
+		}
+	}
+
+	return kept, http.StatusOK, nil
+}
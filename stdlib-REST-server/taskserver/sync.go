@@ -0,0 +1,358 @@
+package taskserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+const (
+	// DefaultSyncTimeout is how long GET /sync/ waits for a change without ?timeout=
+	DefaultSyncTimeout = 30 * time.Second
+	// MaxSyncTimeout is the longest ?timeout= GET /sync/ accepts
+	MaxSyncTimeout = 60 * time.Second
+	// MaxSyncBatch is the most mutations POST /sync/ accepts at once
+	MaxSyncBatch = 500
+)
+
+// Operations of a SyncMutation
+const (
+	SyncCreate = "create"
+	SyncUpdate = "update"
+	SyncDelete = "delete"
+)
+
+// SyncDelta is the answer to GET /sync/: the changes since the client's token, each task
+// once as the last change left it, and the token to ask for the next ones with.
+type SyncDelta struct {
+	Token string `json:"token"`
+	// Reset is set when the changes since the token are no longer known, or no token
+	// was given: Created then has every live task and the client replaces its copy.
+	Reset   bool             `json:"reset,omitempty"`
+	Created []taskstore.Task `json:"created"`
+	Updated []taskstore.Task `json:"updated"`
+	Deleted []Tombstone      `json:"deleted"`
+}
+
+// Tombstone stands for a task moved to the trash
+type Tombstone struct {
+	ID        int       `json:"id"`
+	Version   int       `json:"version"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// SyncMutation is a change a client made offline, uploaded with POST /sync/
+type SyncMutation struct {
+	// ClientID is the client's name for the mutation, sent back on its result
+	ClientID string `json:"client_id"`
+	Op       string `json:"op"`
+	// ID is the task to update or delete
+	ID int `json:"id"`
+	// Version is the version of the task the client changed, 0 to apply the change
+	// whatever the task became meanwhile
+	Version int `json:"version"`
+
+	// the task as the client left it, for create and update; a create takes no status
+	Text   string           `json:"text"`
+	Tags   []string         `json:"tags"`
+	Due    time.Time        `json:"due"`
+	Status taskstore.Status `json:"status,omitempty"`
+}
+
+// SyncResult is how one SyncMutation went
+type SyncResult struct {
+	ClientID string `json:"client_id,omitempty"`
+	// Status is the HTTP status code the change would have got on its own, but 409 for
+	// a change made to an older version of the task than the stored one
+	Status int             `json:"status"`
+	Task   *taskstore.Task `json:"task,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	// Conflict is the stored task a 409 change lost to; the client merges its change
+	// into it and uploads it again with its version
+	Conflict *taskstore.Task `json:"conflict,omitempty"`
+}
+
+// SyncHandler serves /sync/ for clients keeping a copy of the tasks. GET /sync/?since=<token>
+// answers a SyncDelta, waiting up to ?timeout=<seconds> for a change when there is none
+// yet; POST /sync/ applies a batch of SyncMutation in order and answers their SyncResult.
+func (ts *TaskServer) SyncHandler(rsp http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/sync/" {
+		http.Error(rsp, "Expect /sync/", http.StatusNotFound)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		watcher, ok := ts.Datastore.(taskstore.Watcher)
+
+		if !ok {
+			http.Error(rsp, "the task store does not publish its changes", http.StatusNotImplemented)
+			return
+		}
+
+		delta, status, err := SyncChanges(req.Context(), watcher, req)
+
+		if err != nil {
+			http.Error(rsp, err.Error(), status)
+			return
+		}
+
+		MarshalAndPrepareHTTPResponse(delta, rsp)
+
+	case http.MethodPost:
+		var batch struct {
+			Mutations []SyncMutation `json:"mutations"`
+		}
+
+		if status, err := DecodeJSONBody(req, &batch); err != nil {
+			http.Error(rsp, err.Error(), status)
+			return
+		}
+
+		if len(batch.Mutations) > MaxSyncBatch {
+			http.Error(rsp, fmt.Sprintf("expect at most %d mutations, got %d", MaxSyncBatch, len(batch.Mutations)), http.StatusBadRequest)
+			return
+		}
+
+		results := ApplyMutations(req.Context(), ts.Datastore, batch.Mutations)
+
+		MarshalAndPrepareHTTPResponse(map[string][]SyncResult{"results": results}, rsp)
+
+	default:
+		http.Error(rsp,
+			fmt.Sprintf("Expect method GET or POST at /sync/, got %v", req.Method),
+			http.StatusMethodNotAllowed)
+	}
+}
+
+// SyncChanges answers GET /sync/?since=<token>&timeout=<seconds> from the events of
+// watcher, waiting for the first change until the timeout or until ctx is done. On
+// failure it returns the HTTP status code to answer with.
+func SyncChanges(ctx context.Context, watcher taskstore.Watcher, req *http.Request) (SyncDelta, int, error) {
+	query := req.URL.Query()
+	timeout := DefaultSyncTimeout
+
+	if value := query.Get("timeout"); value != "" {
+		seconds, err := strconv.Atoi(value)
+
+		if err != nil || seconds < 0 || time.Duration(seconds)*time.Second > MaxSyncTimeout {
+			return SyncDelta{}, http.StatusBadRequest, fmt.Errorf("expect ?timeout= in seconds from 0 to %d, got %q", MaxSyncTimeout/time.Second, value)
+		}
+
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	var since uint64
+
+	if value := query.Get("since"); value != "" {
+		var err error
+
+		if since, err = strconv.ParseUint(value, 10, 64); err != nil || since == 0 {
+			return SyncDelta{}, http.StatusBadRequest, fmt.Errorf("expect ?since= a token handed out by /sync/, got %q", value)
+		}
+	}
+
+	if since == 0 {
+		return resetDelta(ctx, watcher)
+	}
+
+	sub, err := watcher.Subscribe(ctx, since)
+
+	if errors.Is(err, taskstore.ErrEventsLost) {
+		return resetDelta(ctx, watcher)
+	}
+
+	if err != nil {
+		return SyncDelta{}, StatusForStoreError(err), err
+	}
+
+	defer sub.Close()
+
+	events := drainEvents(sub, nil)
+
+	if len(events) == 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case event, ok := <-sub.Events():
+			if ok {
+				events = drainEvents(sub, append(events, event))
+			}
+		case <-timer.C:
+		case <-ctx.Done():
+			return SyncDelta{}, http.StatusServiceUnavailable, ctx.Err()
+		}
+	}
+
+	token := since
+
+	if len(events) > 0 {
+		token = events[len(events)-1].Seq
+	}
+
+	return deltaOf(events, token), http.StatusOK, nil
+}
+
+// drainEvents appends the events sub has ready to events, without waiting for more
+func drainEvents(sub *taskstore.Subscription, events []taskstore.Event) []taskstore.Event {
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				return events // dropped: the next token picks up after the last event taken
+			}
+
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+// resetDelta lists every live task, with a token taken before reading them: changes made
+// meanwhile come again on the next sync, which leaves the client's copy the same.
+func resetDelta(ctx context.Context, watcher taskstore.Watcher) (SyncDelta, int, error) {
+	seq := watcher.Seq()
+	tasks, err := watcher.GetAllTasks(ctx)
+
+	if err != nil {
+		return SyncDelta{}, StatusForStoreError(err), err
+	}
+
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+
+	delta := deltaOf(nil, seq)
+	delta.Reset = true
+	delta.Created = append(delta.Created, tasks...)
+
+	return delta, http.StatusOK, nil
+}
+
+// deltaOf sorts out the tasks the events changed by id: a task deleted by its last event
+// is a tombstone, one created (or restored) by any of them is created, others updated.
+func deltaOf(events []taskstore.Event, token uint64) SyncDelta {
+	delta := SyncDelta{
+		Token:   strconv.FormatUint(token, 10),
+		Created: []taskstore.Task{},
+		Updated: []taskstore.Task{},
+		Deleted: []Tombstone{},
+	}
+
+	last := make(map[int]taskstore.Event)
+	created := make(map[int]bool)
+
+	for _, event := range events {
+		last[event.Task.ID] = event
+
+		if event.Type == taskstore.EventCreated {
+			created[event.Task.ID] = true
+		}
+	}
+
+	ids := make([]int, 0, len(last))
+
+	for id := range last {
+		ids = append(ids, id)
+	}
+
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		event := last[id]
+
+		switch {
+		case event.Type == taskstore.EventDeleted:
+			tombstone := Tombstone{ID: id, Version: event.Task.Version, DeletedAt: event.At}
+
+			if event.Task.DeletedAt != nil {
+				tombstone.DeletedAt = *event.Task.DeletedAt
+			}
+
+			delta.Deleted = append(delta.Deleted, tombstone)
+		case created[id]:
+			delta.Created = append(delta.Created, event.Task)
+		default:
+			delta.Updated = append(delta.Updated, event.Task)
+		}
+	}
+
+	return delta
+}
+
+// ApplyMutations makes the changes of a POST /sync/ batch one after the other, going on
+// past those that fail, and returns how each went.
+func ApplyMutations(ctx context.Context, store taskstore.Store, mutations []SyncMutation) []SyncResult {
+	results := make([]SyncResult, 0, len(mutations))
+
+	for _, m := range mutations {
+		task, status, err := applyMutation(ctx, store, m)
+		result := SyncResult{ClientID: m.ClientID, Status: status}
+
+		if err != nil {
+			result.Error = err.Error()
+
+			if errors.Is(err, taskstore.ErrVersionConflict) {
+				result.Status = http.StatusConflict
+
+				if current, err := store.GetTask(ctx, m.ID); err == nil {
+					result.Conflict = &current
+				}
+			}
+		} else if m.Op != SyncDelete {
+			result.Task = &task
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+func applyMutation(ctx context.Context, store taskstore.Store, m SyncMutation) (taskstore.Task, int, error) {
+	switch m.Op {
+	case SyncCreate:
+		if m.Status != "" && m.Status != taskstore.StatusOpen {
+			return taskstore.Task{}, http.StatusBadRequest, fmt.Errorf("a task is created %s, update it once created to make it %s", taskstore.StatusOpen, m.Status)
+		}
+
+		id, err := store.CreateTask(ctx, m.Text, m.Tags, m.Due)
+
+		if err != nil {
+			return taskstore.Task{}, StatusForStoreError(err), err
+		}
+
+		task, err := store.GetTask(ctx, id)
+
+		if err != nil {
+			return taskstore.Task{}, StatusForStoreError(err), err
+		}
+
+		return task, http.StatusCreated, nil
+
+	case SyncUpdate:
+		task, err := store.UpdateTask(ctx, taskstore.Task{ID: m.ID, Text: m.Text, Tags: m.Tags, Due: m.Due, Version: m.Version, Status: m.Status})
+
+		if err != nil {
+			return taskstore.Task{}, StatusForStoreError(err), err
+		}
+
+		return task, http.StatusOK, nil
+
+	case SyncDelete:
+		if err := store.DeleteTask(ctx, m.ID, m.Version); err != nil {
+			return taskstore.Task{}, StatusForStoreError(err), err
+		}
+
+		return taskstore.Task{}, http.StatusNoContent, nil
+
+	default:
+		return taskstore.Task{}, http.StatusBadRequest, fmt.Errorf("unknown op %q, expect %s, %s or %s", m.Op, SyncCreate, SyncUpdate, SyncDelete)
+	}
+}
@@ -0,0 +1,207 @@
+package taskserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+// getSync answers GET target from the sync handler of a server for feed
+func getSync(t *testing.T, feed *taskstore.Feed, target string) SyncDelta {
+	t.Helper()
+
+	rsp := httptest.NewRecorder()
+	NewTaskServer(feed).SyncHandler(rsp, httptest.NewRequest(http.MethodGet, target, nil))
+
+	if rsp.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d: %s", target, rsp.Code, rsp.Body)
+	}
+
+	var delta SyncDelta
+
+	if err := json.Unmarshal(rsp.Body.Bytes(), &delta); err != nil {
+		t.Fatal(err)
+	}
+
+	return delta
+}
+
+// postSync uploads mutations to the sync handler of a server for feed
+func postSync(t *testing.T, feed *taskstore.Feed, mutations ...SyncMutation) []SyncResult {
+	t.Helper()
+
+	body, err := json.Marshal(map[string][]SyncMutation{"mutations": mutations})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/sync/", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	NewTaskServer(feed).SyncHandler(rsp, req)
+
+	if rsp.Code != http.StatusOK {
+		t.Fatalf("POST /sync/: status %d: %s", rsp.Code, rsp.Body)
+	}
+
+	var answer struct {
+		Results []SyncResult `json:"results"`
+	}
+
+	if err := json.Unmarshal(rsp.Body.Bytes(), &answer); err != nil {
+		t.Fatal(err)
+	}
+
+	return answer.Results
+}
+
+func TestSyncTombstones(t *testing.T) {
+	ctx := context.Background()
+	feed := taskstore.NewFeed(taskstore.New(), taskstore.DefaultFeedOptions)
+
+	kept, err := feed.CreateTask(ctx, "kept", nil, time.Now())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trashed, err := feed.CreateTask(ctx, "trashed", nil, time.Now())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reset := getSync(t, feed, "/sync/")
+
+	if !reset.Reset || len(reset.Created) != 2 {
+		t.Fatalf("first sync = %+v, want a reset with both tasks", reset)
+	}
+
+	if _, err := feed.UpdateTask(ctx, taskstore.Task{ID: kept, Text: "kept and changed"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := feed.DeleteTask(ctx, trashed, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	delta := getSync(t, feed, "/sync/?timeout=0&since="+reset.Token)
+
+	if delta.Reset || len(delta.Created) != 0 || len(delta.Updated) != 1 || delta.Updated[0].Text != "kept and changed" {
+		t.Errorf("delta = %+v, want the kept task updated", delta)
+	}
+
+	if len(delta.Deleted) != 1 || delta.Deleted[0].ID != trashed || delta.Deleted[0].Version != 1 || delta.Deleted[0].DeletedAt.IsZero() {
+		t.Errorf("tombstones = %+v, want one for task %d at version 1", delta.Deleted, trashed)
+	}
+
+	// a task created and trashed between two syncs is only a tombstone
+	gone, err := feed.CreateTask(ctx, "gone", nil, time.Now())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := feed.DeleteTask(ctx, gone, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	delta = getSync(t, feed, "/sync/?timeout=0&since="+delta.Token)
+
+	if len(delta.Created) != 0 || len(delta.Deleted) != 1 || delta.Deleted[0].ID != gone {
+		t.Errorf("delta = %+v, want only a tombstone for task %d", delta, gone)
+	}
+
+	// trashed tasks are left out of a reset
+	if reset := getSync(t, feed, "/sync/"); len(reset.Created) != 1 || reset.Created[0].ID != kept {
+		t.Errorf("reset = %+v, want only task %d", reset, kept)
+	}
+}
+
+func TestSyncVersionConflict(t *testing.T) {
+	ctx := context.Background()
+	feed := taskstore.NewFeed(taskstore.New(), taskstore.DefaultFeedOptions)
+
+	id, err := feed.CreateTask(ctx, "buy milk", nil, time.Now())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// changed elsewhere while the client was offline
+	if _, err := feed.UpdateTask(ctx, taskstore.Task{ID: id, Text: "buy oat milk"}); err != nil {
+		t.Fatal(err)
+	}
+
+	results := postSync(t, feed,
+		SyncMutation{ClientID: "a1", Op: SyncUpdate, ID: id, Version: 1, Text: "buy soy milk"},
+		SyncMutation{ClientID: "a2", Op: SyncDelete, ID: id, Version: 1},
+		SyncMutation{ClientID: "a3", Op: SyncUpdate, ID: id, Version: 2, Text: "buy soy milk"},
+		SyncMutation{ClientID: "a4", Op: SyncCreate, Text: "call mom", Status: taskstore.StatusDone},
+	)
+
+	if len(results) != 4 {
+		t.Fatalf("got %d results, want 4", len(results))
+	}
+
+	for _, result := range results[:2] {
+		if result.Status != http.StatusConflict || result.Conflict == nil || result.Conflict.Version != 2 || result.Conflict.Text != "buy oat milk" {
+			t.Errorf("result %+v, want a 409 with the task at version 2", result)
+		}
+	}
+
+	if merged := results[2]; merged.ClientID != "a3" || merged.Status != http.StatusOK || merged.Task == nil || merged.Task.Version != 3 || merged.Task.Text != "buy soy milk" {
+		t.Errorf("result %+v, want the merged change applied at version 3", merged)
+	}
+
+	if created := results[3]; created.Status != http.StatusBadRequest || created.Task != nil {
+		t.Errorf("result %+v, want a 400 for a task created done", created)
+	}
+}
+
+func TestSyncLongPoll(t *testing.T) {
+	ctx := context.Background()
+	feed := taskstore.NewFeed(taskstore.New(), taskstore.DefaultFeedOptions)
+	token := getSync(t, feed, "/sync/").Token
+
+	// nothing changed: ?timeout=0 answers at once with the same token
+	if delta := getSync(t, feed, "/sync/?timeout=0&since="+token); delta.Token != token || len(delta.Created)+len(delta.Updated)+len(delta.Deleted) != 0 {
+		t.Errorf("delta = %+v, want no change at token %s", delta, token)
+	}
+
+	answers := make(chan *httptest.ResponseRecorder, 1)
+
+	go func() {
+		rsp := httptest.NewRecorder()
+		NewTaskServer(feed).SyncHandler(rsp, httptest.NewRequest(http.MethodGet, "/sync/?timeout=30&since="+token, nil))
+		answers <- rsp
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	if _, err := feed.CreateTask(ctx, "wake up", nil, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case rsp := <-answers:
+		var delta SyncDelta
+
+		if err := json.Unmarshal(rsp.Body.Bytes(), &delta); err != nil {
+			t.Fatalf("status %d: %v", rsp.Code, err)
+		}
+
+		if len(delta.Created) != 1 || delta.Created[0].Text != "wake up" || delta.Token == token {
+			t.Errorf("delta = %+v, want the new task at a new token", delta)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("GET /sync/ still waiting after a change")
+	}
+}
@@ -2,6 +2,7 @@ package taskserver
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"mime"
 	"net/http"
@@ -14,11 +15,10 @@ import (
 
 // Backend server wraps the database like taskstore
 type TaskServer struct {
-	Datastore *taskstore.TaskStore
+	Datastore taskstore.Store
 }
 
-func NewTaskServer() *TaskServer {
-	store := taskstore.New()
+func NewTaskServer(store taskstore.Store) *TaskServer {
 	return &TaskServer{Datastore: store}
 }
 
@@ -57,40 +57,138 @@ func (ts *TaskServer) createTaskHandler(rsp http.ResponseWriter, req *http.Reque
 		return
 	}
 
-	id := ts.Datastore.CreateTask(rt.Text, rt.Tags, rt.Due)
+	id, err := ts.Datastore.CreateTask(req.Context(), rt.Text, rt.Tags, rt.Due)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	MarshalAndPrepareHTTPResponse(RequestTaskID{Id: id}, rsp)
 }
 
 func (ts *TaskServer) deleteTaskHandler(rsp http.ResponseWriter, req *http.Request, id int) {
-	err := ts.Datastore.DeleteTask(id)
+	version, status, err := ExpectedVersion(req.Context(), ts.Datastore, id, req)
 
 	if err != nil {
-		http.Error(rsp, err.Error(), http.StatusNotFound)
+		http.Error(rsp, err.Error(), status)
+		return
+	}
+
+	err = ts.Datastore.DeleteTask(req.Context(), id, version)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), StatusForStoreError(err))
 	}
 }
 
 func (ts *TaskServer) deleteAllTasksHandler(rsp http.ResponseWriter, req *http.Request) {
-	ts.Datastore.DeleteAllTasks()
+	if err := ConfirmDeleteAll(req); err != nil {
+		http.Error(rsp, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := ts.Datastore.DeleteAllTasks(req.Context()); err != nil {
+		http.Error(rsp, err.Error(), StatusForStoreError(err))
+	}
 }
 
 func (ts *TaskServer) getAllTasksHandler(rsp http.ResponseWriter, req *http.Request) {
-	allTasks := ts.Datastore.GetAllTasks() // 1. backend service
+	allTasks, status, err := ListTasks(req.Context(), ts.Datastore, req) // 1. backend service
+
+	if err == nil {
+		allTasks, status, err = PageTasks(rsp, req, allTasks, ByID)
+	}
+
+	if err != nil {
+		http.Error(rsp, err.Error(), status)
+		return
+	}
 
 	MarshalAndPrepareHTTPResponse(allTasks, rsp)
 }
 
 func (ts *TaskServer) getTaskHandler(rsp http.ResponseWriter, req *http.Request, id int) {
-	task, err := ts.Datastore.GetTask(id)
+	task, err := ts.Datastore.GetTask(req.Context(), id)
 
 	if err != nil {
-		http.Error(rsp, err.Error(), http.StatusNotFound)
+		http.Error(rsp, err.Error(), StatusForStoreError(err))
+		return
+	}
+
+	rsp.Header().Set("ETag", ETag(task))
+
+	if NotModified(req, task) {
+		rsp.WriteHeader(http.StatusNotModified)
 		return
 	}
 
 	MarshalAndPrepareHTTPResponse(task, rsp) // 2. Prepare the HTTP response to client
 }
 
+func (ts *TaskServer) updateTaskHandler(rsp http.ResponseWriter, req *http.Request, id int) {
+	type RequestTask struct {
+		Text   string           `json:"text"`
+		Tags   []string         `json:"tags"`
+		Due    time.Time        `json:"due"`
+		Status taskstore.Status `json:"status"` // optional, keeps the current status when left out
+	}
+
+	var rt RequestTask
+
+	if status, err := DecodeJSONBody(req, &rt); err != nil {
+		http.Error(rsp, err.Error(), status)
+		return
+	}
+
+	version, status, err := ExpectedVersion(req.Context(), ts.Datastore, id, req)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), status)
+		return
+	}
+
+	task, err := ts.Datastore.UpdateTask(req.Context(), taskstore.Task{ID: id, Text: rt.Text, Tags: rt.Tags, Due: rt.Due, Version: version, Status: rt.Status})
+
+	if err != nil {
+		http.Error(rsp, err.Error(), StatusForStoreError(err))
+		return
+	}
+
+	rsp.Header().Set("ETag", ETag(task))
+	MarshalAndPrepareHTTPResponse(task, rsp)
+}
+
+func (ts *TaskServer) patchTaskHandler(rsp http.ResponseWriter, req *http.Request, id int) {
+	task, status, err := PatchStoredTask(req.Context(), ts.Datastore, id, req)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), status)
+		return
+	}
+
+	rsp.Header().Set("ETag", ETag(task))
+	MarshalAndPrepareHTTPResponse(task, rsp)
+}
+
+func (ts *TaskServer) transitionTaskHandler(rsp http.ResponseWriter, req *http.Request, id int, status taskstore.Status) {
+	task, code, err := TransitionStoredTask(req.Context(), ts.Datastore, id, status, req)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), code)
+		return
+	}
+
+	rsp.Header().Set("ETag", ETag(task))
+	MarshalAndPrepareHTTPResponse(task, rsp)
+}
+
+// transitionActions maps the actions of POST /task/<id>/<action> to the status they move the task to
+var transitionActions = map[string]taskstore.Status{
+	"complete": taskstore.StatusDone,
+	"reopen":   taskstore.StatusOpen,
+}
+
 // handler that sees what REST API should be provided and pass the request to the low-level handlers
 func (ts *TaskServer) TaskHandler(rsp http.ResponseWriter, req *http.Request) {
 	if req.URL.Path == "/task/" {
@@ -122,13 +220,35 @@ func (ts *TaskServer) TaskHandler(rsp http.ResponseWriter, req *http.Request) {
 			return
 		}
 
-		if req.Method == http.MethodDelete {
+		if len(pathParts) == 3 && (pathParts[2] == "history" || pathParts[2] == "revert") {
+			ts.historyHandler(rsp, req, id, pathParts[2])
+		} else if len(pathParts) == 3 {
+			status, ok := transitionActions[pathParts[2]]
+
+			if !ok {
+				http.Error(rsp, "Expect /task/<id>/complete, /task/<id>/reopen, /task/<id>/history or /task/<id>/revert", http.StatusNotFound)
+				return
+			}
+
+			if req.Method != http.MethodPost {
+				http.Error(rsp,
+					fmt.Sprintf("Expect method POST at /task/<id>/%s, got %v", pathParts[2], req.Method),
+					http.StatusMethodNotAllowed)
+				return
+			}
+
+			ts.transitionTaskHandler(rsp, req, id, status)
+		} else if req.Method == http.MethodDelete {
 			ts.deleteTaskHandler(rsp, req, id)
 		} else if req.Method == http.MethodGet {
 			ts.getTaskHandler(rsp, req, id)
+		} else if req.Method == http.MethodPut {
+			ts.updateTaskHandler(rsp, req, id)
+		} else if req.Method == http.MethodPatch {
+			ts.patchTaskHandler(rsp, req, id)
 		} else {
 			http.Error(rsp,
-				fmt.Sprintf("Expect method GET, DELETE or POST at /task/<id>, got %v", req.Method),
+				fmt.Sprintf("Expect method GET, PUT, PATCH or DELETE at /task/<id>, got %v", req.Method),
 				http.StatusMethodNotAllowed)
 			return
 		}
@@ -152,7 +272,19 @@ func (ts *TaskServer) TagHandler(rsp http.ResponseWriter, req *http.Request) {
 
 	tag := pathParts[1]
 
-	task := ts.Datastore.GetTaskByTag(tag)
+	task, err := ts.Datastore.GetTaskByTag(req.Context(), tag)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), StatusForStoreError(err))
+		return
+	}
+
+	task, status, err := PageTasks(rsp, req, task, ByID)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), status)
+		return
+	}
 
 	MarshalAndPrepareHTTPResponse(task, rsp)
 }
@@ -167,6 +299,22 @@ func (ts *TaskServer) DueHandler(rsp http.ResponseWriter, req *http.Request) {
 
 	pathParts := TrimAndParseRequestPath(*req)
 
+	if len(pathParts) == 1 { // /due/?from=<time>&to=<time>
+		tasks, status, err := ListTasksDue(req.Context(), ts.Datastore, req)
+
+		if err == nil {
+			tasks, status, err = PageTasks(rsp, req, tasks, ByDue)
+		}
+
+		if err != nil {
+			http.Error(rsp, err.Error(), status)
+			return
+		}
+
+		MarshalAndPrepareHTTPResponse(tasks, rsp)
+		return
+	}
+
 	prepareBadRequestError := func() {
 		http.Error(rsp,
 			fmt.Sprintf("Expect method GET at /due/<year>/<month>/<day>, got %v", req.Method),
@@ -199,10 +347,63 @@ func (ts *TaskServer) DueHandler(rsp http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	tasks := ts.Datastore.GetTaskByDueDate(year, time.Month(month), day)
+	tasks, status, err := ListTasksDueOn(req.Context(), ts.Datastore, req, year, time.Month(month), day)
+
+	if err == nil {
+		tasks, status, err = PageTasks(rsp, req, tasks, ByDue)
+	}
+
+	if err != nil {
+		http.Error(rsp, err.Error(), status)
+		return
+	}
+
+	MarshalAndPrepareHTTPResponse(tasks, rsp)
+}
+
+func (ts *TaskServer) OverdueHandler(rsp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(rsp,
+			fmt.Sprintf("Expect method GET at /overdue/, got %v", req.Method),
+			http.StatusMethodNotAllowed)
+		return
+	}
+
+	tasks, err := taskstore.GetOverdueTasks(req.Context(), ts.Datastore, time.Now())
+
+	if err != nil {
+		http.Error(rsp, err.Error(), StatusForStoreError(err))
+		return
+	}
+
+	tasks, status, err := PageTasks(rsp, req, tasks, ByDue)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), status)
+		return
+	}
+
 	MarshalAndPrepareHTTPResponse(tasks, rsp)
 }
 
+func (ts *TaskServer) SearchHandler(rsp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(rsp,
+			fmt.Sprintf("Expect method GET at /search/, got %v", req.Method),
+			http.StatusMethodNotAllowed)
+		return
+	}
+
+	results, status, err := SearchTasks(req.Context(), ts.Datastore, req)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), status)
+		return
+	}
+
+	MarshalAndPrepareHTTPResponse(results, rsp)
+}
+
 func TrimAndParseRequestPath(req http.Request) []string {
 	path := strings.Trim(req.URL.Path, "/")
 	pathParts := strings.Split(path, "/")
@@ -210,6 +411,28 @@ func TrimAndParseRequestPath(req http.Request) []string {
 	return pathParts
 }
 
+// StatusForStoreError maps an error returned by a taskstore.Store to the HTTP status code reported to clients
+func StatusForStoreError(err error) int {
+	if errors.Is(err, taskstore.ErrNotFound) {
+		return http.StatusNotFound
+	}
+
+	// stores only report conflicts for versions requested through If-Match
+	if errors.Is(err, taskstore.ErrVersionConflict) {
+		return http.StatusPreconditionFailed
+	}
+
+	if errors.Is(err, taskstore.ErrInvalidTransition) {
+		return http.StatusConflict
+	}
+
+	if errors.Is(err, taskstore.ErrForbidden) {
+		return http.StatusForbidden
+	}
+
+	return http.StatusInternalServerError
+}
+
 func MarshalAndPrepareHTTPResponse(task interface{}, rsp http.ResponseWriter) {
 	js, err := json.Marshal(task)
 
@@ -0,0 +1,89 @@
+package taskserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// ConfirmDeleteAll checks that DELETE /task/ carries confirm=true, since it sends every
+// task to the trash at once; the error is meant for a 400 Bad Request.
+func ConfirmDeleteAll(req *http.Request) error {
+	value := req.URL.Query().Get("confirm")
+
+	if confirmed, err := strconv.ParseBool(value); err != nil || !confirmed {
+		return errors.New("DELETE /task/ moves every task to the trash, repeat it with ?confirm=true to go ahead")
+	}
+
+	return nil
+}
+
+// TrashHandler serves GET /trash/, the deleted tasks most recently deleted first (sort,
+// limit and cursor work as for /task/), and POST /trash/<id>/restore.
+func (ts *TaskServer) TrashHandler(rsp http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/trash/" {
+		if req.Method != http.MethodGet {
+			http.Error(rsp,
+				fmt.Sprintf("Expect method GET at /trash/, got %v", req.Method),
+				http.StatusMethodNotAllowed)
+			return
+		}
+
+		ts.getTrashHandler(rsp, req)
+		return
+	}
+
+	pathParts := TrimAndParseRequestPath(*req)
+
+	if len(pathParts) != 3 || pathParts[2] != "restore" {
+		http.Error(rsp, "Expect /trash/ or /trash/<id>/restore", http.StatusNotFound)
+		return
+	}
+
+	id, err := strconv.Atoi(pathParts[1])
+
+	if err != nil {
+		http.Error(rsp, "Expect /trash/<id>/restore in trash handler function", http.StatusBadRequest)
+		return
+	}
+
+	if req.Method != http.MethodPost {
+		http.Error(rsp,
+			fmt.Sprintf("Expect method POST at /trash/<id>/restore, got %v", req.Method),
+			http.StatusMethodNotAllowed)
+		return
+	}
+
+	ts.restoreTaskHandler(rsp, req, id)
+}
+
+func (ts *TaskServer) getTrashHandler(rsp http.ResponseWriter, req *http.Request) {
+	tasks, err := ts.Datastore.GetTrash(req.Context())
+
+	if err != nil {
+		http.Error(rsp, err.Error(), StatusForStoreError(err))
+		return
+	}
+
+	tasks, status, err := PageTasks(rsp, req, tasks, ByDeleted)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), status)
+		return
+	}
+
+	MarshalAndPrepareHTTPResponse(tasks, rsp)
+}
+
+func (ts *TaskServer) restoreTaskHandler(rsp http.ResponseWriter, req *http.Request, id int) {
+	task, err := ts.Datastore.RestoreTask(req.Context(), id)
+
+	if err != nil {
+		http.Error(rsp, err.Error(), StatusForStoreError(err))
+		return
+	}
+
+	rsp.Header().Set("ETag", ETag(task))
+	MarshalAndPrepareHTTPResponse(task, rsp)
+}
@@ -0,0 +1,48 @@
+package taskserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+	_ "time/tzdata" // tz names must resolve even where the system has no zoneinfo database
+
+	"github.com/shien/restserver/taskstore"
+)
+
+// DueZone returns the zone the /due/ endpoints match days in: the IANA zone named by the
+// tz query parameter (e.g. ?tz=Europe/Paris), else the default zone of the request context
+// (see taskstore.WithDefaultZone).
+// It is nil when neither is set, in which case each task's day is taken in the offset its
+// due time was given with.
+func DueZone(req *http.Request) (*time.Location, error) {
+	if name := req.URL.Query().Get("tz"); name != "" {
+		loc, err := time.LoadLocation(name)
+
+		if err != nil {
+			return nil, fmt.Errorf("expect tz as an IANA time zone like Europe/Paris, got %q", name)
+		}
+
+		return loc, nil
+	}
+
+	return taskstore.DefaultZone(req.Context()), nil
+}
+
+// ListTasksDueOn answers GET /due/<year>/<month>/<day>, matching the day in DueZone.
+// On failure it returns the HTTP status code to answer with.
+func ListTasksDueOn(ctx context.Context, store taskstore.Store, req *http.Request, year int, month time.Month, day int) ([]taskstore.Task, int, error) {
+	loc, err := DueZone(req)
+
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	tasks, err := taskstore.GetTaskByDueDateIn(ctx, store, year, month, day, loc)
+
+	if err != nil {
+		return nil, StatusForStoreError(err), err
+	}
+
+	return tasks, http.StatusOK, nil
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"log"
+	"os"
+	"time"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+// checkpoint records how far a migration got, so an interrupted run can resume;
+// tasks are copied in ascending id order, so everything up to LastID is done.
+type checkpoint struct {
+	From    string `json:"from"`
+	FromDir string `json:"fromDir"`
+	LastID  int    `json:"lastId"`
+	Copied  int    `json:"copied"`
+}
+
+func loadCheckpoint(path string) (*checkpoint, error) {
+	data, err := os.ReadFile(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var cp checkpoint
+
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+
+	return &cp, nil
+}
+
+// save replaces the checkpoint file atomically
+func (cp *checkpoint) save(path string) error {
+	data, err := json.Marshal(cp)
+
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// copyTasks streams the tasks of src numbered after cp.LastID, with their history, into dst,
+// saving the checkpoint every batch tasks.
+func copyTasks(ctx context.Context, src, dst taskstore.Migrator, cp *checkpoint, path string, batch int) error {
+	sinceSave := 0
+
+	err := src.ForEachTask(ctx, func(task taskstore.Task) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if task.ID <= cp.LastID {
+			return nil
+		}
+
+		if err := dst.PutTask(ctx, task); err != nil {
+			return fmt.Errorf("copying task %d: %w", task.ID, err)
+		}
+
+		if err := copyHistory(ctx, src, dst, task.ID); err != nil {
+			return fmt.Errorf("copying the history of task %d: %w", task.ID, err)
+		}
+
+		cp.LastID = task.ID
+		cp.Copied++
+		sinceSave++
+
+		if sinceSave == batch {
+			sinceSave = 0
+
+			if err := cp.save(path); err != nil {
+				return err
+			}
+
+			log.Printf("copied %d tasks (up to id %d)", cp.Copied, cp.LastID)
+		}
+
+		return nil
+	})
+
+	// whatever got copied before an error is recorded for the next run
+	if saveErr := cp.save(path); err == nil {
+		err = saveErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	next, err := src.NextID(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return dst.SetNextID(ctx, next)
+}
+
+// summary is what both stores must agree on once the copy is done
+type summary struct {
+	Count    int
+	Checksum string
+	NextID   int
+}
+
+// summarize counts the tasks of store and hashes them, with their history, in id order.
+// Tasks and revisions are hashed in a canonical form, so backends that keep times in
+// another zone or empty tags as nil still agree.
+func summarize(ctx context.Context, store taskstore.Migrator) (summary, error) {
+	var sum summary
+	digest := sha256.New()
+
+	err := store.ForEachTask(ctx, func(task taskstore.Task) error {
+		sum.Count++
+
+		revs, err := store.GetHistory(ctx, task.ID)
+
+		if err != nil {
+			return fmt.Errorf("reading the history of task %d: %w", task.ID, err)
+		}
+
+		return writeCanonical(digest, task, revs)
+	})
+
+	if err != nil {
+		return summary{}, err
+	}
+
+	sum.Checksum = hex.EncodeToString(digest.Sum(nil))
+	sum.NextID, err = store.NextID(ctx)
+
+	return sum, err
+}
+
+// canonicalTask is the form of a task that gets hashed
+type canonicalTask struct {
+	ID          int      `json:"id"`
+	Text        string   `json:"text"`
+	Tags        []string `json:"tags"`
+	Due         string   `json:"due"`
+	Version     int      `json:"version"`
+	Status      string   `json:"status"`
+	CompletedAt string   `json:"completed_at"`
+	DeletedAt   string   `json:"deleted_at"`
+	Owner       string   `json:"owner"`
+}
+
+func canonicalize(task taskstore.Task) canonicalTask {
+	canonical := canonicalTask{
+		ID:      task.ID,
+		Text:    task.Text,
+		Tags:    task.Tags,
+		Due:     canonicalTime(task.Due),
+		Version: task.Version,
+		Status:  string(task.Status),
+		Owner:   task.Owner,
+	}
+
+	if task.CompletedAt != nil {
+		canonical.CompletedAt = canonicalTime(*task.CompletedAt)
+	}
+
+	if task.DeletedAt != nil {
+		canonical.DeletedAt = canonicalTime(*task.DeletedAt)
+	}
+
+	if len(canonical.Tags) == 0 {
+		canonical.Tags = nil
+	}
+
+	return canonical
+}
+
+func canonicalTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// writeCanonical hashes task and its revisions, one JSON line each
+func writeCanonical(digest hash.Hash, task taskstore.Task, revs []taskstore.Revision) error {
+	lines := []interface{}{canonicalize(task)}
+
+	for _, rev := range revs {
+		lines = append(lines, struct {
+			TaskID  int                `json:"task_id"`
+			Number  int                `json:"number"`
+			Action  string             `json:"action"`
+			Author  string             `json:"author"`
+			At      string             `json:"at"`
+			Changes []taskstore.Change `json:"changes"`
+			Task    canonicalTask      `json:"task"`
+		}{rev.TaskID, rev.Number, string(rev.Action), rev.Author, canonicalTime(rev.At), rev.Changes, canonicalize(rev.Task)})
+	}
+
+	for _, line := range lines {
+		data, err := json.Marshal(line)
+
+		if err != nil {
+			return err
+		}
+
+		digest.Write(data)
+		digest.Write([]byte{'\n'})
+	}
+
+	return nil
+}
+
+// verify compares both stores and reports what differs
+func verify(ctx context.Context, src, dst taskstore.Migrator) (summary, error) {
+	want, err := summarize(ctx, src)
+
+	if err != nil {
+		return summary{}, fmt.Errorf("reading source: %w", err)
+	}
+
+	got, err := summarize(ctx, dst)
+
+	if err != nil {
+		return summary{}, fmt.Errorf("reading destination: %w", err)
+	}
+
+	if got.Count != want.Count {
+		return want, fmt.Errorf("destination holds %d tasks, source %d", got.Count, want.Count)
+	}
+
+	if got.Checksum != want.Checksum {
+		return want, fmt.Errorf("checksum mismatch: destination %s, source %s", got.Checksum, want.Checksum)
+	}
+
+	if got.NextID < want.NextID {
+		return want, fmt.Errorf("destination would hand out id %d, source %d", got.NextID, want.NextID)
+	}
+
+	return want, nil
+}
+
+// copyHistory puts the revisions of one task in dst; a revision put again replaces the
+// copy left by an interrupted run.
+func copyHistory(ctx context.Context, src, dst taskstore.Migrator, id int) error {
+	revs, err := src.GetHistory(ctx, id)
+
+	if err != nil {
+		return err
+	}
+
+	for _, rev := range revs {
+		if err := dst.PutRevision(ctx, rev); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
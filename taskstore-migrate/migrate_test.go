@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shien/restserver/taskstore"
+	"github.com/shien/restserver/taskstore/backend"
+)
+
+// fillSource gives src tasks of two owners with a history of updates, the newest of them
+// deleted again
+func fillSource(t *testing.T, src taskstore.Migrator) {
+	ctx := context.Background()
+	zone := time.FixedZone("CEST", 2*60*60)
+
+	for _, owner := range []string{"alice", "bob"} {
+		ownerCtx := taskstore.WithTenant(taskstore.WithAuthor(ctx, owner), taskstore.Tenant{Owner: owner})
+		id, err := src.CreateTask(ownerCtx, "report of "+owner, []string{"work"}, time.Date(2021, time.August, 1, 9, 0, 0, 0, zone))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		task, err := src.GetTask(ownerCtx, id)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		task.Due = task.Due.Add(24 * time.Hour)
+		task.Tags = nil
+		task.Status = taskstore.StatusDone
+
+		if _, err := src.UpdateTask(ownerCtx, task); err != nil {
+			t.Fatal(err)
+		}
+
+		if owner == "bob" {
+			if err := src.DeleteTask(ownerCtx, id, 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestMigrateVerifies(t *testing.T) {
+	kinds := []string{backend.File, backend.SQLite, backend.Bolt}
+
+	for _, from := range kinds {
+		for _, to := range kinds {
+			if from == to {
+				continue
+			}
+
+			from, to := from, to
+
+			t.Run(from+"->"+to, func(t *testing.T) {
+				fromDir, toDir := t.TempDir(), t.TempDir()
+				src, err := openMigrator(from, fromDir)
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				fillSource(t, src)
+				closeStore(src)
+
+				if err := run(context.Background(), from, fromDir, to, toDir, 1); err != nil {
+					t.Fatal(err)
+				}
+
+				dst, err := openMigrator(to, toDir)
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				defer closeStore(dst)
+
+				// the deleted task's id is not handed out again
+				if id, err := dst.CreateTask(context.Background(), "after the migration", nil, time.Now()); err != nil || id != 2 {
+					t.Errorf("CreateTask in the destination = %d, %v; want id 2", id, err)
+				}
+			})
+		}
+	}
+}
+
+// interrupted is a source that fails after handing out its first task
+type interrupted struct {
+	taskstore.Migrator
+}
+
+func (src interrupted) ForEachTask(ctx context.Context, fn func(taskstore.Task) error) error {
+	return src.Migrator.ForEachTask(ctx, func(task taskstore.Task) error {
+		if err := fn(task); err != nil {
+			return err
+		}
+
+		return errors.New("interrupted")
+	})
+}
+
+func TestMigrateResumes(t *testing.T) {
+	ctx := context.Background()
+	fromDir, toDir := t.TempDir(), t.TempDir()
+	src, err := openMigrator(backend.File, fromDir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fillSource(t, src)
+
+	dst, err := openMigrator(backend.SQLite, toDir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(toDir, "taskstore-migrate.checkpoint")
+	cp := &checkpoint{From: backend.File, FromDir: fromDir, LastID: -1}
+
+	if err := copyTasks(ctx, interrupted{src}, dst, cp, path, 1); err == nil {
+		t.Fatal("an interrupted copy succeeded")
+	}
+
+	closeStore(src)
+	closeStore(dst)
+
+	if err := run(ctx, backend.File, t.TempDir(), backend.SQLite, toDir, 1); err == nil {
+		t.Error("migrated another source over the checkpoint of an unfinished migration")
+	}
+
+	if err := run(ctx, backend.File, fromDir, backend.SQLite, toDir, 1); err != nil {
+		t.Fatalf("resuming: %v", err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("the checkpoint is still there after the migration: %v", err)
+	}
+
+	dst, err = openMigrator(backend.SQLite, toDir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer closeStore(dst)
+
+	if tasks, err := dst.GetAllTasks(ctx); err != nil || len(tasks) != 1 {
+		t.Errorf("GetAllTasks after resuming = %v, %v; want the task left in the source", tasks, err)
+	}
+
+	if trash, err := dst.GetTrash(ctx); err != nil || len(trash) != 1 {
+		t.Errorf("GetTrash after resuming = %v, %v; want the deleted task", trash, err)
+	}
+}
+
+func TestVerifyCatchesLostOwners(t *testing.T) {
+	ctx := context.Background()
+	src, err := openMigrator(backend.File, t.TempDir())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer closeStore(src)
+
+	dst, err := openMigrator(backend.SQLite, t.TempDir())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer closeStore(dst)
+
+	fillSource(t, src)
+
+	// copy the tasks and their history, but not their owners
+	err = src.ForEachTask(ctx, func(task taskstore.Task) error {
+		task.Owner = ""
+
+		if err := dst.PutTask(ctx, task); err != nil {
+			return err
+		}
+
+		return copyHistory(ctx, src, dst, task.ID)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := verify(ctx, src, dst); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("verify of a copy without owners: err = %v, want a checksum mismatch", err)
+	}
+}
@@ -0,0 +1,149 @@
+// taskstore-migrate copies every task from one task store backend to another, offline:
+// ids and the id counter are preserved, counts and checksums are compared afterwards,
+// and an interrupted run picks up where it stopped when started again.
+//
+//	taskstore-migrate -from file -from-dir ./data -to sqlite -to-dir ./data
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/shien/restserver/taskstore"
+	"github.com/shien/restserver/taskstore/backend"
+)
+
+func main() {
+	from := flag.String("from", backend.File, "source backend: file, sqlite or bbolt")
+	fromDir := flag.String("from-dir", "", "data directory of the source store")
+	to := flag.String("to", backend.SQLite, "destination backend: file, sqlite or bbolt")
+	toDir := flag.String("to-dir", "", "data directory of the destination store")
+	batch := flag.Int("batch", 500, "tasks copied between two checkpoints")
+	flag.Parse()
+
+	if *fromDir == "" || *toDir == "" {
+		log.Fatal("both -from-dir and -to-dir are required")
+	}
+
+	if *from == *to && filepath.Clean(*fromDir) == filepath.Clean(*toDir) {
+		log.Fatal("source and destination are the same store")
+	}
+
+	if *batch < 1 {
+		*batch = 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, *from, *fromDir, *to, *toDir, *batch); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, from, fromDir, to, toDir string, batch int) error {
+	src, err := openMigrator(from, fromDir)
+
+	if err != nil {
+		return fmt.Errorf("source: %w", err)
+	}
+
+	defer closeStore(src)
+
+	dst, err := openMigrator(to, toDir)
+
+	if err != nil {
+		return fmt.Errorf("destination: %w", err)
+	}
+
+	defer closeStore(dst)
+
+	path := filepath.Join(toDir, "taskstore-migrate.checkpoint")
+
+	cp, err := loadCheckpoint(path)
+
+	if err != nil {
+		return err
+	}
+
+	if cp == nil {
+		if err := expectEmpty(ctx, dst); err != nil {
+			return err
+		}
+
+		cp = &checkpoint{From: from, FromDir: fromDir, LastID: -1}
+	} else if cp.From != from || filepath.Clean(cp.FromDir) != filepath.Clean(fromDir) {
+		return fmt.Errorf("%s belongs to a migration from %s %s; finish that one or delete the checkpoint", path, cp.From, cp.FromDir)
+	} else {
+		log.Printf("resuming after task %d (%d tasks already copied)", cp.LastID, cp.Copied)
+	}
+
+	if err := copyTasks(ctx, src, dst, cp, path, batch); err != nil {
+		return fmt.Errorf("interrupted, run again to resume: %w", err)
+	}
+
+	sum, err := verify(ctx, src, dst)
+
+	if err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+
+	log.Printf("migrated %d tasks from %s to %s, next id %d, sha256 %s", sum.Count, from, to, sum.NextID, sum.Checksum)
+
+	return nil
+}
+
+func openMigrator(kind, dir string) (taskstore.Migrator, error) {
+	if kind == backend.Memory {
+		return nil, fmt.Errorf("the %s store does not outlive the process, there is nothing to migrate", kind)
+	}
+
+	store, err := backend.Open(kind, dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, ok := store.(taskstore.Migrator)
+
+	if !ok {
+		closeStore(store)
+		return nil, fmt.Errorf("the %s store cannot be migrated", kind)
+	}
+
+	return migrator, nil
+}
+
+// expectEmpty refuses to start a fresh migration into a store that already has tasks
+func expectEmpty(ctx context.Context, store taskstore.Migrator) error {
+	err := store.ForEachTask(ctx, func(task taskstore.Task) error {
+		return errNotEmpty
+	})
+
+	if errors.Is(err, errNotEmpty) {
+		return fmt.Errorf("destination already holds tasks; delete them or resume an earlier migration")
+	}
+
+	return err
+}
+
+var errNotEmpty = errors.New("store is not empty")
+
+func closeStore(store taskstore.Store) {
+	if closer, ok := store.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Printf("closing store: %v", err)
+		}
+	}
+}
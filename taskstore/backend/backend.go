@@ -0,0 +1,130 @@
+// Package backend picks the taskstore.Store implementation the server mains run with.
+package backend
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/shien/restserver/taskstore"
+	"github.com/shien/restserver/taskstore/boltstore"
+	"github.com/shien/restserver/taskstore/filestore"
+	"github.com/shien/restserver/taskstore/sqlstore"
+)
+
+// Kinds of store selectable with -store
+const (
+	Memory = "memory"
+	File   = "file"
+	SQLite = "sqlite"
+	Bolt   = "bbolt"
+)
+
+// Flags are the command-line options shared by every server main
+type Flags struct {
+	Kind             string
+	DataDir          string
+	SnapshotInterval time.Duration
+	KeepSnapshots    int
+	RestoreSnapshot  uint64
+	TrashRetention   time.Duration
+}
+
+// trashPurgeInterval is how often Flags.Open's store is checked for tasks to purge
+const trashPurgeInterval = time.Hour
+
+// RegisterFlags defines the store flags on the default command-line flag set;
+// call it before flag.Parse.
+func RegisterFlags() *Flags {
+	f := &Flags{}
+	flag.StringVar(&f.Kind, "store", "", "task store backend: memory, file, sqlite or bbolt; defaults to file when -data-dir is set, memory otherwise")
+	flag.StringVar(&f.DataDir, "data-dir", "", "directory of the durable task store; tasks are kept in memory only when empty")
+	flag.DurationVar(&f.SnapshotInterval, "snapshot-interval", filestore.DefaultOptions.SnapshotInterval, "how often the durable task store is snapshotted and its log compacted; 0 disables it")
+	flag.IntVar(&f.KeepSnapshots, "keep-snapshots", filestore.DefaultOptions.KeepSnapshots, "how many snapshots of the durable task store are kept for -restore-snapshot")
+	flag.Uint64Var(&f.RestoreSnapshot, "restore-snapshot", 0, "restore the durable task store to the snapshot with this sequence number before serving")
+	flag.DurationVar(&f.TrashRetention, "trash-retention", taskstore.DefaultTrashRetention, "how long deleted tasks are kept in the trash before they are purged; 0 keeps them forever")
+
+	return f
+}
+
+// Open returns the store selected by the flags: the in-memory taskstore.TaskStore
+// unless a data directory is set, in which case the durable file store is the default.
+// The store is wrapped in a taskstore.Feed, so its changes can be watched. Unless
+// -trash-retention is 0, the trash of the store is purged in the background for as long
+// as the process runs.
+func (f *Flags) Open() (taskstore.Store, error) {
+	backing, err := f.open()
+
+	if err != nil {
+		return nil, err
+	}
+
+	store := taskstore.NewFeed(backing, taskstore.DefaultFeedOptions)
+
+	if f.TrashRetention > 0 {
+		go taskstore.PurgeTrashEvery(context.Background(), store, f.TrashRetention, trashPurgeInterval)
+	}
+
+	return store, nil
+}
+
+func (f *Flags) open() (taskstore.Store, error) {
+	kind := f.Kind
+
+	if kind == "" {
+		kind = Memory
+
+		if f.DataDir != "" {
+			kind = File
+		}
+	}
+
+	if kind == File && f.DataDir != "" {
+		return f.openFileStore()
+	}
+
+	return Open(kind, f.DataDir)
+}
+
+// Open returns the store of the given kind kept in dataDir, with default options.
+// Every kind but Memory needs a data directory.
+func Open(kind, dataDir string) (taskstore.Store, error) {
+	if kind != Memory && dataDir == "" {
+		return nil, fmt.Errorf("the %s task store needs a data directory", kind)
+	}
+
+	switch kind {
+	case Memory:
+		return taskstore.New(), nil
+	case File:
+		return filestore.Open(dataDir)
+	case SQLite:
+		return sqlstore.Open(filepath.Join(dataDir, "tasks.db"))
+	case Bolt:
+		return boltstore.Open(filepath.Join(dataDir, "tasks.bolt"))
+	default:
+		return nil, fmt.Errorf("unknown task store %q", kind)
+	}
+}
+
+func (f *Flags) openFileStore() (taskstore.Store, error) {
+	store, err := filestore.OpenWithOptions(f.DataDir, filestore.Options{
+		SnapshotInterval: f.SnapshotInterval,
+		KeepSnapshots:    f.KeepSnapshots,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if f.RestoreSnapshot != 0 {
+		if err := store.RestoreSnapshot(f.RestoreSnapshot); err != nil {
+			store.Close()
+			return nil, err
+		}
+	}
+
+	return store, nil
+}
@@ -0,0 +1,932 @@
+// Package boltstore is a taskstore.Store kept in a single bbolt file, an embedded
+// transactional B+tree. Tasks live in one bucket keyed by their big-endian id; tag, due
+// date and status lookups, and full-text searches, are prefix scans over secondary index
+// buckets. Tasks in the trash stay in the tasks bucket, indexed only by when they were
+// deleted. Revisions are kept in their own bucket, written in the same transaction as the
+// change they record.
+package boltstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+// Bucket layout:
+//
+//	tasks:  id                              -> JSON encoded taskstore.Task
+//	tags:   uvarint(len(tag)) tag id        -> empty
+//	due:    YYYY-MM-DD id                   -> empty
+//	dueAt:  due in UTC (dueAtLayout) id     -> empty
+//	status: uvarint(len(status)) status id  -> empty
+//	words:  stem 0x00 id                    -> uvarint(occurrences of the stem in the text)
+//	trash:  deletedAt in UTC (dueAtLayout) id -> empty
+//	history: id number                      -> JSON encoded taskstore.Revision
+//	meta:   "nextId"                        -> next id to hand out
+//
+// ids are 8 byte big-endian so keys sort in id order; tags and statuses are
+// length-prefixed so one is never a prefix of another. Word stems, as taskstore.Stems
+// finds them, have no 0x00 byte, so the words starting with a prefix are a prefix scan;
+// the sequence of the words bucket counts the live tasks indexed.
+var (
+	tasksBucket   = []byte("tasks")
+	tagsBucket    = []byte("tags")
+	dueBucket     = []byte("due")
+	dueAtBucket   = []byte("dueAt")
+	statusBucket  = []byte("status")
+	wordsBucket   = []byte("words")
+	trashBucket   = []byte("trash")
+	historyBucket = []byte("history")
+	metaBucket    = []byte("meta")
+
+	// indexBuckets are derived from tasksBucket and can be rebuilt from it
+	indexBuckets = [][]byte{tagsBucket, dueBucket, dueAtBucket, statusBucket, trashBucket, wordsBucket}
+
+	nextIdKey = []byte("nextId")
+)
+
+const dateLayout = "2006-01-02"
+
+// dueAtLayout is fixed width, so dueAt keys sort in time order
+const dueAtLayout = "2006-01-02T15:04:05.000000000Z"
+
+// BoltStore methods are safe to call concurrently.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+var (
+	_ taskstore.Migrator = (*BoltStore)(nil)
+	_ taskstore.Searcher = (*BoltStore)(nil)
+)
+
+// Open opens (or creates) the database file at path.
+func Open(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		// files written by older versions lack the indexes added since
+		reindex := false
+
+		for _, name := range indexBuckets {
+			reindex = reindex || tx.Bucket(name) == nil
+		}
+
+		for _, name := range [][]byte{tasksBucket, historyBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		if reindex {
+			return rebuildIndexes(tx)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+func (bs *BoltStore) Close() error {
+	return bs.db.Close()
+}
+
+// rebuildIndexes recreates every index bucket from the tasks bucket
+func rebuildIndexes(tx *bolt.Tx) error {
+	for _, name := range indexBuckets {
+		if err := tx.DeleteBucket(name); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+
+		if _, err := tx.CreateBucket(name); err != nil {
+			return err
+		}
+	}
+
+	return tx.Bucket(tasksBucket).ForEach(func(key, value []byte) error {
+		task, err := decodeTask(value)
+
+		if err != nil {
+			return err
+		}
+
+		return putIndexes(tx, task)
+	})
+}
+
+func idKey(id int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+
+	return key
+}
+
+func tagPrefix(tag string) []byte {
+	prefix := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(tag))
+	n := binary.PutUvarint(prefix, uint64(len(tag)))
+
+	return append(prefix[:n], tag...)
+}
+
+func statusPrefix(status taskstore.Status) []byte {
+	return tagPrefix(string(status))
+}
+
+func dueAtPrefix(due time.Time) []byte {
+	return []byte(due.UTC().Format(dueAtLayout))
+}
+
+func duePrefix(due time.Time) []byte {
+	return []byte(due.Format(dateLayout))
+}
+
+func wordKey(stem string, id int) []byte {
+	return indexKey(append([]byte(stem), 0), id)
+}
+
+func indexKey(prefix []byte, id int) []byte {
+	key := make([]byte, 0, len(prefix)+8)
+
+	return append(append(key, prefix...), idKey(id)...)
+}
+
+func (bs *BoltStore) CreateTask(ctx context.Context, text string, tags []string, due time.Time) (int, error) {
+	var id int
+
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+		id = nextID(tx)
+
+		if err := raiseNextID(tx, id+1); err != nil {
+			return err
+		}
+
+		task := taskstore.Task{ID: id, Text: text, Tags: tags, Due: due, Version: 1, Status: taskstore.StatusOpen, Owner: taskstore.TenantOf(ctx).Owner}
+
+		if err := putTask(tx, task); err != nil {
+			return err
+		}
+
+		return recordRevision(ctx, tx, taskstore.ActionCreated, taskstore.Task{}, task, time.Now())
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// putTask stores task and its index entries
+func putTask(tx *bolt.Tx, task taskstore.Task) error {
+	task = taskstore.Upgrade(task)
+	value, err := json.Marshal(task)
+
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Bucket(tasksBucket).Put(idKey(task.ID), value); err != nil {
+		return err
+	}
+
+	return putIndexes(tx, task)
+}
+
+// putIndexes adds the index entries of task: the trash entry alone for a deleted task
+func putIndexes(tx *bolt.Tx, task taskstore.Task) error {
+	if task.DeletedAt != nil {
+		return tx.Bucket(trashBucket).Put(indexKey(dueAtPrefix(*task.DeletedAt), task.ID), nil)
+	}
+
+	for _, tag := range task.Tags {
+		if err := tx.Bucket(tagsBucket).Put(indexKey(tagPrefix(tag), task.ID), nil); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Bucket(statusBucket).Put(indexKey(statusPrefix(task.Status), task.ID), nil); err != nil {
+		return err
+	}
+
+	words := tx.Bucket(wordsBucket)
+
+	for stem, occurrences := range taskstore.Stems(task.Text) {
+		value := make([]byte, binary.MaxVarintLen64)
+
+		if err := words.Put(wordKey(stem, task.ID), value[:binary.PutUvarint(value, uint64(occurrences))]); err != nil {
+			return err
+		}
+	}
+
+	if err := words.SetSequence(words.Sequence() + 1); err != nil {
+		return err
+	}
+
+	if err := tx.Bucket(dueAtBucket).Put(indexKey(dueAtPrefix(task.Due), task.ID), nil); err != nil {
+		return err
+	}
+
+	return tx.Bucket(dueBucket).Put(indexKey(duePrefix(task.Due), task.ID), nil)
+}
+
+// getTask loads a live task; one in the trash is not found
+func getTask(tx *bolt.Tx, id int) (taskstore.Task, error) {
+	task, err := loadTask(tx, id)
+
+	if err == nil && task.DeletedAt != nil {
+		return taskstore.Task{}, taskstore.NotFound(id)
+	}
+
+	return task, err
+}
+
+// loadTask loads a task whether it is live or in the trash
+func loadTask(tx *bolt.Tx, id int) (taskstore.Task, error) {
+	value := tx.Bucket(tasksBucket).Get(idKey(id))
+
+	if value == nil {
+		return taskstore.Task{}, taskstore.NotFound(id)
+	}
+
+	return decodeTask(value)
+}
+
+func decodeTask(value []byte) (taskstore.Task, error) {
+	var task taskstore.Task
+
+	if err := json.Unmarshal(value, &task); err != nil {
+		return taskstore.Task{}, err
+	}
+
+	return taskstore.Upgrade(task), nil
+}
+
+func (bs *BoltStore) GetTask(ctx context.Context, id int) (taskstore.Task, error) {
+	var task taskstore.Task
+
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		var err error
+		task, err = getTask(tx, id)
+
+		return err
+	})
+
+	return task, err
+}
+
+func (bs *BoltStore) UpdateTask(ctx context.Context, task taskstore.Task) (taskstore.Task, error) {
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+		current, err := getTask(tx, task.ID)
+
+		if err != nil {
+			return err
+		}
+
+		if task, err = taskstore.ApplyUpdate(current, task); err != nil {
+			return err
+		}
+
+		if err := deleteTask(tx, task.ID); err != nil {
+			return err
+		}
+
+		if err := putTask(tx, task); err != nil {
+			return err
+		}
+
+		return recordRevision(ctx, tx, taskstore.ActionUpdated, current, task, time.Now())
+	})
+
+	if err != nil {
+		return taskstore.Task{}, err
+	}
+
+	return task, nil
+}
+
+func (bs *BoltStore) DeleteTask(ctx context.Context, id int, version int) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		current, err := getTask(tx, id)
+
+		if err != nil {
+			return err
+		}
+
+		if err := taskstore.CheckVersion(current, version); err != nil {
+			return err
+		}
+
+		return trashTask(ctx, tx, current, time.Now())
+	})
+}
+
+// trashTask moves a live task to the trash
+func trashTask(ctx context.Context, tx *bolt.Tx, task taskstore.Task, at time.Time) error {
+	if err := deleteTask(tx, task.ID); err != nil {
+		return err
+	}
+
+	trashed := taskstore.Trashed(task, at)
+
+	if err := putTask(tx, trashed); err != nil {
+		return err
+	}
+
+	return recordRevision(ctx, tx, taskstore.ActionDeleted, task, trashed, at)
+}
+
+// deleteTask removes the task, live or in the trash, and its index entries
+func deleteTask(tx *bolt.Tx, id int) error {
+	task, err := loadTask(tx, id)
+
+	if err != nil {
+		return err
+	}
+
+	if task.DeletedAt != nil {
+		if err := tx.Bucket(trashBucket).Delete(indexKey(dueAtPrefix(*task.DeletedAt), id)); err != nil {
+			return err
+		}
+
+		return tx.Bucket(tasksBucket).Delete(idKey(id))
+	}
+
+	for _, tag := range task.Tags {
+		if err := tx.Bucket(tagsBucket).Delete(indexKey(tagPrefix(tag), id)); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Bucket(dueBucket).Delete(indexKey(duePrefix(task.Due), id)); err != nil {
+		return err
+	}
+
+	if err := tx.Bucket(statusBucket).Delete(indexKey(statusPrefix(task.Status), id)); err != nil {
+		return err
+	}
+
+	words := tx.Bucket(wordsBucket)
+
+	for stem := range taskstore.Stems(task.Text) {
+		if err := words.Delete(wordKey(stem, id)); err != nil {
+			return err
+		}
+	}
+
+	if err := words.SetSequence(words.Sequence() - 1); err != nil {
+		return err
+	}
+
+	if err := tx.Bucket(dueAtBucket).Delete(indexKey(dueAtPrefix(task.Due), id)); err != nil {
+		return err
+	}
+
+	return tx.Bucket(tasksBucket).Delete(idKey(id))
+}
+
+func (bs *BoltStore) DeleteAllTasks(ctx context.Context) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		tasks, err := liveTasks(tx)
+
+		if err != nil {
+			return err
+		}
+
+		at := time.Now()
+
+		for _, task := range tasks {
+			if err := trashTask(ctx, tx, task, at); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (bs *BoltStore) GetAllTasks(ctx context.Context) ([]taskstore.Task, error) {
+	var tasks []taskstore.Task
+
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		var err error
+		tasks, err = liveTasks(tx)
+
+		return err
+	})
+
+	return tasks, err
+}
+
+// liveTasks loads every task that is not in the trash
+func liveTasks(tx *bolt.Tx) ([]taskstore.Task, error) {
+	var tasks []taskstore.Task
+
+	err := tx.Bucket(tasksBucket).ForEach(func(key, value []byte) error {
+		task, err := decodeTask(value)
+
+		if err != nil {
+			return err
+		}
+
+		if task.DeletedAt == nil {
+			tasks = append(tasks, task)
+		}
+
+		return nil
+	})
+
+	return tasks, err
+}
+
+func (bs *BoltStore) GetTrash(ctx context.Context) ([]taskstore.Task, error) {
+	var tasks []taskstore.Task
+
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(trashBucket).ForEach(func(key, value []byte) error {
+			task, err := loadTask(tx, int(binary.BigEndian.Uint64(key[len(key)-8:])))
+
+			if err != nil {
+				return err
+			}
+
+			tasks = append(tasks, task)
+
+			return nil
+		})
+	})
+
+	taskstore.SortTrash(tasks)
+
+	return tasks, err
+}
+
+func (bs *BoltStore) GetTrashedTask(ctx context.Context, id int) (taskstore.Task, error) {
+	var task taskstore.Task
+
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		var err error
+		task, err = loadTask(tx, id)
+
+		if err == nil && task.DeletedAt == nil {
+			return taskstore.NotFound(id)
+		}
+
+		return err
+	})
+
+	return task, err
+}
+
+func (bs *BoltStore) RestoreTask(ctx context.Context, id int) (taskstore.Task, error) {
+	var task taskstore.Task
+
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+		trashed, err := loadTask(tx, id)
+
+		if err != nil {
+			return err
+		}
+
+		if trashed.DeletedAt == nil {
+			return taskstore.NotFound(id)
+		}
+
+		if err := deleteTask(tx, id); err != nil {
+			return err
+		}
+
+		task = taskstore.Restored(trashed)
+
+		if err := putTask(tx, task); err != nil {
+			return err
+		}
+
+		return recordRevision(ctx, tx, taskstore.ActionRestored, trashed, task, time.Now())
+	})
+
+	if err != nil {
+		return taskstore.Task{}, err
+	}
+
+	return task, nil
+}
+
+// PurgeTrash walks the trash index, which is in deletion order, up to before
+func (bs *BoltStore) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	var ids []int
+
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+		end := dueAtPrefix(before)
+		cursor := tx.Bucket(trashBucket).Cursor()
+
+		for key, _ := cursor.First(); key != nil && bytes.Compare(key, end) < 0; key, _ = cursor.Next() {
+			ids = append(ids, int(binary.BigEndian.Uint64(key[len(key)-8:])))
+		}
+
+		for _, id := range ids {
+			if err := deleteTask(tx, id); err != nil {
+				return err
+			}
+
+			if err := deleteHistory(tx, id); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(ids), nil
+}
+
+func (bs *BoltStore) GetHistory(ctx context.Context, id int) ([]taskstore.Revision, error) {
+	revs := []taskstore.Revision{}
+
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		if _, err := loadTask(tx, id); err != nil {
+			return err
+		}
+
+		cursor := tx.Bucket(historyBucket).Cursor()
+		prefix := idKey(id)
+
+		for key, value := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, value = cursor.Next() {
+			var rev taskstore.Revision
+
+			if err := json.Unmarshal(value, &rev); err != nil {
+				return err
+			}
+
+			revs = append(revs, rev)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return revs, nil
+}
+
+func (bs *BoltStore) RevertTask(ctx context.Context, id int, number int, version int) (taskstore.Task, error) {
+	var task taskstore.Task
+
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+		current, err := getTask(tx, id)
+
+		if err != nil {
+			return err
+		}
+
+		value := tx.Bucket(historyBucket).Get(append(idKey(id), idKey(number)...))
+
+		if value == nil {
+			return taskstore.RevisionNotFound(id, number)
+		}
+
+		var rev taskstore.Revision
+
+		if err := json.Unmarshal(value, &rev); err != nil {
+			return err
+		}
+
+		if task, err = taskstore.ApplyRevert(current, rev, version); err != nil {
+			return err
+		}
+
+		if err := deleteTask(tx, id); err != nil {
+			return err
+		}
+
+		if err := putTask(tx, task); err != nil {
+			return err
+		}
+
+		return recordRevision(ctx, tx, taskstore.ActionReverted, current, task, time.Now())
+	})
+
+	if err != nil {
+		return taskstore.Task{}, err
+	}
+
+	return task, nil
+}
+
+func (bs *BoltStore) PutRevision(ctx context.Context, rev taskstore.Revision) error {
+	if err := taskstore.CheckRevision(rev); err != nil {
+		return err
+	}
+
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		return putRevision(tx, rev)
+	})
+}
+
+// recordRevision adds the revision of a change made in tx, numbered after the last one
+func recordRevision(ctx context.Context, tx *bolt.Tx, action taskstore.Action, before, after taskstore.Task, at time.Time) error {
+	rev := taskstore.NewRevision(ctx, action, before, after, at)
+	rev.Number = 1
+
+	// the last revision of the task is the one before the first key of the next id
+	cursor := tx.Bucket(historyBucket).Cursor()
+	key, _ := cursor.Seek(idKey(rev.TaskID + 1))
+
+	if key == nil {
+		key, _ = cursor.Last()
+	} else {
+		key, _ = cursor.Prev()
+	}
+
+	if key != nil && bytes.HasPrefix(key, idKey(rev.TaskID)) {
+		rev.Number = int(binary.BigEndian.Uint64(key[8:])) + 1
+	}
+
+	return putRevision(tx, rev)
+}
+
+func putRevision(tx *bolt.Tx, rev taskstore.Revision) error {
+	value, err := json.Marshal(rev)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(historyBucket).Put(append(idKey(rev.TaskID), idKey(rev.Number)...), value)
+}
+
+// deleteHistory removes every revision of the task with id
+func deleteHistory(tx *bolt.Tx, id int) error {
+	cursor := tx.Bucket(historyBucket).Cursor()
+	prefix := idKey(id)
+
+	for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Seek(prefix) {
+		if err := cursor.Delete(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (bs *BoltStore) PutTask(ctx context.Context, task taskstore.Task) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		if err := deleteTask(tx, task.ID); err != nil && !errors.Is(err, taskstore.ErrNotFound) {
+			return err
+		}
+
+		if err := putTask(tx, task); err != nil {
+			return err
+		}
+
+		return raiseNextID(tx, task.ID+1)
+	})
+}
+
+func (bs *BoltStore) NextID(ctx context.Context) (int, error) {
+	var next int
+
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		next = nextID(tx)
+
+		return nil
+	})
+
+	return next, err
+}
+
+func (bs *BoltStore) SetNextID(ctx context.Context, next int) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		return raiseNextID(tx, next)
+	})
+}
+
+func nextID(tx *bolt.Tx) int {
+	if next := tx.Bucket(metaBucket).Get(nextIdKey); next != nil {
+		return int(binary.BigEndian.Uint64(next))
+	}
+
+	return 0
+}
+
+func raiseNextID(tx *bolt.Tx, next int) error {
+	if next <= nextID(tx) {
+		return nil
+	}
+
+	return tx.Bucket(metaBucket).Put(nextIdKey, idKey(next))
+}
+
+// ForEachTask reads the tasks a page at a time so fn never runs inside a transaction
+func (bs *BoltStore) ForEachTask(ctx context.Context, fn func(taskstore.Task) error) error {
+	const pageSize = 500
+
+	var from []byte
+
+	for {
+		var page []taskstore.Task
+
+		err := bs.db.View(func(tx *bolt.Tx) error {
+			cursor := tx.Bucket(tasksBucket).Cursor()
+
+			key, value := cursor.First()
+
+			if from != nil {
+				key, value = cursor.Seek(from)
+			}
+
+			for ; key != nil && len(page) < pageSize; key, value = cursor.Next() {
+				task, err := decodeTask(value)
+
+				if err != nil {
+					return err
+				}
+
+				page = append(page, task)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+
+		for _, task := range page {
+			if err := fn(task); err != nil {
+				return err
+			}
+		}
+
+		if len(page) < pageSize {
+			return nil
+		}
+
+		from = idKey(page[len(page)-1].ID + 1)
+	}
+}
+
+func (bs *BoltStore) GetTaskByTag(ctx context.Context, tag string) ([]taskstore.Task, error) {
+	return bs.scanIndex(tagsBucket, tagPrefix(tag))
+}
+
+func (bs *BoltStore) GetTaskByDueDate(ctx context.Context, year int, month time.Month, day int) ([]taskstore.Task, error) {
+	return bs.scanIndex(dueBucket, duePrefix(time.Date(year, month, day, 0, 0, 0, 0, time.UTC)))
+}
+
+func (bs *BoltStore) GetTaskByStatus(ctx context.Context, status taskstore.Status) ([]taskstore.Task, error) {
+	return bs.scanIndex(statusBucket, statusPrefix(status))
+}
+
+func (bs *BoltStore) GetTaskByDueRange(ctx context.Context, from, to time.Time, bounds taskstore.Bounds) ([]taskstore.Task, error) {
+	var tasks []taskstore.Task
+
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(dueAtBucket).Cursor()
+
+		key, _ := cursor.First()
+
+		if !from.IsZero() {
+			start := dueAtPrefix(from)
+			key, _ = cursor.Seek(start)
+
+			for !bounds.IncludeFrom && key != nil && bytes.Equal(key[:len(key)-8], start) {
+				key, _ = cursor.Next()
+			}
+		}
+
+		var end []byte
+
+		if !to.IsZero() {
+			end = dueAtPrefix(to)
+		}
+
+		// keys are the due time followed by the 8 byte id, the range bounds only the due time
+		inRange := func(key []byte) bool {
+			if end == nil {
+				return true
+			}
+
+			cmp := bytes.Compare(key[:len(key)-8], end)
+
+			return cmp < 0 || (cmp == 0 && bounds.IncludeTo)
+		}
+
+		for ; key != nil && inRange(key); key, _ = cursor.Next() {
+			task, err := getTask(tx, int(binary.BigEndian.Uint64(key[len(key)-8:])))
+
+			if err != nil {
+				return err
+			}
+
+			tasks = append(tasks, task)
+		}
+
+		return nil
+	})
+
+	return tasks, err
+}
+
+// SearchTasks ranks the live tasks through the words bucket, as a taskstore.TextIndex of
+// them would
+func (bs *BoltStore) SearchTasks(ctx context.Context, query string, limit int) ([]taskstore.SearchResult, error) {
+	var results []taskstore.SearchResult
+
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		words := tx.Bucket(wordsBucket)
+
+		hits, err := taskstore.Rank(query, int(words.Sequence()), func(prefix string) (taskstore.Postings, error) {
+			postings := make(taskstore.Postings)
+			cursor := words.Cursor()
+
+			for key, value := cursor.Seek([]byte(prefix)); key != nil && bytes.HasPrefix(key, []byte(prefix)); key, value = cursor.Next() {
+				stem := string(key[:len(key)-9])
+				occurrences, _ := binary.Uvarint(value)
+
+				if postings[stem] == nil {
+					postings[stem] = make(map[int]int)
+				}
+
+				postings[stem][int(binary.BigEndian.Uint64(key[len(key)-8:]))] = int(occurrences)
+			}
+
+			return postings, nil
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if limit > 0 && len(hits) > limit {
+			hits = hits[:limit]
+		}
+
+		tasks := make(map[int]taskstore.Task, len(hits))
+
+		for _, hit := range hits {
+			if tasks[hit.ID], err = getTask(tx, hit.ID); err != nil {
+				return err
+			}
+		}
+
+		results = taskstore.Results(hits, query, 0, func(id int) taskstore.Task { return tasks[id] })
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// scanIndex loads the tasks whose keys in the index bucket start with prefix
+func (bs *BoltStore) scanIndex(bucket, prefix []byte) ([]taskstore.Task, error) {
+	var tasks []taskstore.Task
+
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(bucket).Cursor()
+
+		for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Next() {
+			if len(key) != len(prefix)+8 {
+				continue
+			}
+
+			task, err := getTask(tx, int(binary.BigEndian.Uint64(key[len(prefix):])))
+
+			if err != nil {
+				return err
+			}
+
+			tasks = append(tasks, task)
+		}
+
+		return nil
+	})
+
+	return tasks, err
+}
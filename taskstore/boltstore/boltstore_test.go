@@ -0,0 +1,36 @@
+package boltstore_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/shien/restserver/taskstore"
+	"github.com/shien/restserver/taskstore/boltstore"
+	"github.com/shien/restserver/taskstore/storetest"
+)
+
+// open opens a new store in a directory removed after the test
+func open(tb testing.TB) taskstore.Store {
+	store, err := boltstore.Open(filepath.Join(tb.TempDir(), "tasks.bolt"))
+
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	tb.Cleanup(func() { store.Close() })
+
+	return store
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) taskstore.Store { return open(t) })
+}
+
+func TestConcurrent(t *testing.T) {
+	storetest.RunConcurrent(t, func(t *testing.T) taskstore.Store { return open(t) })
+}
+
+// BenchmarkParallel compares parallel reads and writes with the same calls serialized
+func BenchmarkParallel(b *testing.B) {
+	storetest.BenchmarkParallel(b, func(b *testing.B) taskstore.Store { return open(b) })
+}
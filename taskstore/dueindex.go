@@ -0,0 +1,88 @@
+package taskstore
+
+import (
+	"sort"
+	"time"
+)
+
+type dueEntry struct {
+	due time.Time
+	id  int
+}
+
+func (e dueEntry) before(due time.Time, id int) bool {
+	return e.due.Before(due) || (e.due.Equal(due) && e.id < id)
+}
+
+// Bounds tells which ends of a due range belong to it.
+type Bounds struct {
+	IncludeFrom bool
+	IncludeTo   bool
+}
+
+// HalfOpen is the range [from, to): tasks due at from are in it, tasks due at to are not.
+var HalfOpen = Bounds{IncludeFrom: true}
+
+// DueIndex keeps task ids ordered by due time (then id), so range queries are
+// a binary search instead of a scan over every task. The zero value is empty;
+// concurrent Between calls are safe, but Insert, Remove and Reset need exclusive access.
+type DueIndex struct {
+	entries []dueEntry
+}
+
+// search returns the position of the first entry not before (due, id)
+func (ix *DueIndex) search(due time.Time, id int) int {
+	return sort.Search(len(ix.entries), func(i int) bool { return !ix.entries[i].before(due, id) })
+}
+
+func (ix *DueIndex) Insert(due time.Time, id int) {
+	i := ix.search(due, id)
+
+	ix.entries = append(ix.entries, dueEntry{})
+	copy(ix.entries[i+1:], ix.entries[i:])
+	ix.entries[i] = dueEntry{due: due, id: id}
+}
+
+func (ix *DueIndex) Remove(due time.Time, id int) {
+	i := ix.search(due, id)
+
+	if i < len(ix.entries) && ix.entries[i].id == id && ix.entries[i].due.Equal(due) {
+		ix.entries = append(ix.entries[:i], ix.entries[i+1:]...)
+	}
+}
+
+func (ix *DueIndex) Reset() {
+	ix.entries = nil
+}
+
+// Between returns the ids of the tasks due from from to to in due order, with the ends
+// included as bounds tells; a zero from or to leaves that end of the range open.
+func (ix *DueIndex) Between(from, to time.Time, bounds Bounds) []int {
+	start, end := 0, len(ix.entries)
+
+	if !from.IsZero() {
+		start = ix.searchDue(from, bounds.IncludeFrom)
+	}
+
+	if !to.IsZero() {
+		end = ix.searchDue(to, !bounds.IncludeTo)
+	}
+
+	var ids []int
+
+	for i := start; i < end; i++ {
+		ids = append(ids, ix.entries[i].id)
+	}
+
+	return ids
+}
+
+// searchDue returns the position of the first entry due at or after due, or the first
+// one due after it when atOrAfter is false
+func (ix *DueIndex) searchDue(due time.Time, atOrAfter bool) int {
+	if atOrAfter {
+		return sort.Search(len(ix.entries), func(i int) bool { return !ix.entries[i].due.Before(due) })
+	}
+
+	return sort.Search(len(ix.entries), func(i int) bool { return ix.entries[i].due.After(due) })
+}
@@ -0,0 +1,408 @@
+package taskstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// EventType is the kind of change an Event announces
+type EventType string
+
+const (
+	// EventCreated announces a new task, or one restored from the trash
+	EventCreated EventType = "created"
+	// EventUpdated announces a change of a live task, reverts included
+	EventUpdated EventType = "updated"
+	// EventDeleted announces a task moved to the trash
+	EventDeleted EventType = "deleted"
+)
+
+// eventTypes maps the actions of the revisions to the events they are published as
+var eventTypes = map[Action]EventType{
+	ActionCreated:  EventCreated,
+	ActionRestored: EventCreated,
+	ActionUpdated:  EventUpdated,
+	ActionReverted: EventUpdated,
+	ActionDeleted:  EventDeleted,
+}
+
+// Event is a change of a task published by a Feed
+type Event struct {
+	// Seq numbers the events of a feed in the order they happened, without gaps but
+	// for those a subscription does not keep (see Feed.SubscribeFunc)
+	Seq  uint64    `json:"seq"`
+	Type EventType `json:"type"`
+	// Task is the task as the change left it; a deleted one carries its DeletedAt
+	Task   Task      `json:"task"`
+	Author string    `json:"author,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// ErrEventsLost is returned (wrapped) when a subscriber cannot be sent every event it
+// asked for: Feed.Subscribe returns it for a sequence number whose events are no longer
+// kept, and Subscription.Err once a subscriber fell too far behind. Either way the
+// subscriber has to read the tasks again and subscribe from there; check for it with
+// errors.Is.
+var ErrEventsLost = errors.New("events lost")
+
+// FeedOptions size the buffers of a Feed
+type FeedOptions struct {
+	// Backlog is how many of the latest events are kept for subscribers resuming after
+	// a sequence number.
+	Backlog int
+
+	// Buffer is how many events a subscriber may fall behind before it is dropped
+	Buffer int
+}
+
+var DefaultFeedOptions = FeedOptions{
+	Backlog: 1024,
+	Buffer:  64,
+}
+
+// Watcher is a Store that publishes its changes, like Feed
+type Watcher interface {
+	Store
+
+	// Subscribe sends the events published after the sequence number after to the
+	// subscription until ctx is done; 0 is the latest event.
+	Subscribe(ctx context.Context, after uint64) (*Subscription, error)
+
+	// SubscribeFunc is Subscribe for the events keep returns true for, all of them for
+	// a nil keep
+	SubscribeFunc(ctx context.Context, after uint64, keep func(Event) bool) (*Subscription, error)
+
+	// Seq returns the sequence number of the latest event, to subscribe after later
+	Seq() uint64
+}
+
+// Feed is a Store that publishes an Event for every create, update, delete, restore and
+// revert made through it. Mutations are serialized so events come in the order they were
+// made; reads go straight to the wrapped store. Publishing never waits for subscribers.
+//
+// Sequence numbers start from the time the feed was created, in nanoseconds, so they
+// keep growing across restarts and a subscriber resuming from before is told it lost events.
+type Feed struct {
+	Store
+
+	opts FeedOptions
+
+	mu      sync.Mutex // serializes mutations and guards the fields below
+	start   uint64     // sequence number before the first event
+	seq     uint64     // sequence number of the latest event
+	backlog []Event    // the latest events, the one numbered seq at backlog[seq%len(backlog)]
+	subs    map[*Subscription]struct{}
+}
+
+var (
+	_ Watcher  = (*Feed)(nil)
+	_ Searcher = (*Feed)(nil)
+)
+
+// NewFeed returns a Feed publishing the changes made to store through it
+func NewFeed(store Store, opts FeedOptions) *Feed {
+	if opts.Backlog < 1 {
+		opts.Backlog = 1
+	}
+
+	start := uint64(time.Now().UnixNano())
+
+	return &Feed{
+		Store:   store,
+		opts:    opts,
+		start:   start,
+		seq:     start,
+		backlog: make([]Event, opts.Backlog),
+		subs:    make(map[*Subscription]struct{}),
+	}
+}
+
+// Seq returns the sequence number of the latest event, to subscribe after later
+func (f *Feed) Seq() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.seq
+}
+
+// Subscription receives the events of a Feed; see Feed.Subscribe
+type Subscription struct {
+	feed   *Feed
+	after  uint64
+	keep   func(Event) bool // nil keeps every event
+	events chan Event
+	done   chan struct{} // closed once the subscription is dropped
+	err    error         // why it was dropped, guarded by feed.mu
+}
+
+// Events returns the channel the events are sent on, closed once the subscription ends
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// After returns the sequence number the subscription sends the events after
+func (s *Subscription) After() uint64 {
+	return s.after
+}
+
+// Err returns why the subscription ended: the error of its context, an error wrapping
+// ErrEventsLost when the subscriber fell behind, or nil after Close.
+func (s *Subscription) Err() error {
+	s.feed.mu.Lock()
+	defer s.feed.mu.Unlock()
+
+	return s.err
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() {
+	s.feed.drop(s, nil)
+}
+
+// Subscribe sends the events published after the sequence number after, 0 for the
+// latest one, until ctx is done or the subscription is closed. The events already
+// published are sent first; a subscriber that falls more than FeedOptions.Buffer events
+// behind is dropped with ErrEventsLost.
+func (f *Feed) Subscribe(ctx context.Context, after uint64) (*Subscription, error) {
+	return f.SubscribeFunc(ctx, after, nil)
+}
+
+// SubscribeFunc is Subscribe for the events keep returns true for; keep is called with
+// the feed locked, and must not call it. The subscription falls behind on kept events only.
+func (f *Feed) SubscribeFunc(ctx context.Context, after uint64, keep func(Event) bool) (*Subscription, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if after == 0 {
+		after = f.seq
+	}
+
+	missed, err := f.since(after)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &Subscription{
+		feed:   f,
+		after:  after,
+		keep:   keep,
+		events: make(chan Event, f.opts.Buffer+len(missed)),
+		done:   make(chan struct{}),
+	}
+
+	for _, event := range missed {
+		if sub.keeps(event) {
+			sub.events <- event
+		}
+	}
+
+	f.subs[sub] = struct{}{}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			f.drop(sub, ctx.Err())
+		case <-sub.done:
+		}
+	}()
+
+	return sub, nil
+}
+
+// since returns the events published after the sequence number after; f.mu is held
+func (f *Feed) since(after uint64) ([]Event, error) {
+	oldest := f.start + 1
+
+	if kept := uint64(len(f.backlog)); f.seq-f.start > kept {
+		oldest = f.seq - kept + 1
+	}
+
+	if after > f.seq || after+1 < oldest {
+		return nil, fmt.Errorf("events after %d are not kept, the feed has %d to %d: %w", after, oldest, f.seq, ErrEventsLost)
+	}
+
+	events := make([]Event, 0, f.seq-after)
+
+	for seq := after + 1; seq <= f.seq; seq++ {
+		events = append(events, f.backlog[seq%uint64(len(f.backlog))])
+	}
+
+	return events, nil
+}
+
+func (s *Subscription) keeps(event Event) bool {
+	return s.keep == nil || s.keep(event)
+}
+
+func (f *Feed) drop(sub *Subscription, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.dropLocked(sub, err)
+}
+
+func (f *Feed) dropLocked(sub *Subscription, err error) {
+	if _, ok := f.subs[sub]; !ok {
+		return
+	}
+
+	delete(f.subs, sub)
+	sub.err = err
+	close(sub.events)
+	close(sub.done)
+}
+
+// publish sends the latest revision of the task id as an event; f.mu is held
+func (f *Feed) publish(id int) {
+	// the change is made, the event must not depend on the caller's context any longer
+	revs, err := f.Store.GetHistory(context.Background(), id)
+
+	if err == nil && len(revs) == 0 {
+		err = fmt.Errorf("task with id = %d has no history", id)
+	}
+
+	if err != nil {
+		log.Printf("taskstore: cannot publish the change of task %d: %v", id, err)
+
+		for sub := range f.subs {
+			f.dropLocked(sub, fmt.Errorf("the change of task %d could not be published: %w", id, ErrEventsLost))
+		}
+
+		// nobody may resume from before the missing event either
+		f.seq++
+		f.start = f.seq
+
+		return
+	}
+
+	rev := revs[len(revs)-1]
+
+	f.seq++
+	event := Event{Seq: f.seq, Type: eventTypes[rev.Action], Task: rev.Task, Author: rev.Author, At: rev.At}
+	f.backlog[f.seq%uint64(len(f.backlog))] = event
+
+	for sub := range f.subs {
+		if !sub.keeps(event) {
+			continue
+		}
+
+		select {
+		case sub.events <- event:
+		default:
+			f.dropLocked(sub, fmt.Errorf("subscriber fell %d events behind at %d: %w", cap(sub.events), f.seq, ErrEventsLost))
+		}
+	}
+}
+
+func (f *Feed) CreateTask(ctx context.Context, text string, tags []string, due time.Time) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id, err := f.Store.CreateTask(ctx, text, tags, due)
+
+	if err != nil {
+		return 0, err
+	}
+
+	f.publish(id)
+
+	return id, nil
+}
+
+func (f *Feed) UpdateTask(ctx context.Context, task Task) (Task, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	task, err := f.Store.UpdateTask(ctx, task)
+
+	if err != nil {
+		return Task{}, err
+	}
+
+	f.publish(task.ID)
+
+	return task, nil
+}
+
+func (f *Feed) DeleteTask(ctx context.Context, id int, version int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.Store.DeleteTask(ctx, id, version); err != nil {
+		return err
+	}
+
+	f.publish(id)
+
+	return nil
+}
+
+// DeleteAllTasks publishes the deletion of every task that was live
+func (f *Feed) DeleteAllTasks(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	tasks, err := f.Store.GetAllTasks(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if err := f.Store.DeleteAllTasks(ctx); err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		f.publish(task.ID)
+	}
+
+	return nil
+}
+
+func (f *Feed) RestoreTask(ctx context.Context, id int) (Task, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	task, err := f.Store.RestoreTask(ctx, id)
+
+	if err != nil {
+		return Task{}, err
+	}
+
+	f.publish(id)
+
+	return task, nil
+}
+
+func (f *Feed) RevertTask(ctx context.Context, id int, number int, version int) (Task, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	task, err := f.Store.RevertTask(ctx, id, number, version)
+
+	if err != nil {
+		return Task{}, err
+	}
+
+	f.publish(id)
+
+	return task, nil
+}
+
+// PurgeTrash publishes nothing, the purged tasks were deleted already
+func (f *Feed) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.Store.PurgeTrash(ctx, before)
+}
+
+// SearchTasks searches the wrapped store, through its own index when it is a Searcher
+func (f *Feed) SearchTasks(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	return Search(ctx, f.Store, query, limit)
+}
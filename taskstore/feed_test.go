@@ -0,0 +1,275 @@
+package taskstore_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+// receive returns the next event of sub, which the feed sent before returning from the
+// change that published it
+func receive(t *testing.T, sub *taskstore.Subscription) taskstore.Event {
+	t.Helper()
+
+	select {
+	case event, ok := <-sub.Events():
+		if !ok {
+			t.Fatalf("the subscription ended: %v", sub.Err())
+		}
+
+		return event
+	default:
+		t.Fatal("no event was sent")
+	}
+
+	return taskstore.Event{}
+}
+
+func TestFeedResumes(t *testing.T) {
+	ctx := context.Background()
+	feed := taskstore.NewFeed(taskstore.New(), taskstore.DefaultFeedOptions)
+	first, err := feed.CreateTask(ctx, "first", nil, time.Now())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after := feed.Seq()
+	second, err := feed.CreateTask(ctx, "second", nil, time.Now())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := feed.UpdateTask(ctx, taskstore.Task{ID: second, Text: "second, updated"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := feed.DeleteTask(ctx, first, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := feed.RestoreTask(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := feed.Subscribe(ctx, after)
+
+	if err != nil {
+		t.Fatalf("Subscribe(%d): %v", after, err)
+	}
+
+	defer sub.Close()
+
+	want := []struct {
+		typ taskstore.EventType
+		id  int
+	}{
+		{taskstore.EventCreated, second},
+		{taskstore.EventUpdated, second},
+		{taskstore.EventDeleted, first},
+		{taskstore.EventCreated, first},
+	}
+
+	for i, w := range want {
+		event := receive(t, sub)
+
+		if event.Seq != after+uint64(i)+1 || event.Type != w.typ || event.Task.ID != w.id {
+			t.Errorf("event %d = %d %s of task %d, want %d %s of task %d", i, event.Seq, event.Type, event.Task.ID, after+uint64(i)+1, w.typ, w.id)
+		}
+
+		if deleted := event.Task.DeletedAt != nil; deleted != (w.typ == taskstore.EventDeleted) {
+			t.Errorf("event %d carries DeletedAt %v", i, event.Task.DeletedAt)
+		}
+	}
+
+	// then the events published from now on
+	if _, err := feed.CreateTask(ctx, "third", nil, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	if event := receive(t, sub); event.Seq != feed.Seq() || event.Task.Text != "third" {
+		t.Errorf("live event = %+v, want the third task as event %d", event, feed.Seq())
+	}
+}
+
+func TestFeedBacklogRollsOver(t *testing.T) {
+	ctx := context.Background()
+	feed := taskstore.NewFeed(taskstore.New(), taskstore.FeedOptions{Backlog: 2, Buffer: 8})
+	start := feed.Seq()
+
+	for _, text := range []string{"first", "second", "third"} {
+		if _, err := feed.CreateTask(ctx, text, nil, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the first event no longer is kept, nor will any event from the future be
+	for _, after := range []uint64{start, start + 4} {
+		if _, err := feed.Subscribe(ctx, after); !errors.Is(err, taskstore.ErrEventsLost) {
+			t.Errorf("Subscribe(start+%d): err = %v, want ErrEventsLost", after-start, err)
+		}
+	}
+
+	sub, err := feed.Subscribe(ctx, start+1)
+
+	if err != nil {
+		t.Fatalf("Subscribe(start+1): %v", err)
+	}
+
+	defer sub.Close()
+
+	var texts []string
+
+	for i := 0; i < 2; i++ {
+		texts = append(texts, receive(t, sub).Task.Text)
+	}
+
+	if fmt.Sprint(texts) != "[second third]" {
+		t.Errorf("events kept = %v, want [second third]", texts)
+	}
+}
+
+func TestFeedDropsSlowSubscribers(t *testing.T) {
+	ctx := context.Background()
+	feed := taskstore.NewFeed(taskstore.New(), taskstore.FeedOptions{Backlog: 8, Buffer: 1})
+	slow, err := feed.Subscribe(ctx, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, text := range []string{"first", "second"} {
+		if _, err := feed.CreateTask(ctx, text, nil, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the buffered event still arrives, then the subscription ends
+	if event := receive(t, slow); event.Task.Text != "first" {
+		t.Errorf("buffered event = %+v, want the first task", event)
+	}
+
+	if _, ok := <-slow.Events(); ok {
+		t.Error("a subscriber that fell behind still gets events")
+	}
+
+	if err := slow.Err(); !errors.Is(err, taskstore.ErrEventsLost) {
+		t.Errorf("Err() = %v, want ErrEventsLost", err)
+	}
+
+	// a subscription ends with its context too
+	cctx, cancel := context.WithCancel(ctx)
+	sub, err := feed.Subscribe(cctx, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+
+	for range sub.Events() {
+	}
+
+	if err := sub.Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Err() after cancel = %v, want context.Canceled", err)
+	}
+}
+
+// flakyHistory is a store whose history cannot be read while fail is set
+type flakyHistory struct {
+	*taskstore.TaskStore
+	fail bool
+}
+
+func (s *flakyHistory) GetHistory(ctx context.Context, id int) ([]taskstore.Revision, error) {
+	if s.fail {
+		return nil, errors.New("history unavailable")
+	}
+
+	return s.TaskStore.GetHistory(ctx, id)
+}
+
+func TestFeedResetsOnPublishFailure(t *testing.T) {
+	ctx := context.Background()
+	store := &flakyHistory{TaskStore: taskstore.New()}
+	feed := taskstore.NewFeed(store, taskstore.DefaultFeedOptions)
+
+	if _, err := feed.CreateTask(ctx, "published", nil, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	before := feed.Seq()
+	sub, err := feed.Subscribe(ctx, before)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.fail = true
+
+	if _, err := feed.CreateTask(ctx, "unpublished", nil, time.Now()); err != nil {
+		t.Fatalf("CreateTask with the event failing: %v", err)
+	}
+
+	store.fail = false
+
+	if _, ok := <-sub.Events(); ok || !errors.Is(sub.Err(), taskstore.ErrEventsLost) {
+		t.Errorf("subscription after the lost event: open %v, Err() = %v; want it dropped with ErrEventsLost", ok, sub.Err())
+	}
+
+	// resuming from before the lost event would skip it
+	if _, err := feed.Subscribe(ctx, before); !errors.Is(err, taskstore.ErrEventsLost) {
+		t.Errorf("Subscribe from before the lost event: err = %v, want ErrEventsLost", err)
+	}
+
+	sub, err = feed.Subscribe(ctx, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer sub.Close()
+
+	if _, err := feed.CreateTask(ctx, "published again", nil, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	if event := receive(t, sub); event.Seq != feed.Seq() || event.Task.Text != "published again" {
+		t.Errorf("event after the reset = %+v", event)
+	}
+}
+
+// noScan is a store that keeps a search index but fails to list its tasks
+type noScan struct {
+	*taskstore.TaskStore
+}
+
+func (noScan) GetAllTasks(ctx context.Context) ([]taskstore.Task, error) {
+	return nil, errors.New("scanned every task")
+}
+
+func TestFeedSearchUsesIndex(t *testing.T) {
+	ctx := context.Background()
+	feed := taskstore.NewFeed(noScan{taskstore.New()}, taskstore.DefaultFeedOptions)
+
+	id, err := feed.CreateTask(ctx, "Write the quarterly report", nil, time.Now())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := taskstore.Search(ctx, feed, "report", 0)
+
+	if err != nil {
+		t.Fatalf("Search through a Feed: %v", err)
+	}
+
+	if len(results) != 1 || results[0].Task.ID != id {
+		t.Errorf("Search through a Feed = %+v, want task %d", results, id)
+	}
+}
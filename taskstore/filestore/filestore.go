@@ -0,0 +1,555 @@
+// Package filestore provides a durable taskstore.Store: tasks are served from an
+// in-memory taskstore.TaskStore and every mutation is appended to a write-ahead log.
+// The whole store is snapshotted from time to time so the log can be truncated;
+// on startup the newest valid snapshot is loaded and only the log tail is replayed.
+package filestore
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+// Options tune how often the store is snapshotted and how much history is kept
+type Options struct {
+	// SnapshotInterval is how often a snapshot is taken in the background when the log
+	// has grown since the previous one; zero disables background snapshots.
+	SnapshotInterval time.Duration
+
+	// KeepSnapshots is how many snapshots are kept around for RestoreSnapshot and to
+	// fall back to when the newest one is corrupt; the newest one is always kept. The log
+	// is kept from the oldest of them on.
+	KeepSnapshots int
+}
+
+var DefaultOptions = Options{
+	SnapshotInterval: 5 * time.Minute,
+	KeepSnapshots:    3,
+}
+
+// FileStore methods are safe to call concurrently.
+type FileStore struct {
+	mu      sync.Mutex // serializes mutations so the log order matches the in-memory order
+	dir     string
+	opts    Options
+	mem     *taskstore.TaskStore
+	log     *wal
+	snapSeq uint64 // last log record covered by the newest snapshot
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+var _ taskstore.Migrator = (*FileStore)(nil)
+var _ taskstore.Searcher = (*FileStore)(nil)
+
+// Open loads the store kept in dir with the DefaultOptions, creating dir if needed.
+func Open(dir string) (*FileStore, error) {
+	return OpenWithOptions(dir, DefaultOptions)
+}
+
+// OpenWithOptions loads the store kept in dir, creating dir if it does not exist yet.
+func OpenWithOptions(dir string, opts Options) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	fs := &FileStore{dir: dir, opts: opts, mem: taskstore.New()}
+
+	if err := fs.loadNewestSnapshot(); err != nil {
+		return nil, err
+	}
+
+	wal, err := openWAL(dir, fs.snapSeq, fs.apply)
+
+	if err != nil {
+		return nil, fmt.Errorf("opening task log in %s: %w", dir, err)
+	}
+
+	fs.log = wal
+
+	if opts.SnapshotInterval > 0 {
+		fs.stop = make(chan struct{})
+		fs.done = make(chan struct{})
+		go fs.snapshotLoop()
+	}
+
+	return fs, nil
+}
+
+// loadNewestSnapshot fills the in-memory store from the newest snapshot that passes its
+// checksum, falling back to older ones.
+func (fs *FileStore) loadNewestSnapshot() error {
+	seqs, err := listSequenced(fs.dir, snapshotPrefix, snapshotSuffix)
+
+	if err != nil {
+		return err
+	}
+
+	for i := len(seqs) - 1; i >= 0; i-- {
+		snap, err := readSnapshot(fs.dir, seqs[i])
+
+		if err != nil {
+			log.Printf("filestore: skipping snapshot: %v", err)
+			continue
+		}
+
+		fs.mem.Load(snap.Tasks, snap.NextID)
+		fs.mem.LoadHistory(snap.History)
+		fs.snapSeq = snap.Seq
+
+		return nil
+	}
+
+	return nil
+}
+
+// Close stops background snapshots and releases the log file;
+// every mutation has already been synced to disk.
+func (fs *FileStore) Close() error {
+	if fs.stop != nil {
+		close(fs.stop)
+		<-fs.done
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.log.close()
+}
+
+func (fs *FileStore) snapshotLoop() {
+	defer close(fs.done)
+
+	ticker := time.NewTicker(fs.opts.SnapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-fs.stop:
+			return
+		case <-ticker.C:
+			fs.mu.Lock()
+
+			if fs.log.seq > fs.snapSeq {
+				if _, err := fs.snapshotLocked(); err != nil {
+					log.Printf("filestore: background snapshot failed: %v", err)
+				}
+			}
+
+			fs.mu.Unlock()
+		}
+	}
+}
+
+// Snapshot writes the current state of the store to a new snapshot and drops the log
+// segments all the kept snapshots cover.
+func (fs *FileStore) Snapshot() (SnapshotInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.snapshotLocked()
+}
+
+func (fs *FileStore) snapshotLocked() (SnapshotInfo, error) {
+	tasks, nextId := fs.mem.Dump()
+
+	return fs.persistLocked(tasks, fs.mem.DumpHistory(), nextId)
+}
+
+// persistLocked makes tasks, their history and nextId the durable state of the store as
+// of the last log record, then prunes old snapshots and truncates the log up to the
+// oldest one kept, so loadNewestSnapshot can fall back to any of them.
+func (fs *FileStore) persistLocked(tasks []taskstore.Task, history []taskstore.Revision, nextId int) (SnapshotInfo, error) {
+	snap := snapshot{
+		Seq:     fs.log.seq,
+		Taken:   time.Now().UTC(),
+		NextID:  nextId,
+		Tasks:   tasks,
+		History: history,
+	}
+
+	// records appended from now on belong to the tail this snapshot does not cover
+	if err := fs.log.rotate(); err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	if err := writeSnapshot(fs.dir, snap); err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	fs.snapSeq = snap.Seq
+
+	if err := pruneSnapshots(fs.dir, fs.opts.KeepSnapshots); err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	seqs, err := listSequenced(fs.dir, snapshotPrefix, snapshotSuffix)
+
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	if err := fs.log.truncate(seqs[0]); err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	return SnapshotInfo{Seq: snap.Seq, Taken: snap.Taken}, nil
+}
+
+// Snapshots lists the snapshots the store can be restored to, oldest first.
+func (fs *FileStore) Snapshots() ([]SnapshotInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return listSnapshots(fs.dir)
+}
+
+// RestoreSnapshot brings the store back to the state captured by the snapshot seq.
+// The restored state is itself persisted as a new snapshot; ids handed out after the
+// old snapshot was taken are not reused.
+func (fs *FileStore) RestoreSnapshot(seq uint64) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	snap, err := readSnapshot(fs.dir, seq)
+
+	if err != nil {
+		return err
+	}
+
+	_, nextId := fs.mem.Dump()
+
+	if snap.NextID > nextId {
+		nextId = snap.NextID
+	}
+
+	if _, err := fs.persistLocked(snap.Tasks, snap.History, nextId); err != nil {
+		return err
+	}
+
+	fs.mem.Load(snap.Tasks, nextId)
+	fs.mem.LoadHistory(snap.History)
+
+	return nil
+}
+
+// apply replays one logged mutation into the in-memory state
+func (fs *FileStore) apply(rec record) error {
+	ctx := context.Background()
+
+	switch rec.Op {
+	case opCreate:
+		if rec.Task == nil {
+			return fmt.Errorf("create record without a task")
+		}
+		return fs.putLogged(ctx, rec)
+	case opUpdate:
+		if rec.Task == nil {
+			return fmt.Errorf("update record without a task")
+		}
+		// the record holds the task as stored, version included
+		return fs.putLogged(ctx, rec)
+	case opTrash:
+		if rec.Task == nil || rec.Task.DeletedAt == nil {
+			return fmt.Errorf("trash record without a deleted task")
+		}
+		return fs.putLogged(ctx, rec)
+	case opTrashAll:
+		if rec.At == nil {
+			return fmt.Errorf("trashAll record without a time")
+		}
+		fs.mem.TrashAllTasks(taskstore.WithAuthor(ctx, rec.Author), *rec.At)
+		return nil
+	case opRevision:
+		if rec.Rev == nil {
+			return fmt.Errorf("revision record without a revision")
+		}
+		return fs.mem.PutRevision(ctx, *rec.Rev)
+	case opPurge:
+		if rec.At == nil {
+			return fmt.Errorf("purge record without a time")
+		}
+		_, err := fs.mem.PurgeTrash(ctx, *rec.At)
+		return err
+	case opNextID:
+		return fs.mem.SetNextID(ctx, rec.ID)
+	default:
+		return fmt.Errorf("unknown log record %q", rec.Op)
+	}
+}
+
+// putLogged applies a record holding a task as stored and, unless it was written by
+// PutTask or before there was a history, the revision of the change.
+func (fs *FileStore) putLogged(ctx context.Context, rec record) error {
+	if err := fs.mem.PutTask(ctx, *rec.Task); err != nil {
+		return err
+	}
+
+	if rec.Rev == nil {
+		return nil
+	}
+
+	return fs.mem.PutRevision(ctx, *rec.Rev)
+}
+
+// revision returns the revision of a mutation about to be logged; the caller holds fs.mu.
+func (fs *FileStore) revision(ctx context.Context, action taskstore.Action, before, after taskstore.Task) *taskstore.Revision {
+	rev := taskstore.NewRevision(ctx, action, before, after, time.Now())
+	rev.Number = fs.mem.NextRevision(after.ID)
+
+	return &rev
+}
+
+func (fs *FileStore) CreateTask(ctx context.Context, text string, tags []string, due time.Time) (int, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	// ids are only handed out under fs.mu, so the next one is still free once logged
+	id, err := fs.mem.NextID(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	task := taskstore.Task{ID: id, Text: text, Tags: tags, Due: due, Version: 1, Status: taskstore.StatusOpen, Owner: taskstore.TenantOf(ctx).Owner}
+
+	if err := fs.logAndPut(ctx, record{Op: opCreate, Task: &task, Rev: fs.revision(ctx, taskstore.ActionCreated, taskstore.Task{}, task)}); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (fs *FileStore) UpdateTask(ctx context.Context, task taskstore.Task) (taskstore.Task, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	current, err := fs.mem.GetTask(ctx, task.ID)
+
+	if err != nil {
+		return taskstore.Task{}, err
+	}
+
+	task, err = taskstore.ApplyUpdate(current, task)
+
+	if err != nil {
+		return taskstore.Task{}, err
+	}
+
+	return task, fs.logAndPut(ctx, record{Op: opUpdate, Task: &task, Rev: fs.revision(ctx, taskstore.ActionUpdated, current, task)})
+}
+
+// logAndPut logs a record holding a task as stored, then applies it
+func (fs *FileStore) logAndPut(ctx context.Context, rec record) error {
+	if err := fs.log.append(rec); err != nil {
+		return err
+	}
+
+	return fs.putLogged(ctx, rec)
+}
+
+func (fs *FileStore) DeleteTask(ctx context.Context, id int, version int) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	current, err := fs.mem.GetTask(ctx, id)
+
+	if err != nil {
+		return err
+	}
+
+	if err := taskstore.CheckVersion(current, version); err != nil {
+		return err
+	}
+
+	trashed := taskstore.Trashed(current, time.Now())
+
+	return fs.logAndPut(ctx, record{Op: opTrash, Task: &trashed, Rev: fs.revision(ctx, taskstore.ActionDeleted, current, trashed)})
+}
+
+// DeleteAllTasks moves every task to the trash; the whole log is compacted right away
+// into a snapshot, which is smaller than the history it replaces.
+func (fs *FileStore) DeleteAllTasks(ctx context.Context) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	at := time.Now().UTC()
+
+	if err := fs.log.append(record{Op: opTrashAll, At: &at, Author: taskstore.Author(ctx)}); err != nil {
+		return err
+	}
+
+	fs.mem.TrashAllTasks(ctx, at)
+
+	if _, err := fs.snapshotLocked(); err != nil {
+		log.Printf("filestore: snapshot after deleting all tasks failed: %v", err)
+	}
+
+	return nil
+}
+
+func (fs *FileStore) GetTrash(ctx context.Context) ([]taskstore.Task, error) {
+	return fs.mem.GetTrash(ctx)
+}
+
+func (fs *FileStore) GetTrashedTask(ctx context.Context, id int) (taskstore.Task, error) {
+	return fs.mem.GetTrashedTask(ctx, id)
+}
+
+// RestoreTask is logged like an update, whose replay takes the task out of the trash
+func (fs *FileStore) RestoreTask(ctx context.Context, id int) (taskstore.Task, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	trashed, err := fs.mem.GetTrashedTask(ctx, id)
+
+	if err != nil {
+		return taskstore.Task{}, err
+	}
+
+	task := taskstore.Restored(trashed)
+
+	return task, fs.logAndPut(ctx, record{Op: opUpdate, Task: &task, Rev: fs.revision(ctx, taskstore.ActionRestored, trashed, task)})
+}
+
+func (fs *FileStore) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	before = before.UTC()
+
+	if err := fs.log.append(record{Op: opPurge, At: &before}); err != nil {
+		return 0, err
+	}
+
+	return fs.mem.PurgeTrash(ctx, before)
+}
+
+func (fs *FileStore) GetHistory(ctx context.Context, id int) ([]taskstore.Revision, error) {
+	return fs.mem.GetHistory(ctx, id)
+}
+
+// RevertTask is logged like an update, with the revision of the revert
+func (fs *FileStore) RevertTask(ctx context.Context, id int, number int, version int) (taskstore.Task, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	current, err := fs.mem.GetTask(ctx, id)
+
+	if err != nil {
+		return taskstore.Task{}, err
+	}
+
+	history, err := fs.mem.GetHistory(ctx, id)
+
+	if err != nil {
+		return taskstore.Task{}, err
+	}
+
+	rev, err := taskstore.FindRevision(history, id, number)
+
+	if err != nil {
+		return taskstore.Task{}, err
+	}
+
+	task, err := taskstore.ApplyRevert(current, rev, version)
+
+	if err != nil {
+		return taskstore.Task{}, err
+	}
+
+	return task, fs.logAndPut(ctx, record{Op: opUpdate, Task: &task, Rev: fs.revision(ctx, taskstore.ActionReverted, current, task)})
+}
+
+func (fs *FileStore) PutRevision(ctx context.Context, rev taskstore.Revision) error {
+	if err := taskstore.CheckRevision(rev); err != nil {
+		return err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.log.append(record{Op: opRevision, Rev: &rev}); err != nil {
+		return err
+	}
+
+	return fs.mem.PutRevision(ctx, rev)
+}
+
+// PutTask is logged like a create, whose replay already keeps the id of the task
+func (fs *FileStore) PutTask(ctx context.Context, task taskstore.Task) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.log.append(record{Op: opCreate, Task: &task}); err != nil {
+		return err
+	}
+
+	return fs.mem.PutTask(ctx, task)
+}
+
+func (fs *FileStore) SetNextID(ctx context.Context, next int) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.log.append(record{Op: opNextID, ID: next}); err != nil {
+		return err
+	}
+
+	return fs.mem.SetNextID(ctx, next)
+}
+
+func (fs *FileStore) NextID(ctx context.Context) (int, error) {
+	return fs.mem.NextID(ctx)
+}
+
+func (fs *FileStore) ForEachTask(ctx context.Context, fn func(taskstore.Task) error) error {
+	return fs.mem.ForEachTask(ctx, fn)
+}
+
+func (fs *FileStore) GetTask(ctx context.Context, id int) (taskstore.Task, error) {
+	return fs.mem.GetTask(ctx, id)
+}
+
+func (fs *FileStore) GetAllTasks(ctx context.Context) ([]taskstore.Task, error) {
+	return fs.mem.GetAllTasks(ctx)
+}
+
+func (fs *FileStore) GetTaskByTag(ctx context.Context, tag string) ([]taskstore.Task, error) {
+	return fs.mem.GetTaskByTag(ctx, tag)
+}
+
+func (fs *FileStore) GetTaskByDueDate(ctx context.Context, year int, month time.Month, day int) ([]taskstore.Task, error) {
+	return fs.mem.GetTaskByDueDate(ctx, year, month, day)
+}
+
+// syncDir makes a newly created file in dir durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+
+	if err != nil {
+		return err
+	}
+
+	defer d.Close()
+
+	return d.Sync()
+}
+
+func (fs *FileStore) GetTaskByStatus(ctx context.Context, status taskstore.Status) ([]taskstore.Task, error) {
+	return fs.mem.GetTaskByStatus(ctx, status)
+}
+
+func (fs *FileStore) GetTaskByDueRange(ctx context.Context, from, to time.Time, bounds taskstore.Bounds) ([]taskstore.Task, error) {
+	return fs.mem.GetTaskByDueRange(ctx, from, to, bounds)
+}
+
+func (fs *FileStore) SearchTasks(ctx context.Context, query string, limit int) ([]taskstore.SearchResult, error) {
+	return fs.mem.SearchTasks(ctx, query, limit)
+}
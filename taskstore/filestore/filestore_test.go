@@ -0,0 +1,401 @@
+package filestore_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shien/restserver/taskstore"
+	"github.com/shien/restserver/taskstore/filestore"
+	"github.com/shien/restserver/taskstore/storetest"
+)
+
+// open opens a new store in a directory removed after the test
+func open(tb testing.TB) taskstore.Store {
+	store, err := filestore.Open(filepath.Join(tb.TempDir(), "tasks"))
+
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	tb.Cleanup(func() { store.Close() })
+
+	return store
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) taskstore.Store { return open(t) })
+}
+
+func TestConcurrent(t *testing.T) {
+	storetest.RunConcurrent(t, func(t *testing.T) taskstore.Store { return open(t) })
+}
+
+// BenchmarkParallel compares parallel reads and writes with the same calls serialized
+func BenchmarkParallel(b *testing.B) {
+	storetest.BenchmarkParallel(b, func(b *testing.B) taskstore.Store { return open(b) })
+}
+
+func TestReopenReplaysLog(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "tasks")
+	store, err := filestore.Open(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	due := time.Date(2021, time.August, 1, 9, 30, 0, 0, time.FixedZone("CEST", 2*60*60))
+	var created []int
+
+	for _, text := range []string{"kept", "deleted", "last"} {
+		id, err := store.CreateTask(ctx, text, []string{"work"}, due)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		created = append(created, id)
+	}
+
+	// the newest task goes too, so the next id cannot be told from the tasks left
+	for _, id := range created[1:] {
+		if err := store.DeleteTask(ctx, id, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := store.GetTask(ctx, created[0])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want.Text = "kept and updated"
+
+	if want, err = store.UpdateTask(ctx, want); err != nil {
+		t.Fatal(err)
+	}
+
+	store.Close()
+
+	store, err = filestore.Open(dir)
+
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+
+	defer store.Close()
+
+	tasks, err := store.GetAllTasks(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tasks) != 1 {
+		t.Fatalf("got %d tasks after replaying the log, want 1: %v", len(tasks), tasks)
+	}
+
+	got := tasks[0]
+
+	if got.ID != want.ID || got.Text != want.Text || !got.Due.Equal(want.Due) || len(got.Tags) != 1 || got.Tags[0] != "work" || got.Version != 2 {
+		t.Errorf("replayed task = %+v, want %+v", got, want)
+	}
+
+	id, err := store.CreateTask(ctx, "after reopening", nil, due)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id != created[len(created)-1]+1 {
+		t.Errorf("CreateTask after reopening gave id %d, want %d", id, created[len(created)-1]+1)
+	}
+}
+
+// segments returns the log segments in dir, oldest first
+func segments(t *testing.T, dir string) []string {
+	t.Helper()
+
+	names, err := filepath.Glob(filepath.Join(dir, "wal-*.log"))
+
+	if err != nil || len(names) == 0 {
+		t.Fatalf("no log segment in %s: %v", dir, err)
+	}
+
+	return names
+}
+
+// appendToLog writes data after the last record of the log in dir
+func appendToLog(t *testing.T, dir string, data []byte) {
+	t.Helper()
+
+	names := segments(t, dir)
+	file, err := os.OpenFile(names[len(names)-1], os.O_APPEND|os.O_WRONLY, 0o644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTornTailIsDropped(t *testing.T) {
+	tests := []struct {
+		name string
+		tail []byte
+	}{
+		{"cut header", []byte{0, 0, 0}},
+		{"cut payload", []byte{0, 0, 0, 64, 0, 0, 0, 0, '{', '"'}},
+		// a header claiming a 4 GiB record, as a corrupt length would
+		{"huge length", []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := filepath.Join(t.TempDir(), "tasks")
+			store, err := filestore.Open(dir)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := store.CreateTask(ctx, "kept", nil, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+
+			store.Close()
+			appendToLog(t, dir, test.tail)
+
+			store, err = filestore.Open(dir)
+
+			if err != nil {
+				t.Fatalf("reopening with a torn tail: %v", err)
+			}
+
+			if _, err := store.CreateTask(ctx, "appended", nil, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+
+			store.Close()
+
+			// the new record went where the torn one was, so it replays too
+			store, err = filestore.Open(dir)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer store.Close()
+
+			if tasks, err := store.GetAllTasks(ctx); err != nil || len(tasks) != 2 {
+				t.Errorf("GetAllTasks = %v, %v; want the kept and appended tasks", tasks, err)
+			}
+		})
+	}
+}
+
+func TestOversizedRecordIsRefused(t *testing.T) {
+	ctx := context.Background()
+	store, err := filestore.Open(filepath.Join(t.TempDir(), "tasks"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer store.Close()
+
+	if _, err := store.CreateTask(ctx, strings.Repeat("x", 16<<20), nil, time.Now()); err == nil {
+		t.Error("created a task too large for a log record")
+	}
+
+	if tasks, err := store.GetAllTasks(ctx); err != nil || len(tasks) != 0 {
+		t.Errorf("after the refused create, GetAllTasks = %d tasks, %v; want none", len(tasks), err)
+	}
+
+	// nothing was logged, so the id is still free
+	if id, err := store.CreateTask(ctx, "small", nil, time.Now()); err != nil || id != 0 {
+		t.Errorf("CreateTask after the refused one = %d, %v; want id 0", id, err)
+	}
+}
+
+// texts returns the texts of the tasks of store by id
+func texts(t *testing.T, store taskstore.Store) map[int]string {
+	t.Helper()
+
+	tasks, err := store.GetAllTasks(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byID := make(map[int]string, len(tasks))
+
+	for _, task := range tasks {
+		byID[task.ID] = task.Text
+	}
+
+	return byID
+}
+
+func TestRestoreSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "tasks")
+	opts := filestore.Options{KeepSnapshots: 3}
+	store, err := filestore.OpenWithOptions(dir, opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustCreate := func(text string) int {
+		t.Helper()
+
+		id, err := store.CreateTask(ctx, text, nil, time.Now())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return id
+	}
+
+	first := mustCreate("first")
+	older, err := store.Snapshot()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustCreate("second")
+
+	if err := store.DeleteTask(ctx, first, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	third := mustCreate("third") // only in the log tail
+
+	if err := store.RestoreSnapshot(older.Seq); err != nil {
+		t.Fatalf("RestoreSnapshot(%d): %v", older.Seq, err)
+	}
+
+	want := map[int]string{first: "first"}
+
+	if got := texts(t, store); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("tasks after restoring snapshot %d = %v, want %v", older.Seq, got, want)
+	}
+
+	// ids handed out after the snapshot was taken are not reused
+	fourth := mustCreate("fourth")
+
+	if fourth <= third {
+		t.Errorf("CreateTask after the restore gave id %d, want one above %d", fourth, third)
+	}
+
+	want[fourth] = "fourth"
+
+	// the restored state is a snapshot of its own, the log is kept from the oldest snapshot on
+	snapshots, err := store.Snapshots()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(snapshots) != 3 || snapshots[0].Seq != older.Seq {
+		t.Fatalf("Snapshots() = %v, want 3 starting with %d", snapshots, older.Seq)
+	}
+
+	if names := segments(t, dir); filepath.Base(names[0]) != fmt.Sprintf("wal-%020d.log", older.Seq+1) {
+		t.Errorf("the log starts with %s, want the segment right after snapshot %d", filepath.Base(names[0]), older.Seq)
+	}
+
+	store.Close()
+
+	store, err = filestore.OpenWithOptions(dir, opts)
+
+	if err != nil {
+		t.Fatalf("reopening after the restore: %v", err)
+	}
+
+	defer store.Close()
+
+	if got := texts(t, store); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("tasks after reopening = %v, want %v", got, want)
+	}
+
+	if err := store.RestoreSnapshot(12345); err == nil {
+		t.Error("RestoreSnapshot of a missing snapshot succeeded")
+	}
+}
+
+func TestCorruptSnapshotFallsBack(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "tasks")
+	opts := filestore.Options{KeepSnapshots: 3}
+	store, err := filestore.OpenWithOptions(dir, opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// one task before each snapshot and one in the log tail
+	for _, text := range []string{"first", "second", "third"} {
+		if _, err := store.CreateTask(ctx, text, nil, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+
+		if text != "third" {
+			if _, err := store.Snapshot(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	snapshots, err := store.Snapshots()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.Close()
+
+	newest := filepath.Join(dir, fmt.Sprintf("snap-%020d.snap", snapshots[len(snapshots)-1].Seq))
+
+	if err := os.WriteFile(newest, []byte("not a snapshot"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = filestore.OpenWithOptions(dir, opts)
+
+	if err != nil {
+		t.Fatalf("reopening with a corrupt newest snapshot: %v", err)
+	}
+
+	defer store.Close()
+
+	tasks, err := store.GetAllTasks(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tasks) != 3 {
+		t.Errorf("got %d tasks after falling back to the older snapshot, want 3: %v", len(tasks), tasks)
+	}
+}
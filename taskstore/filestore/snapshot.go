@@ -0,0 +1,163 @@
+package filestore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+// A snapshot file holds the whole store as it was after a given log record, framed and
+// checksummed like a log record. It is named after that record's sequence number.
+const (
+	snapshotPrefix = "snap-"
+	snapshotSuffix = ".snap"
+)
+
+type snapshot struct {
+	Seq    uint64           `json:"seq"`
+	Taken  time.Time        `json:"taken"`
+	NextID int              `json:"nextId"`
+	Tasks  []taskstore.Task `json:"tasks"`
+
+	History []taskstore.Revision `json:"history,omitempty"`
+}
+
+// SnapshotInfo describes a snapshot the store can be restored to
+type SnapshotInfo struct {
+	Seq   uint64    `json:"seq"` // number of the last log record the snapshot covers
+	Taken time.Time `json:"taken"`
+}
+
+func snapshotName(seq uint64) string {
+	return fmt.Sprintf("%s%020d%s", snapshotPrefix, seq, snapshotSuffix)
+}
+
+// writeSnapshot stores snap atomically: it is written to a temporary file, synced and
+// only then renamed into place.
+func writeSnapshot(dir string, snap snapshot) error {
+	payload, err := json.Marshal(snap)
+
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, snapshotName(snap.Seq))
+	tmp := path + ".tmp"
+
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(frame(payload)); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+func readSnapshot(dir string, seq uint64) (snapshot, error) {
+	data, err := os.ReadFile(filepath.Join(dir, snapshotName(seq)))
+
+	if err != nil {
+		return snapshot{}, err
+	}
+
+	payload, err := readFrame(bytes.NewReader(data))
+
+	if err != nil {
+		return snapshot{}, fmt.Errorf("snapshot %d: %w", seq, err)
+	}
+
+	var snap snapshot
+
+	if err := json.Unmarshal(payload, &snap); err != nil {
+		return snapshot{}, fmt.Errorf("snapshot %d: %w", seq, err)
+	}
+
+	if snap.Seq != seq {
+		return snapshot{}, fmt.Errorf("snapshot %d claims to cover record %d", seq, snap.Seq)
+	}
+
+	return snap, nil
+}
+
+// listSnapshots returns the snapshots kept in dir, oldest first
+func listSnapshots(dir string) ([]SnapshotInfo, error) {
+	seqs, err := listSequenced(dir, snapshotPrefix, snapshotSuffix)
+
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]SnapshotInfo, 0, len(seqs))
+
+	for _, seq := range seqs {
+		info, err := os.Stat(filepath.Join(dir, snapshotName(seq)))
+
+		if err != nil {
+			return nil, err
+		}
+
+		infos = append(infos, SnapshotInfo{Seq: seq, Taken: info.ModTime().UTC()})
+	}
+
+	return infos, nil
+}
+
+// pruneSnapshots deletes all but the newest keep snapshots, plus any leftover temporary files
+func pruneSnapshots(dir string, keep int) error {
+	if keep < 1 {
+		keep = 1
+	}
+
+	seqs, err := listSequenced(dir, snapshotPrefix, snapshotSuffix)
+
+	if err != nil {
+		return err
+	}
+
+	for len(seqs) > keep {
+		if err := os.Remove(filepath.Join(dir, snapshotName(seqs[0]))); err != nil {
+			return err
+		}
+
+		seqs = seqs[1:]
+	}
+
+	leftovers, err := filepath.Glob(filepath.Join(dir, snapshotPrefix+"*"+snapshotSuffix+".tmp"))
+
+	if err != nil {
+		return err
+	}
+
+	for _, tmp := range leftovers {
+		os.Remove(tmp)
+	}
+
+	return nil
+}
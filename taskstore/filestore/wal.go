@@ -0,0 +1,395 @@
+package filestore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+// Every record on disk is framed as
+//
+//	[4 byte payload length][4 byte CRC-32C of the payload][JSON payload]
+//
+// so a record cut short by a crash (a torn write) is detected on replay.
+const headerSize = 8
+
+// maxPayload bounds a record, far above what one task takes, so a corrupt length is
+// taken for a torn record instead of allocated.
+const maxPayload = 16 << 20
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var errTorn = errors.New("torn or corrupt record")
+
+// Kinds of mutations kept in the log
+const (
+	opCreate   = "create"
+	opUpdate   = "update"
+	opTrash    = "trash"    // Task holds the task as moved to the trash
+	opTrashAll = "trashAll" // At holds when, Author who
+	opPurge    = "purge"    // At holds the time the purged tasks were deleted before
+	opNextID   = "nextId"   // ID holds the new value of the id counter
+	opRevision = "revision" // Rev holds a revision put with PutRevision
+)
+
+type record struct {
+	Op   string          `json:"op"`
+	Task *taskstore.Task `json:"task,omitempty"`
+	ID   int             `json:"id,omitempty"`
+	At   *time.Time      `json:"at,omitempty"`
+
+	// Rev is the revision a create, update or trash records, if any
+	Rev    *taskstore.Revision `json:"rev,omitempty"`
+	Author string              `json:"author,omitempty"`
+}
+
+// The log is split in segment files named after the sequence number of their first
+// record; records are numbered from 1 by their position in the log, so a segment only
+// has to be deleted once a snapshot covers all of it.
+const (
+	segmentPrefix = "wal-"
+	segmentSuffix = ".log"
+)
+
+func segmentName(first uint64) string {
+	return fmt.Sprintf("%s%020d%s", segmentPrefix, first, segmentSuffix)
+}
+
+// wal is an append-only log of records; every append is fsync'd before it returns.
+type wal struct {
+	dir      string
+	segments []uint64 // first sequence number of each segment, ascending; the last one is open
+	file     *os.File
+	size     int64  // offset just past the last complete record of the open segment
+	seq      uint64 // sequence number of the last record in the log
+}
+
+// openWAL opens (or creates) the log kept in dir and feeds every intact record numbered
+// after `after` to apply, in order. A torn or corrupt tail of the newest segment is cut
+// off so new records are appended after the last good one.
+func openWAL(dir string, after uint64, apply func(record) error) (*wal, error) {
+	segments, err := listSequenced(dir, segmentPrefix, segmentSuffix)
+
+	if err != nil {
+		return nil, err
+	}
+
+	w := &wal{dir: dir, seq: after}
+
+	if len(segments) == 0 {
+		if err := w.openSegment(after + 1); err != nil {
+			return nil, err
+		}
+
+		return w, nil
+	}
+
+	if segments[0] > after+1 {
+		return nil, fmt.Errorf("log starts at record %d but the snapshot only covers up to %d", segments[0], after)
+	}
+
+	for i, first := range segments {
+		path := filepath.Join(dir, segmentName(first))
+		last := i == len(segments)-1
+
+		if !last && segments[i+1] <= after+1 {
+			continue // fully covered by the snapshot
+		}
+
+		file, err := os.OpenFile(path, os.O_RDWR, 0o644)
+
+		if err != nil {
+			return nil, err
+		}
+
+		good, count, err := replay(file, first, after, apply)
+
+		if err != nil && !(errors.Is(err, errTorn) && last) {
+			file.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		if !last {
+			file.Close()
+
+			if first+count != segments[i+1] {
+				return nil, fmt.Errorf("%s holds %d records but the next segment starts at %d", path, count, segments[i+1])
+			}
+
+			continue
+		}
+
+		if first+count <= after {
+			file.Close()
+			return nil, fmt.Errorf("log ends at record %d but the snapshot covers up to %d", first+count-1, after)
+		}
+
+		if err := w.adoptTail(file, good); err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		if end := first + count - 1; end > w.seq {
+			w.seq = end
+		}
+	}
+
+	w.segments = segments
+
+	return w, nil
+}
+
+// adoptTail makes file, whose intact records end at offset good, the open segment
+func (w *wal) adoptTail(file *os.File, good int64) error {
+	info, err := file.Stat()
+
+	if err != nil {
+		return err
+	}
+
+	if info.Size() > good {
+		log.Printf("filestore: dropping %d bytes of torn log tail in %s", info.Size()-good, file.Name())
+
+		if err := file.Truncate(good); err != nil {
+			return err
+		}
+	}
+
+	if _, err := file.Seek(good, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		return err
+	}
+
+	w.file = file
+	w.size = good
+
+	return nil
+}
+
+// replay reads the records of one segment, whose first record is numbered first, and
+// applies the ones numbered after `after`. It returns the offset just past the last
+// intact record and how many intact records the segment holds.
+func replay(file *os.File, first, after uint64, apply func(record) error) (int64, uint64, error) {
+	reader := bufio.NewReader(file)
+
+	var offset int64
+	var count uint64
+
+	for {
+		payload, err := readFrame(reader)
+
+		if err == io.EOF {
+			return offset, count, nil
+		}
+
+		if err != nil {
+			return offset, count, err
+		}
+
+		var rec record
+
+		if err := json.Unmarshal(payload, &rec); err != nil {
+			return offset, count, errTorn
+		}
+
+		if seq := first + count; seq > after {
+			if err := apply(rec); err != nil {
+				return offset, count, fmt.Errorf("replaying log record %d: %w", seq, err)
+			}
+		}
+
+		offset += headerSize + int64(len(payload))
+		count++
+	}
+}
+
+// readFrame returns the next payload, io.EOF at a clean end of input and errTorn when
+// the frame is incomplete, longer than maxPayload or fails its checksum.
+func readFrame(reader io.Reader) ([]byte, error) {
+	header := make([]byte, headerSize)
+
+	if _, err := io.ReadFull(reader, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errTorn
+		}
+
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	sum := binary.BigEndian.Uint32(header[4:8])
+
+	if length > maxPayload {
+		return nil, errTorn
+	}
+
+	payload := make([]byte, length)
+
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errTorn
+		}
+
+		return nil, err
+	}
+
+	if crc32.Checksum(payload, crcTable) != sum {
+		return nil, errTorn
+	}
+
+	return payload, nil
+}
+
+func frame(payload []byte) []byte {
+	buf := make([]byte, headerSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(payload, crcTable))
+	copy(buf[headerSize:], payload)
+
+	return buf
+}
+
+func (w *wal) append(rec record) error {
+	payload, err := json.Marshal(rec)
+
+	if err != nil {
+		return err
+	}
+
+	if len(payload) > maxPayload {
+		return fmt.Errorf("log record of %d bytes is over the %d byte limit", len(payload), maxPayload)
+	}
+
+	buf := frame(payload)
+
+	if _, err := w.file.Write(buf); err != nil {
+		return w.rollback(err)
+	}
+
+	if err := w.file.Sync(); err != nil {
+		return w.rollback(err)
+	}
+
+	w.size += int64(len(buf))
+	w.seq++
+
+	return nil
+}
+
+// rollback cuts a partially written record off the log so the next append starts at a
+// record boundary again.
+func (w *wal) rollback(cause error) error {
+	if err := w.file.Truncate(w.size); err != nil {
+		log.Printf("filestore: cannot roll back failed append: %v", err)
+	}
+
+	w.file.Seek(w.size, io.SeekStart)
+
+	return cause
+}
+
+// rotate closes the open segment and starts a new one for the records after w.seq
+func (w *wal) rotate() error {
+	if w.size == 0 {
+		return nil // the open segment is still empty, it already starts at w.seq+1
+	}
+
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	w.file = nil
+
+	return w.openSegment(w.seq + 1)
+}
+
+func (w *wal) openSegment(first uint64) error {
+	file, err := os.OpenFile(filepath.Join(w.dir, segmentName(first)), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+
+	if err != nil {
+		return err
+	}
+
+	if err := syncDir(w.dir); err != nil {
+		file.Close()
+		return err
+	}
+
+	w.file = file
+	w.size = 0
+	w.segments = append(w.segments, first)
+
+	return nil
+}
+
+// truncate deletes the closed segments whose records are all numbered up to seq
+func (w *wal) truncate(seq uint64) error {
+	kept := w.segments[:0]
+
+	for i, first := range w.segments {
+		if i < len(w.segments)-1 && w.segments[i+1] <= seq+1 {
+			if err := os.Remove(filepath.Join(w.dir, segmentName(first))); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+
+			continue
+		}
+
+		kept = append(kept, first)
+	}
+
+	w.segments = kept
+
+	return syncDir(w.dir)
+}
+
+func (w *wal) close() error {
+	if w.file == nil {
+		return errors.New("log already closed")
+	}
+
+	err := w.file.Close()
+	w.file = nil
+
+	return err
+}
+
+// listSequenced returns the sequence numbers of the files in dir named prefix<number>suffix,
+// ascending.
+func listSequenced(dir, prefix, suffix string) ([]uint64, error) {
+	names, err := filepath.Glob(filepath.Join(dir, prefix+"*"+suffix))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var seqs []uint64
+
+	for _, name := range names {
+		var seq uint64
+
+		if _, err := fmt.Sscanf(filepath.Base(name), prefix+"%d"+suffix, &seq); err != nil {
+			continue
+		}
+
+		seqs = append(seqs, seq)
+	}
+
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	return seqs, nil
+}
@@ -0,0 +1,228 @@
+package filter
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+// Eval returns the tasks of store that match expr, in no particular order.
+// Only the tasks a lookup by tag, status, due time or id can narrow expr down to are
+// fetched and matched; a filter no lookup applies to, like NOT tag:x, scans every task.
+func Eval(ctx context.Context, store taskstore.Store, expr Expr) ([]taskstore.Task, error) {
+	fetch := plan(expr)
+
+	if fetch == nil {
+		fetch = func(ctx context.Context, store taskstore.Store) ([]taskstore.Task, error) {
+			return store.GetAllTasks(ctx)
+		}
+	}
+
+	tasks, err := fetch(ctx, store)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []taskstore.Task
+
+	for _, task := range tasks {
+		if expr.Match(task) {
+			matched = append(matched, task)
+		}
+	}
+
+	return matched, nil
+}
+
+// lookup fetches a superset of the tasks matching some expression
+type lookup func(ctx context.Context, store taskstore.Store) ([]taskstore.Task, error)
+
+// cost ranks lookups by how few tasks they usually return: an id is one task,
+// a tag a few, a due range or a status possibly a large share of the store.
+const (
+	costID = iota
+	costTag
+	costDue
+	costStatus
+	costCombined
+	costScan
+)
+
+// plan returns the lookup to fetch the candidates for expr with, nil when it takes a scan
+func plan(expr Expr) lookup {
+	fetch, _ := planCost(expr)
+
+	return fetch
+}
+
+func planCost(expr Expr) (lookup, int) {
+	switch e := expr.(type) {
+	case *Term:
+		return planTerm(e)
+	case And:
+		return planAnd(e)
+	case Or:
+		left, _ := planCost(e.Left)
+		right, _ := planCost(e.Right)
+
+		if left == nil || right == nil {
+			return nil, costScan
+		}
+
+		return union(left, right), costCombined
+	}
+
+	return nil, costScan
+}
+
+func planTerm(term *Term) (lookup, int) {
+	if term.Op == OpNotEqual {
+		return nil, costScan
+	}
+
+	switch term.Field {
+	case FieldID:
+		if term.Op != OpContains && term.Op != OpEqual {
+			return nil, costScan
+		}
+
+		return func(ctx context.Context, store taskstore.Store) ([]taskstore.Task, error) {
+			task, err := store.GetTask(ctx, term.id)
+
+			if errors.Is(err, taskstore.ErrNotFound) {
+				return nil, nil
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			return []taskstore.Task{task}, nil
+		}, costID
+	case FieldTag:
+		return func(ctx context.Context, store taskstore.Store) ([]taskstore.Task, error) {
+			return store.GetTaskByTag(ctx, term.Value)
+		}, costTag
+	case FieldStatus:
+		return func(ctx context.Context, store taskstore.Store) ([]taskstore.Task, error) {
+			return store.GetTaskByStatus(ctx, term.status)
+		}, costStatus
+	case FieldDue:
+		from, to := dueRange(term)
+
+		return dueLookup(from, to), costDue
+	}
+
+	return nil, costScan
+}
+
+// dueRange returns the range [from, to) of due times a due term matches, zero for an open end
+func dueRange(term *Term) (time.Time, time.Time) {
+	switch term.Op {
+	case OpLess:
+		return time.Time{}, term.from
+	case OpLessEq:
+		return time.Time{}, term.to
+	case OpGreater:
+		return term.to, time.Time{}
+	case OpGreaterEq:
+		return term.from, time.Time{}
+	}
+
+	return term.from, term.to
+}
+
+func dueLookup(from, to time.Time) lookup {
+	return func(ctx context.Context, store taskstore.Store) ([]taskstore.Task, error) {
+		return store.GetTaskByDueRange(ctx, from, to, taskstore.HalfOpen)
+	}
+}
+
+// planAnd picks the cheapest lookup among the operands of a chain of ANDs;
+// the due terms in the chain are merged into one range first.
+func planAnd(e And) (lookup, int) {
+	var from, to time.Time
+	var due bool
+
+	best, bestCost := lookup(nil), costScan
+
+	for _, operand := range operands(e) {
+		if term, ok := operand.(*Term); ok && term.Field == FieldDue && term.Op != OpNotEqual {
+			f, t := dueRange(term)
+			from, to = later(from, f), earlier(to, t)
+			due = true
+			continue
+		}
+
+		if fetch, cost := planCost(operand); fetch != nil && cost < bestCost {
+			best, bestCost = fetch, cost
+		}
+	}
+
+	if due && costDue < bestCost {
+		return dueLookup(from, to), costDue
+	}
+
+	return best, bestCost
+}
+
+// operands flattens a chain of ANDs
+func operands(expr Expr) []Expr {
+	if e, ok := expr.(And); ok {
+		return append(operands(e.Left), operands(e.Right)...)
+	}
+
+	return []Expr{expr}
+}
+
+// later and earlier tighten range bounds, where a zero time is an open end
+func later(a, b time.Time) time.Time {
+	if a.IsZero() || b.After(a) {
+		return b
+	}
+
+	return a
+}
+
+func earlier(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+
+	return a
+}
+
+// union fetches the tasks of both lookups, each task once
+func union(left, right lookup) lookup {
+	return func(ctx context.Context, store taskstore.Store) ([]taskstore.Task, error) {
+		tasks, err := left(ctx, store)
+
+		if err != nil {
+			return nil, err
+		}
+
+		more, err := right(ctx, store)
+
+		if err != nil {
+			return nil, err
+		}
+
+		seen := make(map[int]bool, len(tasks))
+
+		for _, task := range tasks {
+			seen[task.ID] = true
+		}
+
+		for _, task := range more {
+			if !seen[task.ID] {
+				seen[task.ID] = true
+				tasks = append(tasks, task)
+			}
+		}
+
+		return tasks, nil
+	}
+}
@@ -0,0 +1,165 @@
+// Package filter implements the filter expressions of GET /task/?filter=, such as
+//
+//	tag:work AND due<2021-09-01 AND NOT tag:blocked
+//
+// A filter is a boolean combination (AND, OR, NOT and parentheses; AND may be left out
+// between two terms) of terms comparing a task field with a value:
+//
+//	tag:work          has the tag work (= is the same, != has not)
+//	status:done       is done (also =, !=)
+//	due<2021-09-01    is due before that day; due takes : = != < <= > >= and either a date,
+//	                  which stands for the whole day, or an RFC 3339 time
+//	text:"call bob"   the text contains "call bob", ignoring case; text=... is the whole text
+//	id>=10            compares the id (: = != < <= > >=)
+//	milk              a bare word or "quoted string" matches like text:
+//
+// AND, OR and NOT are only keywords in upper case; NOT binds tightest, then AND, then OR.
+//
+// Parse builds the syntax tree and Eval runs it against a store, fetching tasks through the
+// store's tag, status and due date lookups where the filter allows it.
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+// Field is a task field a term compares
+type Field string
+
+const (
+	FieldTag    Field = "tag"
+	FieldStatus Field = "status"
+	FieldDue    Field = "due"
+	FieldText   Field = "text"
+	FieldID     Field = "id"
+)
+
+// Fields lists the fields terms can compare
+var Fields = []Field{FieldTag, FieldStatus, FieldDue, FieldText, FieldID}
+
+// Op is the comparison of a term
+type Op string
+
+const (
+	OpContains  Op = ":"
+	OpEqual     Op = "="
+	OpNotEqual  Op = "!="
+	OpLess      Op = "<"
+	OpLessEq    Op = "<="
+	OpGreater   Op = ">"
+	OpGreaterEq Op = ">="
+)
+
+// ops lists the comparisons each field takes
+var ops = map[Field][]Op{
+	FieldTag:    {OpContains, OpEqual, OpNotEqual},
+	FieldStatus: {OpContains, OpEqual, OpNotEqual},
+	FieldDue:    {OpContains, OpEqual, OpNotEqual, OpLess, OpLessEq, OpGreater, OpGreaterEq},
+	FieldText:   {OpContains, OpEqual, OpNotEqual},
+	FieldID:     {OpContains, OpEqual, OpNotEqual, OpLess, OpLessEq, OpGreater, OpGreaterEq},
+}
+
+// Expr is a node of a parsed filter
+type Expr interface {
+	// Match reports whether task passes the filter
+	Match(task taskstore.Task) bool
+	String() string
+}
+
+type And struct{ Left, Right Expr }
+
+type Or struct{ Left, Right Expr }
+
+type Not struct{ Expr Expr }
+
+// Term compares a field of the task with a value
+type Term struct {
+	Field Field
+	Op    Op
+	Value string
+
+	// what Value stands for: a due term matches [from, to), a single day or a single
+	// instant, an id term compares with id
+	from, to time.Time
+	id       int
+	status   taskstore.Status
+}
+
+func (e And) Match(task taskstore.Task) bool { return e.Left.Match(task) && e.Right.Match(task) }
+func (e Or) Match(task taskstore.Task) bool  { return e.Left.Match(task) || e.Right.Match(task) }
+func (e Not) Match(task taskstore.Task) bool { return !e.Expr.Match(task) }
+
+func (e And) String() string { return fmt.Sprintf("(%s AND %s)", e.Left, e.Right) }
+func (e Or) String() string  { return fmt.Sprintf("(%s OR %s)", e.Left, e.Right) }
+func (e Not) String() string { return fmt.Sprintf("NOT %s", e.Expr) }
+
+func (e *Term) String() string {
+	return string(e.Field) + string(e.Op) + strconv.Quote(e.Value)
+}
+
+func (e *Term) Match(task taskstore.Task) bool {
+	switch e.Field {
+	case FieldTag:
+		return e.equal(task.HasTag(e.Value))
+	case FieldStatus:
+		return e.equal(taskstore.Upgrade(task).Status == e.status)
+	case FieldText:
+		if e.Op == OpContains {
+			return strings.Contains(strings.ToLower(task.Text), strings.ToLower(e.Value))
+		}
+
+		return e.equal(task.Text == e.Value)
+	case FieldDue:
+		return e.compare(compareRange(task.Due, e.from, e.to))
+	case FieldID:
+		return e.compare(task.ID - e.id)
+	}
+
+	return false
+}
+
+// equal applies an equality op to whether the field equals the value
+func (e *Term) equal(equal bool) bool {
+	if e.Op == OpNotEqual {
+		return !equal
+	}
+
+	return equal
+}
+
+// compare applies the op to the sign of the field minus the value
+func (e *Term) compare(sign int) bool {
+	switch e.Op {
+	case OpContains, OpEqual:
+		return sign == 0
+	case OpNotEqual:
+		return sign != 0
+	case OpLess:
+		return sign < 0
+	case OpLessEq:
+		return sign <= 0
+	case OpGreater:
+		return sign > 0
+	case OpGreaterEq:
+		return sign >= 0
+	}
+
+	return false
+}
+
+// compareRange returns -1, 0 or 1 as t is before, in or after [from, to)
+func compareRange(t, from, to time.Time) int {
+	switch {
+	case t.Before(from):
+		return -1
+	case t.Before(to):
+		return 0
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,270 @@
+package filter_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/shien/restserver/taskstore"
+	"github.com/shien/restserver/taskstore/filter"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   string
+	}{
+		{`tag:work`, `tag:"work"`},
+		{`tag:work AND due<2021-09-01 AND NOT tag:blocked`, `((tag:"work" AND due<"2021-09-01") AND NOT tag:"blocked")`},
+		// NOT binds tightest, then AND, then OR
+		{`a OR b AND c`, `(text:"a" OR (text:"b" AND text:"c"))`},
+		{`a AND b OR c`, `((text:"a" AND text:"b") OR text:"c")`},
+		{`NOT a AND b`, `(NOT text:"a" AND text:"b")`},
+		{`NOT (a OR b)`, `NOT (text:"a" OR text:"b")`},
+		{`NOT NOT a`, `NOT NOT text:"a"`},
+		{`(a OR b) c`, `((text:"a" OR text:"b") AND text:"c")`},
+		{`a b OR c d`, `((text:"a" AND text:"b") OR (text:"c" AND text:"d"))`},
+		// keywords are upper case only
+		{`a or b`, `((text:"a" AND text:"or") AND text:"b")`},
+		{`text:"call bob"`, `text:"call bob"`},
+		{`text="call bob"`, `text="call bob"`},
+		{`"say \"hi\"" OR milk`, `(text:"say \"hi\"" OR text:"milk")`},
+		{`due<2021-09-01`, `due<"2021-09-01"`},
+		{`due>=2021-08-01T09:00:00+02:00`, `due>="2021-08-01T09:00:00+02:00"`},
+		{`(due<=2021-08-01T09:00:00Z)`, `due<="2021-08-01T09:00:00Z"`},
+		{`id!=10 status:in_progress`, `(id!="10" AND status:"in_progress")`},
+		{"\ttag:a\n", `tag:"a"`},
+	}
+
+	for _, test := range tests {
+		expr, err := filter.Parse(test.filter, nil)
+
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.filter, err)
+			continue
+		}
+
+		if got := expr.String(); got != test.want {
+			t.Errorf("Parse(%q) = %s, want %s", test.filter, got, test.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		filter string
+		pos    int
+		column int
+		token  string
+	}{
+		{``, 0, 1, ""},
+		{`   `, 3, 4, ""},
+		{`tag:work AND prio:1`, 13, 14, "prio"},
+		{`tag:work AND`, 12, 13, ""},
+		{`tag:work OR OR tag:home`, 12, 13, "OR"},
+		{`(tag:work`, 0, 1, "("},
+		{`tag:work)`, 8, 9, ")"},
+		{`:work`, 0, 1, ":"},
+		{`!work`, 0, 1, "!"},
+		{`tag:`, 0, 1, "tag:"},
+		{`tag<work`, 3, 4, "<"},
+		{`status:later`, 7, 8, "later"},
+		{`id:x`, 3, 4, "x"},
+		{`due<tomorrow`, 4, 5, "tomorrow"},
+		{`text:"open`, 5, 6, `"open`},
+		{`"bad \q"`, 0, 1, `"bad \q"`},
+		// columns count characters, positions bytes
+		{`éé AND prio:1`, 9, 8, "prio"},
+	}
+
+	for _, test := range tests {
+		_, err := filter.Parse(test.filter, nil)
+
+		var filterErr *filter.Error
+
+		if !errors.As(err, &filterErr) {
+			t.Errorf("Parse(%q) = %v, want a *filter.Error", test.filter, err)
+			continue
+		}
+
+		if filterErr.Pos != test.pos || filterErr.Column() != test.column || filterErr.Token != test.token {
+			t.Errorf("Parse(%q): error at offset %d, column %d, token %q; want %d, %d, %q (%v)",
+				test.filter, filterErr.Pos, filterErr.Column(), filterErr.Token, test.pos, test.column, test.token, err)
+		}
+	}
+
+	_, err := filter.Parse(`tag:work AND prio:1`, nil)
+	want := "tag:work AND prio:1\n             ^^^^"
+
+	if got := err.(*filter.Error).Pointer(); got != want {
+		t.Errorf("Pointer() = %q, want %q", got, want)
+	}
+}
+
+// newStore returns a store with a few tasks, by id:
+//
+//	0 "buy milk"        work, shop    Aug 1 09:00 UTC    open
+//	1 "call Bob"        work          Aug 2 10:00 UTC    done
+//	2 "write report"    home          Aug 31 23:00 UTC   in_progress
+//	3 "walk the dog"                  Sep 1 00:00 UTC    open
+//	4 "Call bob again"  home, blocked no due date        blocked
+func newStore(t *testing.T) taskstore.Store {
+	ctx := context.Background()
+	store := taskstore.New()
+
+	tasks := []struct {
+		text   string
+		tags   []string
+		due    time.Time
+		status taskstore.Status
+	}{
+		{"buy milk", []string{"work", "shop"}, time.Date(2021, time.August, 1, 9, 0, 0, 0, time.UTC), taskstore.StatusOpen},
+		{"call Bob", []string{"work"}, time.Date(2021, time.August, 2, 10, 0, 0, 0, time.UTC), taskstore.StatusDone},
+		{"write report", []string{"home"}, time.Date(2021, time.August, 31, 23, 0, 0, 0, time.UTC), taskstore.StatusInProgress},
+		{"walk the dog", nil, time.Date(2021, time.September, 1, 0, 0, 0, 0, time.UTC), taskstore.StatusOpen},
+		{"Call bob again", []string{"home", "blocked"}, time.Time{}, taskstore.StatusBlocked},
+	}
+
+	for _, task := range tasks {
+		id, err := store.CreateTask(ctx, task.text, task.tags, task.due)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if task.status == taskstore.StatusOpen {
+			continue
+		}
+
+		stored, err := store.GetTask(ctx, id)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored.Status = task.status
+
+		if _, err := store.UpdateTask(ctx, stored); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return store
+}
+
+func sortedIDs(tasks []taskstore.Task) []int {
+	ids := make([]int, 0, len(tasks))
+
+	for _, task := range tasks {
+		ids = append(ids, task.ID)
+	}
+
+	sort.Ints(ids)
+
+	return ids
+}
+
+func TestEval(t *testing.T) {
+	ctx := context.Background()
+	store := newStore(t)
+	all, err := store.GetAllTasks(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		filter string
+		want   []int
+	}{
+		{`tag:work`, []int{0, 1}},
+		{`tag=work`, []int{0, 1}},
+		{`tag:work AND due<2021-08-02`, []int{0}},
+		{`tag:work AND due<2021-09-01 AND NOT tag:blocked`, []int{0, 1}},
+		{`tag:home OR tag:shop`, []int{0, 2, 4}},
+		{`NOT tag:work`, []int{2, 3, 4}},
+		{`tag!=work`, []int{2, 3, 4}},
+		{`tag:nothing`, []int{}},
+		{`text:"call bob"`, []int{1, 4}},
+		{`text="call Bob"`, []int{1}},
+		{`text!="call Bob" AND tag:work`, []int{0}},
+		{`milk OR dog`, []int{0, 3}},
+		{`status:done OR status:blocked`, []int{1, 4}},
+		{`status!=open`, []int{1, 2, 4}},
+		{`status:open tag:work`, []int{0}},
+		{`due:2021-08-31`, []int{2}},
+		{`due!=2021-08-31`, []int{0, 1, 3, 4}},
+		{`due>=2021-09-01`, []int{3}},
+		{`due>2021-08-31`, []int{3}},
+		{`due<=2021-08-01`, []int{0, 4}}, // no due date is before any
+		{`due=2021-08-02T10:00:00Z`, []int{1}},
+		{`due=2021-08-02T12:00:00+02:00`, []int{1}},
+		{`due>=2021-08-01 due<2021-08-02 OR tag:blocked`, []int{0, 4}},
+		{`due>2021-08-31 due<2021-08-01`, []int{}},
+		{`due<2021-09-01 AND id>=2`, []int{2, 4}},
+		{`id>=3`, []int{3, 4}},
+		{`id=2 OR id:12`, []int{2}},
+		{`(tag:work OR tag:home) AND due<2021-08-31`, []int{0, 1, 4}},
+		{`(tag:work OR milk) AND NOT status:done`, []int{0}},
+		{`NOT (tag:work OR tag:home)`, []int{3}},
+	}
+
+	for _, test := range tests {
+		expr, err := filter.Parse(test.filter, nil)
+
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.filter, err)
+			continue
+		}
+
+		tasks, err := filter.Eval(ctx, store, expr)
+
+		if err != nil {
+			t.Errorf("Eval(%q): %v", test.filter, err)
+			continue
+		}
+
+		got := sortedIDs(tasks)
+
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("Eval(%q) = %v, want %v", test.filter, got, test.want)
+		}
+
+		// whatever lookup the filter is planned with, it finds what a scan finds
+		var scanned []taskstore.Task
+
+		for _, task := range all {
+			if expr.Match(task) {
+				scanned = append(scanned, task)
+			}
+		}
+
+		if fmt.Sprint(sortedIDs(scanned)) != fmt.Sprint(got) {
+			t.Errorf("Eval(%q) = %v, but a scan matches %v", test.filter, got, sortedIDs(scanned))
+		}
+	}
+}
+
+func TestEvalDatesInZone(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+
+	if err != nil {
+		t.Skip(err)
+	}
+
+	// Aug 31 in Los Angeles runs from 07:00 UTC to 07:00 UTC the next day
+	expr, err := filter.Parse(`due:2021-08-31`, la)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tasks, err := filter.Eval(context.Background(), newStore(t), expr)
+
+	if got := sortedIDs(tasks); err != nil || fmt.Sprint(got) != "[2 3]" {
+		t.Errorf("Eval(due:2021-08-31) in Los Angeles = %v, %v; want [2 3]", got, err)
+	}
+}
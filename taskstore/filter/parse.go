@@ -0,0 +1,380 @@
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+// Error is a syntax or value error in a filter, located at the offending token
+type Error struct {
+	Filter string
+	Pos    int    // byte offset of the token in Filter
+	Token  string // the token, "" at the end of the filter
+	Msg    string
+}
+
+// Column is the 1-based column of the offending token
+func (e *Error) Column() int {
+	return utf8.RuneCountInString(e.Filter[:e.Pos]) + 1
+}
+
+func (e *Error) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("invalid filter at column %d (end of filter): %s", e.Column(), e.Msg)
+	}
+
+	return fmt.Sprintf("invalid filter at column %d (%q): %s", e.Column(), e.Token, e.Msg)
+}
+
+// Pointer returns the filter with a line of carets under the offending token
+func (e *Error) Pointer() string {
+	width := utf8.RuneCountInString(e.Token)
+
+	if width == 0 {
+		width = 1
+	}
+
+	return e.Filter + "\n" + strings.Repeat(" ", e.Column()-1) + strings.Repeat("^", width)
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString // a quoted string, text holds it unquoted
+	tokenOp
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+	raw  string // the token as written
+}
+
+// lexer splits a filter into tokens. The value after an op is read by value, which
+// lets it hold characters that are operators elsewhere, like the colons of a time.
+type lexer struct {
+	input string
+	pos   int
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.input) && strings.IndexByte(" \t\r\n", l.input[l.pos]) >= 0 {
+		l.pos++
+	}
+}
+
+func (l *lexer) next() (token, error) {
+	l.skipSpace()
+
+	start := l.pos
+
+	if start == len(l.input) {
+		return token{kind: tokenEOF, pos: start}, nil
+	}
+
+	switch c := l.input[start]; {
+	case c == '(':
+		l.pos++
+		return token{kind: tokenLParen, text: "(", pos: start, raw: "("}, nil
+	case c == ')':
+		l.pos++
+		return token{kind: tokenRParen, text: ")", pos: start, raw: ")"}, nil
+	case c == '"':
+		return l.quoted()
+	case strings.IndexByte(":=!<>", c) >= 0:
+		for _, op := range []Op{OpNotEqual, OpLessEq, OpGreaterEq, OpContains, OpEqual, OpLess, OpGreater} {
+			if strings.HasPrefix(l.input[start:], string(op)) {
+				l.pos += len(op)
+				return token{kind: tokenOp, text: string(op), pos: start, raw: string(op)}, nil
+			}
+		}
+
+		l.pos++
+		return token{}, &Error{Filter: l.input, Pos: start, Token: l.input[start:l.pos], Msg: "expect an operator like : = != < <= > >="}
+	}
+
+	for l.pos < len(l.input) && strings.IndexByte(" \t\r\n()\":=!<>", l.input[l.pos]) < 0 {
+		l.pos++
+	}
+
+	return token{kind: tokenWord, text: l.input[start:l.pos], pos: start, raw: l.input[start:l.pos]}, nil
+}
+
+// value reads the value after an op: a quoted string, or everything up to a space or ')'
+func (l *lexer) value() (token, error) {
+	start := l.pos
+
+	if start < len(l.input) && l.input[start] == '"' {
+		return l.quoted()
+	}
+
+	for l.pos < len(l.input) && strings.IndexByte(" \t\r\n()", l.input[l.pos]) < 0 {
+		l.pos++
+	}
+
+	if l.pos == start {
+		return token{kind: tokenEOF, pos: start}, nil
+	}
+
+	return token{kind: tokenWord, text: l.input[start:l.pos], pos: start, raw: l.input[start:l.pos]}, nil
+}
+
+// quoted reads a double quoted string, with Go escapes like \" and \\
+func (l *lexer) quoted() (token, error) {
+	start := l.pos
+	l.pos++
+
+	for l.pos < len(l.input) && l.input[l.pos] != '"' {
+		if l.input[l.pos] == '\\' {
+			l.pos++
+		}
+
+		l.pos++
+	}
+
+	if l.pos >= len(l.input) {
+		l.pos = len(l.input)
+		return token{}, &Error{Filter: l.input, Pos: start, Token: l.input[start:], Msg: "missing closing quote"}
+	}
+
+	l.pos++
+	raw := l.input[start:l.pos]
+	text, err := strconv.Unquote(raw)
+
+	if err != nil {
+		return token{}, &Error{Filter: l.input, Pos: start, Token: raw, Msg: "invalid escape in quoted string"}
+	}
+
+	return token{kind: tokenString, text: text, pos: start, raw: raw}, nil
+}
+
+// parser is a recursive descent parser over the lexer, one token ahead:
+//
+//	or    = and { "OR" and }
+//	and   = unary { ["AND"] unary }
+//	unary = "NOT" unary | "(" or ")" | term
+//	term  = field op value | word | string
+type parser struct {
+	lexer lexer
+	tok   token
+	loc   *time.Location
+}
+
+// Parse parses a filter; dates in it stand for days in loc, UTC when loc is nil.
+// Errors are *Error.
+func Parse(s string, loc *time.Location) (Expr, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	p := &parser{lexer: lexer{input: s}, loc: loc}
+
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	if p.tok.kind == tokenEOF {
+		return nil, p.errorf("empty filter, expect a term like tag:work")
+	}
+
+	expr, err := p.or()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p.tok.kind == tokenRParen {
+		return nil, p.errorf("unexpected ), no ( to close")
+	}
+
+	return expr, nil
+}
+
+func (p *parser) advance() (err error) {
+	p.tok, err = p.lexer.next()
+
+	return err
+}
+
+func (p *parser) errorf(format string, args ...interface{}) *Error {
+	return &Error{Filter: p.lexer.input, Pos: p.tok.pos, Token: p.tok.raw, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) keyword(word string) bool {
+	return p.tok.kind == tokenWord && p.tok.text == word
+}
+
+func (p *parser) or() (Expr, error) {
+	left, err := p.and()
+
+	for err == nil && p.keyword("OR") {
+		var right Expr
+
+		if err = p.advance(); err == nil {
+			right, err = p.and()
+			left = Or{Left: left, Right: right}
+		}
+	}
+
+	return left, err
+}
+
+func (p *parser) and() (Expr, error) {
+	left, err := p.unary()
+
+	for err == nil {
+		if p.keyword("AND") {
+			if err = p.advance(); err != nil {
+				break
+			}
+		} else if p.tok.kind == tokenEOF || p.tok.kind == tokenRParen || p.keyword("OR") {
+			break
+		}
+
+		var right Expr
+
+		right, err = p.unary()
+		left = And{Left: left, Right: right}
+	}
+
+	return left, err
+}
+
+func (p *parser) unary() (Expr, error) {
+	switch {
+	case p.keyword("NOT"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		expr, err := p.unary()
+
+		return Not{Expr: expr}, err
+	case p.tok.kind == tokenLParen:
+		open := p.tok
+
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		expr, err := p.or()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if p.tok.kind != tokenRParen {
+			return nil, &Error{Filter: p.lexer.input, Pos: open.pos, Token: open.raw, Msg: "missing ) to close this ("}
+		}
+
+		return expr, p.advance()
+	case p.tok.kind == tokenEOF:
+		return nil, p.errorf("expect a term like tag:work")
+	case p.tok.kind == tokenRParen, p.tok.kind == tokenOp, p.keyword("AND"), p.keyword("OR"):
+		return nil, p.errorf("unexpected %s, expect a term like tag:work", p.tok.raw)
+	}
+
+	return p.term()
+}
+
+func (p *parser) term() (Expr, error) {
+	word := p.tok
+
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	// a bare word or quoted string searches the text
+	if word.kind == tokenString || p.tok.kind != tokenOp || p.tok.pos != word.pos+len(word.raw) {
+		return &Term{Field: FieldText, Op: OpContains, Value: word.text}, nil
+	}
+
+	op := p.tok
+	field := Field(word.text)
+
+	if _, ok := ops[field]; !ok {
+		return nil, &Error{Filter: p.lexer.input, Pos: word.pos, Token: word.raw,
+			Msg: fmt.Sprintf("unknown field %q, expect one of %v", word.text, Fields)}
+	}
+
+	if !allowed(field, Op(op.text)) {
+		return nil, p.errorf("%s does not take %s, only %v", field, op.text, ops[field])
+	}
+
+	value, err := p.lexer.value()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if value.kind == tokenEOF {
+		return nil, &Error{Filter: p.lexer.input, Pos: word.pos, Token: word.raw + op.raw,
+			Msg: fmt.Sprintf("expect a value after %s%s", word.text, op.text)}
+	}
+
+	p.tok = value
+	term := &Term{Field: field, Op: Op(op.text), Value: value.text}
+
+	if err := p.resolve(term); err != nil {
+		return nil, err
+	}
+
+	return term, p.advance()
+}
+
+func allowed(field Field, op Op) bool {
+	for _, allowed := range ops[field] {
+		if op == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolve parses the value of a term for its field; p.tok is the value
+func (p *parser) resolve(term *Term) error {
+	switch term.Field {
+	case FieldStatus:
+		status, err := taskstore.ParseStatus(term.Value)
+
+		if err != nil {
+			return p.errorf("unknown status, expect one of %v", taskstore.Statuses)
+		}
+
+		term.status = status
+	case FieldID:
+		id, err := strconv.Atoi(term.Value)
+
+		if err != nil {
+			return p.errorf("expect a number for id")
+		}
+
+		term.id = id
+	case FieldDue:
+		if t, err := time.Parse(time.RFC3339Nano, term.Value); err == nil {
+			term.from, term.to = t, t.Add(time.Nanosecond)
+			return nil
+		}
+
+		day, err := time.ParseInLocation("2006-01-02", term.Value, p.loc)
+
+		if err != nil {
+			return p.errorf("expect a date (YYYY-MM-DD) or an RFC 3339 time for due")
+		}
+
+		term.from, term.to = taskstore.DayRange(day.Year(), day.Month(), day.Day(), p.loc)
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package taskstore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Action is the kind of mutation a revision records
+type Action string
+
+const (
+	ActionCreated  Action = "created"
+	ActionUpdated  Action = "updated"
+	ActionDeleted  Action = "deleted"
+	ActionRestored Action = "restored"
+	ActionReverted Action = "reverted"
+)
+
+// Revision is an immutable record of one mutation of a task. Stores number the revisions
+// of each task from 1 in the order they happened.
+type Revision struct {
+	TaskID int       `json:"task_id"`
+	Number int       `json:"number"`
+	Action Action    `json:"action"`
+	Author string    `json:"author,omitempty"` // empty when nobody was signed in
+	At     time.Time `json:"at"`
+	// Changes are the fields the mutation changed, as they were before and after it
+	Changes []Change `json:"changes"`
+	// Task is the task as the mutation left it
+	Task Task `json:"task"`
+}
+
+// Change is a field of a task changed by a mutation
+type Change struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// RevisionNotFound builds the error a Store returns when a task has no revision number;
+// it wraps ErrNotFound.
+func RevisionNotFound(id, number int) error {
+	return fmt.Errorf("revision %d of task with id = %d %w", number, id, ErrNotFound)
+}
+
+// FindRevision returns the revision number of history, which is ordered by number,
+// or RevisionNotFound for the task with id.
+func FindRevision(history []Revision, id, number int) (Revision, error) {
+	i := sort.Search(len(history), func(i int) bool { return history[i].Number >= number })
+
+	if i == len(history) || history[i].Number != number {
+		return Revision{}, RevisionNotFound(id, number)
+	}
+
+	return history[i], nil
+}
+
+// CheckRevision returns an error for a revision that cannot be put in a history:
+// one without a number.
+func CheckRevision(rev Revision) error {
+	if rev.Number < 1 {
+		return fmt.Errorf("revision of task with id = %d has no number", rev.TaskID)
+	}
+
+	return nil
+}
+
+type authorContextKey struct{}
+
+// WithAuthor returns a context in which the store mutations are recorded as made by
+// author; authentication middleware uses it with the signed in user.
+func WithAuthor(ctx context.Context, author string) context.Context {
+	return context.WithValue(ctx, authorContextKey{}, author)
+}
+
+// Author returns the author of the mutations made with ctx, "" for nobody
+func Author(ctx context.Context) string {
+	author, _ := ctx.Value(authorContextKey{}).(string)
+
+	return author
+}
+
+// NewRevision returns the revision of a mutation that turned before into after, made
+// with ctx at at; the store fills in its Number. before is the zero Task for a creation.
+func NewRevision(ctx context.Context, action Action, before, after Task, at time.Time) Revision {
+	return Revision{
+		TaskID:  after.ID,
+		Action:  action,
+		Author:  Author(ctx),
+		At:      at.UTC(),
+		Changes: Diff(before, after),
+		Task:    after,
+	}
+}
+
+// Diff lists the fields that differ between two states of a task; the version, which
+// changes with every update, is left out.
+func Diff(before, after Task) []Change {
+	changes := []Change{}
+
+	add := func(field string, from, to interface{}) {
+		changes = append(changes, Change{Field: field, From: from, To: to})
+	}
+
+	if before.Text != after.Text {
+		add("text", before.Text, after.Text)
+	}
+
+	if !equalTags(before.Tags, after.Tags) {
+		add("tags", before.Tags, after.Tags)
+	}
+
+	if !before.Due.Equal(after.Due) {
+		add("due", before.Due, after.Due)
+	}
+
+	if before.Status != after.Status {
+		add("status", before.Status, after.Status)
+	}
+
+	if !equalTimes(before.CompletedAt, after.CompletedAt) {
+		add("completed_at", before.CompletedAt, after.CompletedAt)
+	}
+
+	if !equalTimes(before.DeletedAt, after.DeletedAt) {
+		add("deleted_at", before.DeletedAt, after.DeletedAt)
+	}
+
+	return changes
+}
+
+func equalTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func equalTimes(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Equal(*b)
+}
+
+// ApplyRevert returns the task a Store keeps when current is reverted to the state rev
+// left it in: its text, tags, due time, status and completion time, at the next version.
+// The status has to be reachable from the current one (see CheckTransition), as for an
+// update. version is the version of current the caller expects (0 for any).
+func ApplyRevert(current Task, rev Revision, version int) (Task, error) {
+	if err := CheckVersion(current, version); err != nil {
+		return Task{}, err
+	}
+
+	reverted := Upgrade(rev.Task)
+
+	if err := CheckTransition(current.Status, reverted.Status); err != nil {
+		return Task{}, err
+	}
+
+	reverted.ID = current.ID
+	reverted.Version = current.Version + 1
+	reverted.DeletedAt = nil
+	reverted.Owner = current.Owner
+
+	return reverted, nil
+}
@@ -0,0 +1,225 @@
+package taskstore
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SortField names what a listing of tasks is sorted by
+type SortField string
+
+const (
+	SortByID   SortField = "id"
+	SortByDue  SortField = "due"
+	SortByText SortField = "text"
+	// SortByCreated sorts like SortByID: ids are handed out in creation order
+	SortByCreated SortField = "created"
+	// SortByDeleted sorts the trash by when tasks were deleted; live tasks sort like SortByID
+	SortByDeleted SortField = "deleted"
+)
+
+// SortFields lists every field a listing of live tasks can be sorted by
+var SortFields = []SortField{SortByID, SortByDue, SortByText, SortByCreated}
+
+// TrashSortFields lists every field a listing of the trash can be sorted by
+var TrashSortFields = []SortField{SortByID, SortByDue, SortByText, SortByCreated, SortByDeleted}
+
+// MaxPageLimit is the largest page a listing hands out at once
+const MaxPageLimit = 1000
+
+// Order is how a listing is sorted: a field, ascending unless Desc.
+// Ties are broken by id in the same direction, so every order is total and stable.
+type Order struct {
+	Field SortField
+	Desc  bool
+}
+
+// ParseOrder parses an order written as one of fields, prefixed with "-" for descending (-due)
+func ParseOrder(s string, fields []SortField) (Order, error) {
+	order := Order{Field: SortField(strings.TrimPrefix(s, "-")), Desc: strings.HasPrefix(s, "-")}
+
+	for _, field := range fields {
+		if order.Field == field {
+			return order, nil
+		}
+	}
+
+	return Order{}, fmt.Errorf("unknown sort %q, expect one of %v, prefixed with - for descending", s, fields)
+}
+
+func (o Order) String() string {
+	if o.Desc {
+		return "-" + string(o.Field)
+	}
+
+	return string(o.Field)
+}
+
+// SortKey holds the fields of a task that listings are sorted by
+type SortKey struct {
+	ID      int
+	Due     time.Time
+	Text    string
+	Deleted time.Time // zero for a live task
+}
+
+func (task Task) SortKey() SortKey {
+	key := SortKey{ID: task.ID, Due: task.Due, Text: task.Text}
+
+	if task.DeletedAt != nil {
+		key.Deleted = *task.DeletedAt
+	}
+
+	return key
+}
+
+// Less reports whether a comes before b in this order
+func (o Order) Less(a, b SortKey) bool {
+	if o.Desc {
+		a, b = b, a
+	}
+
+	switch o.Field {
+	case SortByDue:
+		if !a.Due.Equal(b.Due) {
+			return a.Due.Before(b.Due)
+		}
+	case SortByText:
+		if a.Text != b.Text {
+			return a.Text < b.Text
+		}
+	case SortByDeleted:
+		if !a.Deleted.Equal(b.Deleted) {
+			return a.Deleted.Before(b.Deleted)
+		}
+	}
+
+	return a.ID < b.ID
+}
+
+// ErrInvalidCursor is returned (wrapped) for a cursor that was not handed out
+// for the order it is used with; check for it with errors.Is.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursor is what an opaque cursor encodes: the key of the last item of a page,
+// limited to what the order compares, and the order itself.
+type cursor struct {
+	Order   string     `json:"o"`
+	ID      int        `json:"i"`
+	Due     *time.Time `json:"d,omitempty"`
+	Text    *string    `json:"t,omitempty"`
+	Deleted *time.Time `json:"x,omitempty"` // "d" is taken by Due
+}
+
+// Cursor returns the opaque cursor of the page ending with key in this order
+func (o Order) Cursor(key SortKey) string {
+	c := cursor{Order: o.String(), ID: key.ID}
+
+	switch o.Field {
+	case SortByDue:
+		c.Due = &key.Due
+	case SortByText:
+		c.Text = &key.Text
+	case SortByDeleted:
+		c.Deleted = &key.Deleted
+	}
+
+	js, _ := json.Marshal(c)
+
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+// ParseCursor returns the key a cursor handed out by Cursor points after
+func (o Order) ParseCursor(s string) (SortKey, error) {
+	var c cursor
+
+	js, err := base64.RawURLEncoding.DecodeString(s)
+
+	if err == nil {
+		err = json.Unmarshal(js, &c)
+	}
+
+	if err != nil {
+		return SortKey{}, fmt.Errorf("%w %q", ErrInvalidCursor, s)
+	}
+
+	if c.Order != o.String() {
+		return SortKey{}, fmt.Errorf("%w: cursor %q belongs to sort %s, not %s", ErrInvalidCursor, s, c.Order, o)
+	}
+
+	key := SortKey{ID: c.ID}
+
+	if c.Due != nil {
+		key.Due = *c.Due
+	}
+
+	if c.Text != nil {
+		key.Text = *c.Text
+	}
+
+	if c.Deleted != nil {
+		key.Deleted = *c.Deleted
+	}
+
+	return key, nil
+}
+
+// Page sorts a listing of n items in order and returns the bounds [start, end) of the page
+// following cursor ("" for the first page) with at most limit items (0 for no limit), and
+// the cursor of the page after it ("" when this is the last one). key returns the sort key
+// of the i-th item and swap exchanges two items, as for sort.Slice. Since a cursor holds a
+// key rather than a position, pages neither skip nor repeat items when others are created
+// or deleted in between.
+func Page(n int, key func(i int) SortKey, swap func(i, j int), order Order, cursor string, limit int) (int, int, string, error) {
+	sort.Sort(listing{n: n, key: key, swap: swap, order: order})
+
+	start, end := 0, n
+
+	if cursor != "" {
+		after, err := order.ParseCursor(cursor)
+
+		if err != nil {
+			return 0, 0, "", err
+		}
+
+		start = sort.Search(n, func(i int) bool { return order.Less(after, key(i)) })
+	}
+
+	if limit > 0 && end-start > limit {
+		end = start + limit
+
+		return start, end, order.Cursor(key(end - 1)), nil
+	}
+
+	return start, end, "", nil
+}
+
+// PageTasks is Page for a listing of tasks; it sorts tasks in place.
+func PageTasks(tasks []Task, order Order, cursor string, limit int) ([]Task, string, error) {
+	start, end, next, err := Page(len(tasks),
+		func(i int) SortKey { return tasks[i].SortKey() },
+		func(i, j int) { tasks[i], tasks[j] = tasks[j], tasks[i] },
+		order, cursor, limit)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return tasks[start:end], next, nil
+}
+
+type listing struct {
+	n     int
+	key   func(i int) SortKey
+	swap  func(i, j int)
+	order Order
+}
+
+func (l listing) Len() int           { return l.n }
+func (l listing) Less(i, j int) bool { return l.order.Less(l.key(i), l.key(j)) }
+func (l listing) Swap(i, j int)      { l.swap(i, j) }
@@ -0,0 +1,196 @@
+package taskstore_test
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+func TestParseOrder(t *testing.T) {
+	tests := []struct {
+		s    string
+		want taskstore.Order
+		ok   bool
+	}{
+		{"id", taskstore.Order{Field: taskstore.SortByID}, true},
+		{"-due", taskstore.Order{Field: taskstore.SortByDue, Desc: true}, true},
+		{"text", taskstore.Order{Field: taskstore.SortByText}, true},
+		{"-created", taskstore.Order{Field: taskstore.SortByCreated, Desc: true}, true},
+		{"prio", taskstore.Order{}, false},
+		{"--due", taskstore.Order{}, false},
+		{"", taskstore.Order{}, false},
+	}
+
+	for _, test := range tests {
+		order, err := taskstore.ParseOrder(test.s, taskstore.SortFields)
+
+		if (err == nil) != test.ok || order != test.want {
+			t.Errorf("ParseOrder(%q) = %v, %v; want %v, ok %v", test.s, order, err, test.want, test.ok)
+		}
+
+		if test.ok && order.String() != test.s {
+			t.Errorf("ParseOrder(%q).String() = %q", test.s, order.String())
+		}
+	}
+
+	// live tasks have not been deleted, only the trash sorts by when that was
+	if _, err := taskstore.ParseOrder("-deleted", taskstore.SortFields); err == nil {
+		t.Error("ParseOrder(\"-deleted\") of a listing of live tasks succeeded")
+	}
+
+	if order, err := taskstore.ParseOrder("-deleted", taskstore.TrashSortFields); err != nil || order != taskstore.ByDeleted {
+		t.Errorf("ParseOrder(\"-deleted\") of the trash = %v, %v; want %v", order, err, taskstore.ByDeleted)
+	}
+}
+
+// pageTasks returns tasks that tie on due times and texts, listed out of every order
+func pageTasks() []taskstore.Task {
+	day := time.Date(2021, time.August, 1, 9, 0, 0, 0, time.UTC)
+	paris := time.FixedZone("CEST", 2*60*60)
+
+	return []taskstore.Task{
+		{ID: 4, Text: "b", Due: day},
+		{ID: 0, Text: "c", Due: day.Add(time.Hour)},
+		{ID: 6, Text: "a", Due: day.In(paris)}, // the same instant as task 4
+		{ID: 2, Text: "b", Due: day.Add(-time.Hour)},
+		{ID: 5, Text: "a", Due: day.Add(time.Hour)},
+		{ID: 1, Text: "c", Due: day},
+		{ID: 3, Text: "a"},
+	}
+}
+
+func ids(tasks []taskstore.Task) []int {
+	ids := make([]int, 0, len(tasks))
+
+	for _, task := range tasks {
+		ids = append(ids, task.ID)
+	}
+
+	return ids
+}
+
+func TestPageTasksWalk(t *testing.T) {
+	for _, field := range taskstore.SortFields {
+		for _, desc := range []bool{false, true} {
+			order := taskstore.Order{Field: field, Desc: desc}
+
+			all := pageTasks()
+			sort.Slice(all, func(i, j int) bool { return order.Less(all[i].SortKey(), all[j].SortKey()) })
+			want := fmt.Sprint(ids(all))
+
+			for _, limit := range []int{1, 2, 3, 7, 0} {
+				var got []int
+				cursor := ""
+
+				for pages := 0; ; pages++ {
+					if pages > len(all) {
+						t.Fatalf("%s, limit %d: no last page after %d pages", order, limit, pages)
+					}
+
+					page, next, err := taskstore.PageTasks(pageTasks(), order, cursor, limit)
+
+					if err != nil {
+						t.Fatalf("%s, limit %d, cursor %q: %v", order, limit, cursor, err)
+					}
+
+					if limit > 0 && len(page) > limit {
+						t.Fatalf("%s, limit %d: page of %d tasks", order, limit, len(page))
+					}
+
+					got = append(got, ids(page)...)
+
+					if next == "" {
+						break
+					}
+
+					cursor = next
+				}
+
+				if fmt.Sprint(got) != want {
+					t.Errorf("%s, limit %d: walked %v, want %v", order, limit, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestPageTasksAcrossChanges(t *testing.T) {
+	order := taskstore.Order{Field: taskstore.SortByText}
+	tasks := pageTasks()
+
+	// a: 3, 5, 6  b: 2, 4  c: 0, 1
+	page, next, err := taskstore.PageTasks(tasks, order, "", 3)
+
+	if err != nil || fmt.Sprint(ids(page)) != "[3 5 6]" {
+		t.Fatalf("first page = %v, %q, %v; want [3 5 6]", ids(page), next, err)
+	}
+
+	// the last task seen goes and tasks come before and after the cursor
+	tasks = pageTasks()
+
+	for i, task := range tasks {
+		if task.ID == 6 {
+			tasks = append(tasks[:i], tasks[i+1:]...)
+			break
+		}
+	}
+
+	tasks = append(tasks, taskstore.Task{ID: 7, Text: "A"}, taskstore.Task{ID: 8, Text: "b"})
+
+	page, _, err = taskstore.PageTasks(tasks, order, next, 3)
+
+	if err != nil || fmt.Sprint(ids(page)) != "[2 4 8]" {
+		t.Errorf("page after the changes = %v, %v; want [2 4 8], neither skipping nor repeating a task", ids(page), err)
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	due := time.Date(2021, time.August, 1, 9, 30, 0, 1, time.FixedZone("CEST", 2*60*60))
+	key := taskstore.SortKey{ID: 12, Due: due, Text: "buy milk"}
+
+	tests := []struct {
+		order taskstore.Order
+		want  taskstore.SortKey
+	}{
+		// a cursor keeps only what its order compares
+		{taskstore.Order{Field: taskstore.SortByID}, taskstore.SortKey{ID: 12}},
+		{taskstore.Order{Field: taskstore.SortByCreated, Desc: true}, taskstore.SortKey{ID: 12}},
+		{taskstore.Order{Field: taskstore.SortByDue}, taskstore.SortKey{ID: 12, Due: due}},
+		{taskstore.Order{Field: taskstore.SortByText, Desc: true}, taskstore.SortKey{ID: 12, Text: "buy milk"}},
+	}
+
+	for _, test := range tests {
+		got, err := test.order.ParseCursor(test.order.Cursor(key))
+
+		if err != nil || got.ID != test.want.ID || !got.Due.Equal(test.want.Due) || got.Text != test.want.Text {
+			t.Errorf("%s: ParseCursor(Cursor(%+v)) = %+v, %v; want %+v", test.order, key, got, err, test.want)
+		}
+	}
+}
+
+func TestMalformedCursor(t *testing.T) {
+	byDue := taskstore.Order{Field: taskstore.SortByDue}
+	byText := taskstore.Order{Field: taskstore.SortByText}
+	key := taskstore.SortKey{ID: 1, Text: "a"}
+
+	cursors := map[string]string{
+		"not base64":           "!!!",
+		"not JSON":             "bm90IGpzb24",
+		"of another order":     byText.Cursor(key),
+		"of another direction": taskstore.Order{Field: taskstore.SortByDue, Desc: true}.Cursor(key),
+	}
+
+	for name, cursor := range cursors {
+		if _, err := byDue.ParseCursor(cursor); !errors.Is(err, taskstore.ErrInvalidCursor) {
+			t.Errorf("ParseCursor of a cursor %s = %v, want ErrInvalidCursor", name, err)
+		}
+
+		if _, _, err := taskstore.PageTasks(pageTasks(), byDue, cursor, 2); !errors.Is(err, taskstore.ErrInvalidCursor) {
+			t.Errorf("PageTasks with a cursor %s = %v, want ErrInvalidCursor", name, err)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package taskstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SearchResult is a task found by a full-text search
+type SearchResult struct {
+	Task  Task    `json:"task"`
+	Score float64 `json:"score"`
+	// Snippet is an HTML excerpt of the task text around the words found, each in <mark>
+	Snippet string `json:"snippet"`
+}
+
+// Searcher is implemented by the stores that keep a full-text index of task texts;
+// use Search to search any store.
+type Searcher interface {
+	// SearchTasks returns the tasks whose text has every word of query, best first;
+	// a limit of 0 returns them all.
+	SearchTasks(ctx context.Context, query string, limit int) ([]SearchResult, error)
+}
+
+// ErrEmptyQuery is returned (wrapped) for a search query without any word; check for it
+// with errors.Is.
+var ErrEmptyQuery = errors.New("no words to search for")
+
+// Search runs a full-text search on store, through its own index when it is a Searcher
+// and otherwise by indexing every task on the fly.
+func Search(ctx context.Context, store Store, query string, limit int) ([]SearchResult, error) {
+	if searcher, ok := store.(Searcher); ok {
+		return searcher.SearchTasks(ctx, query, limit)
+	}
+
+	tasks, err := store.GetAllTasks(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var ix TextIndex
+	byID := make(map[int]Task, len(tasks))
+
+	for _, task := range tasks {
+		ix.Add(task.ID, task.Text)
+		byID[task.ID] = task
+	}
+
+	return ix.Results(query, limit, func(id int) Task { return byID[id] })
+}
+
+// word is a token of a text: its stem and where it is in the text
+type word struct {
+	stem       string
+	start, end int
+}
+
+// words splits text into words (runs of letters and digits), lowercased and stemmed
+func words(text string) []word {
+	var ws []word
+
+	start := -1
+
+	for i, r := range text + " " {
+		letter := unicode.IsLetter(r) || unicode.IsDigit(r)
+
+		if letter && start < 0 {
+			start = i
+		} else if !letter && start >= 0 {
+			ws = append(ws, word{stem: stem(strings.ToLower(text[start:i])), start: start, end: i})
+			start = -1
+		}
+	}
+
+	return ws
+}
+
+// stem strips the common English inflections, so that "reports", "reported" and
+// "reporting" are all found by "report". It only needs to treat a word and the query
+// words that should find it alike, not to produce dictionary words.
+func stem(w string) string {
+	for _, rule := range []struct {
+		suffix, replacement string
+		min                 int // shortest word the rule applies to
+	}{
+		{"ies", "y", 5},
+		{"sses", "ss", 5},
+		{"ing", "", 6},
+		{"ed", "", 5},
+		{"ly", "", 5},
+		{"es", "", 5},
+		{"s", "", 4},
+	} {
+		if len(w) >= rule.min && strings.HasSuffix(w, rule.suffix) {
+			if rule.suffix == "s" && strings.HasSuffix(w, "ss") {
+				return w
+			}
+
+			return strings.TrimSuffix(w, rule.suffix) + rule.replacement
+		}
+	}
+
+	return w
+}
+
+// queryStems returns the distinct stems of the words of a query
+func queryStems(query string) []string {
+	var stems []string
+	seen := make(map[string]bool)
+
+	for _, w := range words(query) {
+		if !seen[w.stem] {
+			seen[w.stem] = true
+			stems = append(stems, w.stem)
+		}
+	}
+
+	return stems
+}
+
+// TextIndex is an inverted index from the word stems of task texts to the tasks that have
+// them. Query words match the stems they are a prefix of, so "rep" finds "report".
+// The zero value is empty; concurrent Search calls are safe, but Add, Remove and Reset
+// need exclusive access.
+type TextIndex struct {
+	postings map[string]map[int]int // stem -> task id -> occurrences
+	stems    []string               // the stems in postings, sorted for prefix lookups
+	docs     int
+}
+
+func (ix *TextIndex) Add(id int, text string) {
+	if ix.postings == nil {
+		ix.postings = make(map[string]map[int]int)
+	}
+
+	ix.docs++
+
+	for _, w := range words(text) {
+		ids, ok := ix.postings[w.stem]
+
+		if !ok {
+			ids = make(map[int]int)
+			ix.postings[w.stem] = ids
+
+			i := sort.SearchStrings(ix.stems, w.stem)
+			ix.stems = append(ix.stems, "")
+			copy(ix.stems[i+1:], ix.stems[i:])
+			ix.stems[i] = w.stem
+		}
+
+		ids[id]++
+	}
+}
+
+// Remove takes out the task id, which was added with text
+func (ix *TextIndex) Remove(id int, text string) {
+	ix.docs--
+
+	for _, w := range words(text) {
+		ids, ok := ix.postings[w.stem]
+
+		if !ok {
+			continue
+		}
+
+		delete(ids, id)
+
+		if len(ids) == 0 {
+			delete(ix.postings, w.stem)
+
+			i := sort.SearchStrings(ix.stems, w.stem)
+			ix.stems = append(ix.stems[:i], ix.stems[i+1:]...)
+		}
+	}
+}
+
+func (ix *TextIndex) Reset() {
+	*ix = TextIndex{}
+}
+
+// Hit is a task found in a TextIndex with its relevance
+type Hit struct {
+	ID    int
+	Score float64
+}
+
+// Search returns the tasks that match every word of query, best first (then by id); see Rank.
+func (ix *TextIndex) Search(query string) ([]Hit, error) {
+	return Rank(query, ix.docs, func(prefix string) (Postings, error) {
+		postings := make(Postings)
+
+		for i := sort.SearchStrings(ix.stems, prefix); i < len(ix.stems) && strings.HasPrefix(ix.stems[i], prefix); i++ {
+			postings[ix.stems[i]] = ix.postings[ix.stems[i]]
+		}
+
+		return postings, nil
+	})
+}
+
+// Results runs Search and returns at most limit results (0 for all), with the tasks
+// looked up by task and their snippets.
+func (ix *TextIndex) Results(query string, limit int, task func(id int) Task) ([]SearchResult, error) {
+	hits, err := ix.Search(query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return Results(hits, query, limit, task), nil
+}
+
+// Postings are the tasks each word stem occurs in: stem -> task id -> occurrences
+type Postings map[string]map[int]int
+
+// Stems returns how many times each word stem occurs in text. It is what a TextIndex keeps
+// of a task; stores keeping their own index keep the same to Rank their tasks alike.
+func Stems(text string) map[string]int {
+	stems := make(map[string]int)
+
+	for _, w := range words(text) {
+		stems[w.stem]++
+	}
+
+	return stems
+}
+
+// Rank returns the tasks of an index of docs tasks that match every word of query, best
+// first (then by id); prefixed returns the postings of the stems starting with a query
+// word. A task scores, for each query word, the occurrences of the best stem it matches,
+// weighted by how rare that stem is (tf-idf); a stem the word is only a prefix of counts
+// half.
+func Rank(query string, docs int, prefixed func(prefix string) (Postings, error)) ([]Hit, error) {
+	stems := queryStems(query)
+
+	if len(stems) == 0 {
+		return nil, fmt.Errorf("%w in %q", ErrEmptyQuery, query)
+	}
+
+	var scores map[int]float64
+
+	for _, q := range stems {
+		postings, err := prefixed(q)
+
+		if err != nil {
+			return nil, err
+		}
+
+		best := make(map[int]float64)
+
+		for stem, ids := range postings {
+			weight := 0.5
+
+			if stem == q {
+				weight = 1
+			}
+
+			idf := math.Log(1 + float64(docs)/float64(len(ids)))
+
+			for id, occurrences := range ids {
+				if score := weight * float64(occurrences) * idf; score > best[id] {
+					best[id] = score
+				}
+			}
+		}
+
+		if scores == nil {
+			scores = best
+			continue
+		}
+
+		for id := range scores {
+			if score, ok := best[id]; ok {
+				scores[id] += score
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+
+	for id, score := range scores {
+		hits = append(hits, Hit{ID: id, Score: score})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+
+		return hits[i].ID < hits[j].ID
+	})
+
+	return hits, nil
+}
+
+// Results returns the search results of at most limit hits (0 for all), with the tasks
+// looked up by task and their snippets.
+func Results(hits []Hit, query string, limit int, task func(id int) Task) []SearchResult {
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	results := make([]SearchResult, 0, len(hits))
+
+	for _, hit := range hits {
+		t := task(hit.ID)
+		results = append(results, SearchResult{Task: t, Score: hit.Score, Snippet: Snippet(t.Text, query)})
+	}
+
+	return results
+}
+
+// snippetWords is how many words of the text a snippet shows at most
+const snippetWords = 20
+
+// Snippet returns an HTML excerpt of text around the first word query matches, with every
+// matching word wrapped in <mark> and an ellipsis where text is cut.
+func Snippet(text, query string) string {
+	stems := queryStems(query)
+	ws := words(text)
+
+	matches := func(w word) bool {
+		for _, q := range stems {
+			if strings.HasPrefix(w.stem, q) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	first := 0
+
+	for i, w := range ws {
+		if matches(w) {
+			first = i
+			break
+		}
+	}
+
+	// show a few words of context before the first match
+	start := first - 5
+
+	if start < 0 {
+		start = 0
+	}
+
+	end := start + snippetWords
+
+	if end > len(ws) {
+		end = len(ws)
+	}
+
+	var b strings.Builder
+
+	from, to := 0, len(text)
+
+	if start > 0 {
+		from = ws[start].start
+		b.WriteString("…")
+	}
+
+	if end < len(ws) {
+		to = ws[end-1].end
+	}
+
+	pos := from
+
+	for _, w := range ws[start:end] {
+		if !matches(w) {
+			continue
+		}
+
+		b.WriteString(html.EscapeString(text[pos:w.start]))
+		b.WriteString("<mark>" + html.EscapeString(text[w.start:w.end]) + "</mark>")
+		pos = w.end
+	}
+
+	b.WriteString(html.EscapeString(text[pos:to]))
+
+	if to < len(text) {
+		b.WriteString("…")
+	}
+
+	return b.String()
+}
@@ -0,0 +1,237 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migrations are applied in order at startup, each one in its own transaction;
+// PRAGMA user_version records how many of them the database has seen.
+// Never edit a migration that has shipped, append a new one instead.
+var migrations = []string{
+	// 1: tasks, their tags and the id counter
+	`
+	CREATE TABLE tasks (
+		id       INTEGER PRIMARY KEY,
+		text     TEXT NOT NULL,
+		due      TEXT NOT NULL, -- RFC 3339 with the offset the client sent
+		due_date TEXT NOT NULL  -- YYYY-MM-DD of due in that offset
+	);
+
+	CREATE INDEX tasks_due_date ON tasks (due_date);
+
+	CREATE TABLE task_tags (
+		task_id  INTEGER NOT NULL REFERENCES tasks (id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		tag      TEXT NOT NULL,
+		PRIMARY KEY (task_id, position)
+	);
+
+	CREATE INDEX task_tags_tag ON task_tags (tag, task_id);
+
+	CREATE TABLE counters (
+		name  TEXT PRIMARY KEY,
+		value INTEGER NOT NULL
+	);
+
+	INSERT INTO counters (name, value) VALUES ('next_task_id', 0);
+	`,
+
+	// 2: optimistic concurrency
+	`
+	ALTER TABLE tasks ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+	`,
+
+	// 3: task lifecycle
+	`
+	ALTER TABLE tasks ADD COLUMN status TEXT NOT NULL DEFAULT 'open';
+	ALTER TABLE tasks ADD COLUMN completed_at TEXT; -- RFC 3339, NULL unless done
+
+	CREATE INDEX tasks_status ON tasks (status);
+	`,
+
+	// 4: due instants, ordered for range queries; filled in for existing rows by backfillDueUTC
+	`
+	ALTER TABLE tasks ADD COLUMN due_utc TEXT; -- due in UTC, formatted with dueUTCLayout
+
+	CREATE INDEX tasks_due_utc ON tasks (due_utc, id);
+	`,
+
+	// 5: full-text search, the word stems of each text as taskstore.Stems finds them;
+	// filled in for existing rows by backfillWords
+	`
+	CREATE TABLE task_words (
+		stem        TEXT NOT NULL,
+		task_id     INTEGER NOT NULL REFERENCES tasks (id) ON DELETE CASCADE,
+		occurrences INTEGER NOT NULL,
+		PRIMARY KEY (stem, task_id)
+	);
+
+	CREATE INDEX task_words_task_id ON task_words (task_id);
+
+	ALTER TABLE tasks ADD COLUMN words_indexed INTEGER NOT NULL DEFAULT 0;
+	`,
+
+	// 6: the trash
+	`
+	ALTER TABLE tasks ADD COLUMN deleted_at TEXT; -- in UTC, formatted with dueUTCLayout; NULL unless in the trash
+
+	CREATE INDEX tasks_deleted_at ON tasks (deleted_at);
+	`,
+
+	// 7: task history; no foreign key to tasks, whose rows updates replace
+	`
+	CREATE TABLE task_revisions (
+		task_id INTEGER NOT NULL,
+		number  INTEGER NOT NULL,
+		action  TEXT NOT NULL,
+		author  TEXT NOT NULL,
+		at      TEXT NOT NULL, -- RFC 3339
+		changes TEXT NOT NULL, -- JSON array of taskstore.Change
+		task    TEXT NOT NULL, -- JSON taskstore.Task as the change left it
+		PRIMARY KEY (task_id, number)
+	);
+	`,
+
+	// 8: task owners
+	`
+	ALTER TABLE tasks ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+	`,
+}
+
+func migrate(ctx context.Context, db *sql.DB) error {
+	var version int
+
+	if err := db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	if version > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than this binary (%d)", version, len(migrations))
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.BeginTx(ctx, nil)
+
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+	}
+
+	if err := backfillDueUTC(ctx, db); err != nil {
+		return err
+	}
+
+	return backfillWords(ctx, db)
+}
+
+// backfillDueUTC computes due_utc for the rows written before migration 4, in Go since
+// SQLite's date functions stop at milliseconds.
+func backfillDueUTC(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, `SELECT id, due FROM tasks WHERE due_utc IS NULL`)
+
+	if err != nil {
+		return err
+	}
+
+	dues := make(map[int]time.Time)
+
+	for rows.Next() {
+		var id int
+		var due string
+
+		if err := rows.Scan(&id, &due); err != nil {
+			rows.Close()
+			return err
+		}
+
+		if dues[id], err = time.Parse(time.RFC3339Nano, due); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil || len(dues) == 0 {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	for id, due := range dues {
+		if _, err := tx.ExecContext(ctx, `UPDATE tasks SET due_utc = ? WHERE id = ?`, dueUTC(due), id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// backfillWords indexes the words of the rows written before migration 5, in Go since
+// the stems are taskstore's.
+func backfillWords(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, `SELECT id, text FROM tasks WHERE words_indexed = 0`)
+
+	if err != nil {
+		return err
+	}
+
+	texts := make(map[int]string)
+
+	for rows.Next() {
+		var id int
+		var text string
+
+		if err := rows.Scan(&id, &text); err != nil {
+			rows.Close()
+			return err
+		}
+
+		texts[id] = text
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil || len(texts) == 0 {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	for id, text := range texts {
+		if err := insertWords(ctx, tx, id, text); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,819 @@
+// Package sqlstore is a taskstore.Store kept in an embedded SQLite database,
+// through a pure Go driver so it builds without cgo. Tags live in their own table
+// and both tags and due dates are indexed, so lookups by either are SQL queries; the
+// word stems of the texts are indexed in task_words for full-text search.
+// Tasks in the trash stay in the tasks table with deleted_at set; revisions are kept in
+// task_revisions, written in the same transaction as the change they record.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+// SQLStore methods are safe to call concurrently.
+type SQLStore struct {
+	db *sql.DB
+}
+
+var (
+	_ taskstore.Migrator = (*SQLStore)(nil)
+	_ taskstore.Searcher = (*SQLStore)(nil)
+)
+
+// Open opens (or creates) the database at path and brings its schema up to date;
+// ":memory:" gives a throwaway database.
+func Open(path string) (*SQLStore, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer anyway, and one connection keeps ":memory:"
+	// databases from being a different database per connection.
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(context.Background(), db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLStore{db: db}, nil
+}
+
+func (ss *SQLStore) Close() error {
+	return ss.db.Close()
+}
+
+func (ss *SQLStore) CreateTask(ctx context.Context, text string, tags []string, due time.Time) (int, error) {
+	tx, err := ss.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	var id int
+
+	err = tx.QueryRowContext(ctx,
+		`UPDATE counters SET value = value + 1 WHERE name = 'next_task_id' RETURNING value - 1`).Scan(&id)
+
+	if err != nil {
+		return 0, err
+	}
+
+	task := taskstore.Task{ID: id, Text: text, Tags: tags, Due: due, Version: 1, Status: taskstore.StatusOpen, Owner: taskstore.TenantOf(ctx).Owner}
+
+	if err := insertTask(ctx, tx, task); err != nil {
+		return 0, err
+	}
+
+	if err := recordRevision(ctx, tx, taskstore.ActionCreated, taskstore.Task{}, task, time.Now()); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// replaceTask stores task in place of the row with its id
+func replaceTask(ctx context.Context, tx *sql.Tx, task taskstore.Task) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM tasks WHERE id = ?`, task.ID); err != nil {
+		return err
+	}
+
+	return insertTask(ctx, tx, task)
+}
+
+func insertTask(ctx context.Context, tx *sql.Tx, task taskstore.Task) error {
+	task = taskstore.Upgrade(task)
+
+	var completedAt, deletedAt sql.NullString
+
+	if task.CompletedAt != nil {
+		completedAt = sql.NullString{String: task.CompletedAt.Format(time.RFC3339Nano), Valid: true}
+	}
+
+	if task.DeletedAt != nil {
+		deletedAt = sql.NullString{String: dueUTC(*task.DeletedAt), Valid: true}
+	}
+
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO tasks (id, text, due, due_date, due_utc, version, status, completed_at, deleted_at, owner) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		task.ID, task.Text, task.Due.Format(time.RFC3339Nano), task.Due.Format(dateLayout), dueUTC(task.Due),
+		task.Version, string(task.Status), completedAt, deletedAt, task.Owner)
+
+	if err != nil {
+		return err
+	}
+
+	if err := insertWords(ctx, tx, task.ID, task.Text); err != nil {
+		return err
+	}
+
+	for position, tag := range task.Tags {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO task_tags (task_id, position, tag) VALUES (?, ?, ?)`, task.ID, position, tag)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// insertWords indexes the word stems of the text of task id; they go when its row does
+func insertWords(ctx context.Context, tx *sql.Tx, id int, text string) error {
+	for stem, occurrences := range taskstore.Stems(text) {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO task_words (stem, task_id, occurrences) VALUES (?, ?, ?)`, stem, id, occurrences)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.ExecContext(ctx, `UPDATE tasks SET words_indexed = 1 WHERE id = ?`, id)
+
+	return err
+}
+
+const dateLayout = "2006-01-02"
+
+// dueUTCLayout is fixed width, so due_utc values sort in time order as text;
+// deleted_at uses it too.
+const dueUTCLayout = "2006-01-02T15:04:05.000000000Z"
+
+func dueUTC(due time.Time) string {
+	return due.UTC().Format(dueUTCLayout)
+}
+
+func (ss *SQLStore) GetTask(ctx context.Context, id int) (taskstore.Task, error) {
+	tasks, err := ss.queryTasks(ctx, `t.id = ?`, id)
+
+	if err != nil {
+		return taskstore.Task{}, err
+	}
+
+	if len(tasks) == 0 {
+		return taskstore.Task{}, taskstore.NotFound(id)
+	}
+
+	return tasks[0], nil
+}
+
+func (ss *SQLStore) UpdateTask(ctx context.Context, task taskstore.Task) (taskstore.Task, error) {
+	tx, err := ss.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return taskstore.Task{}, err
+	}
+
+	defer tx.Rollback()
+
+	current, err := liveTask(ctx, tx, task.ID)
+
+	if err != nil {
+		return taskstore.Task{}, err
+	}
+
+	task, err = taskstore.ApplyUpdate(current, task)
+
+	if err != nil {
+		return taskstore.Task{}, err
+	}
+
+	if err := replaceTask(ctx, tx, task); err != nil {
+		return taskstore.Task{}, err
+	}
+
+	if err := recordRevision(ctx, tx, taskstore.ActionUpdated, current, task, time.Now()); err != nil {
+		return taskstore.Task{}, err
+	}
+
+	return task, tx.Commit()
+}
+
+// liveTask loads the task with id unless it is missing or in the trash
+func liveTask(ctx context.Context, tx *sql.Tx, id int) (taskstore.Task, error) {
+	tasks, err := selectTasks(ctx, tx, `t.id = ? AND t.deleted_at IS NULL`, id)
+
+	if err != nil {
+		return taskstore.Task{}, err
+	}
+
+	if len(tasks) == 0 {
+		return taskstore.Task{}, taskstore.NotFound(id)
+	}
+
+	return tasks[0], nil
+}
+
+func (ss *SQLStore) DeleteTask(ctx context.Context, id int, version int) error {
+	tx, err := ss.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	current, err := liveTask(ctx, tx, id)
+
+	if err != nil {
+		return err
+	}
+
+	if err := taskstore.CheckVersion(current, version); err != nil {
+		return err
+	}
+
+	if err := trashTasks(ctx, tx, []taskstore.Task{current}, time.Now()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ss *SQLStore) DeleteAllTasks(ctx context.Context) error {
+	tx, err := ss.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	tasks, err := selectTasks(ctx, tx, `t.deleted_at IS NULL`)
+
+	if err != nil {
+		return err
+	}
+
+	if err := trashTasks(ctx, tx, tasks, time.Now()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// trashTasks moves live tasks to the trash as deleted at at
+func trashTasks(ctx context.Context, tx *sql.Tx, tasks []taskstore.Task, at time.Time) error {
+	for _, task := range tasks {
+		trashed := taskstore.Trashed(task, at)
+
+		if _, err := tx.ExecContext(ctx, `UPDATE tasks SET deleted_at = ? WHERE id = ?`, dueUTC(at), task.ID); err != nil {
+			return err
+		}
+
+		if err := recordRevision(ctx, tx, taskstore.ActionDeleted, task, trashed, at); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ss *SQLStore) GetTrash(ctx context.Context) ([]taskstore.Task, error) {
+	tasks, err := ss.query(ctx, `t.deleted_at IS NOT NULL`)
+
+	if err != nil {
+		return nil, err
+	}
+
+	taskstore.SortTrash(tasks)
+
+	return tasks, nil
+}
+
+func (ss *SQLStore) GetTrashedTask(ctx context.Context, id int) (taskstore.Task, error) {
+	tasks, err := ss.query(ctx, `t.id = ? AND t.deleted_at IS NOT NULL`, id)
+
+	if err != nil {
+		return taskstore.Task{}, err
+	}
+
+	if len(tasks) == 0 {
+		return taskstore.Task{}, taskstore.NotFound(id)
+	}
+
+	return tasks[0], nil
+}
+
+func (ss *SQLStore) RestoreTask(ctx context.Context, id int) (taskstore.Task, error) {
+	tx, err := ss.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return taskstore.Task{}, err
+	}
+
+	defer tx.Rollback()
+
+	tasks, err := selectTasks(ctx, tx, `t.id = ? AND t.deleted_at IS NOT NULL`, id)
+
+	if err != nil {
+		return taskstore.Task{}, err
+	}
+
+	if len(tasks) == 0 {
+		return taskstore.Task{}, taskstore.NotFound(id)
+	}
+
+	task := taskstore.Restored(tasks[0])
+
+	if _, err := tx.ExecContext(ctx, `UPDATE tasks SET deleted_at = NULL, version = ? WHERE id = ?`, task.Version, id); err != nil {
+		return taskstore.Task{}, err
+	}
+
+	if err := recordRevision(ctx, tx, taskstore.ActionRestored, tasks[0], task, time.Now()); err != nil {
+		return taskstore.Task{}, err
+	}
+
+	return task, tx.Commit()
+}
+
+func (ss *SQLStore) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	tx, err := ss.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`DELETE FROM task_revisions WHERE task_id IN (SELECT id FROM tasks WHERE deleted_at < ?)`, dueUTC(before))
+
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM tasks WHERE deleted_at < ?`, dueUTC(before))
+
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), tx.Commit()
+}
+
+func (ss *SQLStore) GetHistory(ctx context.Context, id int) ([]taskstore.Revision, error) {
+	var exists int
+
+	err := ss.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM tasks WHERE id = ?`, id).Scan(&exists)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if exists == 0 {
+		return nil, taskstore.NotFound(id)
+	}
+
+	return selectRevisions(ctx, ss.db, `task_id = ?`, id)
+}
+
+func (ss *SQLStore) RevertTask(ctx context.Context, id int, number int, version int) (taskstore.Task, error) {
+	tx, err := ss.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return taskstore.Task{}, err
+	}
+
+	defer tx.Rollback()
+
+	current, err := liveTask(ctx, tx, id)
+
+	if err != nil {
+		return taskstore.Task{}, err
+	}
+
+	revs, err := selectRevisions(ctx, tx, `task_id = ? AND number = ?`, id, number)
+
+	if err != nil {
+		return taskstore.Task{}, err
+	}
+
+	if len(revs) == 0 {
+		return taskstore.Task{}, taskstore.RevisionNotFound(id, number)
+	}
+
+	task, err := taskstore.ApplyRevert(current, revs[0], version)
+
+	if err != nil {
+		return taskstore.Task{}, err
+	}
+
+	if err := replaceTask(ctx, tx, task); err != nil {
+		return taskstore.Task{}, err
+	}
+
+	if err := recordRevision(ctx, tx, taskstore.ActionReverted, current, task, time.Now()); err != nil {
+		return taskstore.Task{}, err
+	}
+
+	return task, tx.Commit()
+}
+
+func (ss *SQLStore) PutRevision(ctx context.Context, rev taskstore.Revision) error {
+	if err := taskstore.CheckRevision(rev); err != nil {
+		return err
+	}
+
+	return putRevision(ctx, ss.db, rev)
+}
+
+// recordRevision adds the revision of a change made in tx, numbered after the last one
+func recordRevision(ctx context.Context, tx *sql.Tx, action taskstore.Action, before, after taskstore.Task, at time.Time) error {
+	rev := taskstore.NewRevision(ctx, action, before, after, at)
+
+	err := tx.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(number), 0) + 1 FROM task_revisions WHERE task_id = ?`, rev.TaskID).Scan(&rev.Number)
+
+	if err != nil {
+		return err
+	}
+
+	return putRevision(ctx, tx, rev)
+}
+
+func putRevision(ctx context.Context, e execer, rev taskstore.Revision) error {
+	changes, err := json.Marshal(rev.Changes)
+
+	if err != nil {
+		return err
+	}
+
+	task, err := json.Marshal(rev.Task)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = e.ExecContext(ctx,
+		`INSERT OR REPLACE INTO task_revisions (task_id, number, action, author, at, changes, task) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		rev.TaskID, rev.Number, string(rev.Action), rev.Author, rev.At.Format(time.RFC3339Nano), string(changes), string(task))
+
+	return err
+}
+
+// selectRevisions loads the revisions matching the where clause, ordered by task and number
+func selectRevisions(ctx context.Context, q queryer, where string, args ...interface{}) ([]taskstore.Revision, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT task_id, number, action, author, at, changes, task
+		FROM task_revisions
+		WHERE `+where+`
+		ORDER BY task_id, number`, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	revs := []taskstore.Revision{}
+
+	for rows.Next() {
+		var rev taskstore.Revision
+		var action, at, changes, task string
+
+		if err := rows.Scan(&rev.TaskID, &rev.Number, &action, &rev.Author, &at, &changes, &task); err != nil {
+			return nil, err
+		}
+
+		rev.Action = taskstore.Action(action)
+
+		if rev.At, err = time.Parse(time.RFC3339Nano, at); err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal([]byte(changes), &rev.Changes); err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal([]byte(task), &rev.Task); err != nil {
+			return nil, err
+		}
+
+		revs = append(revs, rev)
+	}
+
+	return revs, rows.Err()
+}
+
+func (ss *SQLStore) GetAllTasks(ctx context.Context) ([]taskstore.Task, error) {
+	return ss.queryTasks(ctx, `1`)
+}
+
+func (ss *SQLStore) GetTaskByTag(ctx context.Context, tag string) ([]taskstore.Task, error) {
+	return ss.queryTasks(ctx, `t.id IN (SELECT task_id FROM task_tags WHERE tag = ?)`, tag)
+}
+
+func (ss *SQLStore) GetTaskByDueDate(ctx context.Context, year int, month time.Month, day int) ([]taskstore.Task, error) {
+	date := time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Format(dateLayout)
+
+	return ss.queryTasks(ctx, `t.due_date = ?`, date)
+}
+
+func (ss *SQLStore) GetTaskByDueRange(ctx context.Context, from, to time.Time, bounds taskstore.Bounds) ([]taskstore.Task, error) {
+	where, args := `1`, []interface{}{}
+
+	if !from.IsZero() {
+		if bounds.IncludeFrom {
+			where += ` AND t.due_utc >= ?`
+		} else {
+			where += ` AND t.due_utc > ?`
+		}
+
+		args = append(args, dueUTC(from))
+	}
+
+	if !to.IsZero() {
+		if bounds.IncludeTo {
+			where += ` AND t.due_utc <= ?`
+		} else {
+			where += ` AND t.due_utc < ?`
+		}
+
+		args = append(args, dueUTC(to))
+	}
+
+	tasks, err := ss.queryTasks(ctx, where, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// queryTasks orders by id; the index only narrows the rows down
+	sort.SliceStable(tasks, func(i, j int) bool { return tasks[i].Due.Before(tasks[j].Due) })
+
+	return tasks, nil
+}
+
+func (ss *SQLStore) GetTaskByStatus(ctx context.Context, status taskstore.Status) ([]taskstore.Task, error) {
+	return ss.queryTasks(ctx, `t.status = ?`, string(status))
+}
+
+func (ss *SQLStore) PutTask(ctx context.Context, task taskstore.Task) error {
+	tx, err := ss.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := replaceTask(ctx, tx, task); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE counters SET value = MAX(value, ?) WHERE name = 'next_task_id'`, task.ID+1)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ss *SQLStore) NextID(ctx context.Context) (int, error) {
+	var next int
+	err := ss.db.QueryRowContext(ctx, `SELECT value FROM counters WHERE name = 'next_task_id'`).Scan(&next)
+
+	return next, err
+}
+
+func (ss *SQLStore) SetNextID(ctx context.Context, next int) error {
+	_, err := ss.db.ExecContext(ctx,
+		`UPDATE counters SET value = MAX(value, ?) WHERE name = 'next_task_id'`, next)
+
+	return err
+}
+
+// ForEachTask pages through the tasks so fn never runs while a query holds the connection
+func (ss *SQLStore) ForEachTask(ctx context.Context, fn func(taskstore.Task) error) error {
+	const pageSize = 500
+
+	after := -1
+
+	for {
+		tasks, err := ss.query(ctx,
+			`t.id IN (SELECT id FROM tasks WHERE id > ? ORDER BY id LIMIT ?)`, after, pageSize)
+
+		if err != nil {
+			return err
+		}
+
+		for _, task := range tasks {
+			if err := fn(task); err != nil {
+				return err
+			}
+		}
+
+		if len(tasks) < pageSize {
+			return nil
+		}
+
+		after = tasks[len(tasks)-1].ID
+	}
+}
+
+// SearchTasks ranks the tasks through the task_words index, as a taskstore.TextIndex
+// of them would
+func (ss *SQLStore) SearchTasks(ctx context.Context, query string, limit int) ([]taskstore.SearchResult, error) {
+	tx, err := ss.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	var docs int
+
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM tasks WHERE deleted_at IS NULL`).Scan(&docs); err != nil {
+		return nil, err
+	}
+
+	hits, err := taskstore.Rank(query, docs, func(prefix string) (taskstore.Postings, error) {
+		return prefixedWords(ctx, tx, prefix)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	if len(hits) == 0 {
+		return []taskstore.SearchResult{}, nil
+	}
+
+	ids := make([]interface{}, 0, len(hits))
+
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+
+	tasks, err := selectTasks(ctx, tx, `t.id IN (?`+strings.Repeat(`, ?`, len(ids)-1)+`)`, ids...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int]taskstore.Task, len(tasks))
+
+	for _, task := range tasks {
+		byID[task.ID] = task
+	}
+
+	return taskstore.Results(hits, query, 0, func(id int) taskstore.Task { return byID[id] }), nil
+}
+
+// prefixedWords returns the postings of the live tasks for the stems starting with prefix
+func prefixedWords(ctx context.Context, q queryer, prefix string) (taskstore.Postings, error) {
+	// the stems from prefix up to, not including, prefix with its last byte incremented;
+	// stems are UTF-8, whose bytes never reach 0xff
+	end := prefix[:len(prefix)-1] + string([]byte{prefix[len(prefix)-1] + 1})
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT w.stem, w.task_id, w.occurrences
+		FROM task_words w JOIN tasks t ON t.id = w.task_id
+		WHERE w.stem >= ? AND w.stem < ? AND t.deleted_at IS NULL`, prefix, end)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	postings := make(taskstore.Postings)
+
+	for rows.Next() {
+		var stem string
+		var id, occurrences int
+
+		if err := rows.Scan(&stem, &id, &occurrences); err != nil {
+			return nil, err
+		}
+
+		if postings[stem] == nil {
+			postings[stem] = make(map[int]int)
+		}
+
+		postings[stem][id] = occurrences
+	}
+
+	return postings, rows.Err()
+}
+
+// queryTasks loads the live tasks matching the where clause (over tasks aliased as t)
+// together with their tags, ordered by id.
+func (ss *SQLStore) queryTasks(ctx context.Context, where string, args ...interface{}) ([]taskstore.Task, error) {
+	return ss.query(ctx, `t.deleted_at IS NULL AND (`+where+`)`, args...)
+}
+
+// query is queryTasks over the tasks in the trash as well
+func (ss *SQLStore) query(ctx context.Context, where string, args ...interface{}) ([]taskstore.Task, error) {
+	return selectTasks(ctx, ss.db, where, args...)
+}
+
+// queryer and execer are what both *sql.DB and *sql.Tx provide
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// selectTasks loads the tasks matching the where clause, live or not, through q
+func selectTasks(ctx context.Context, q queryer, where string, args ...interface{}) ([]taskstore.Task, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT t.id, t.text, t.due, t.version, t.status, t.completed_at, t.deleted_at, t.owner, g.tag
+		FROM tasks t LEFT JOIN task_tags g ON g.task_id = t.id
+		WHERE `+where+`
+		ORDER BY t.id, g.position`, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var tasks []taskstore.Task
+
+	for rows.Next() {
+		var id, version int
+		var text, due, status, owner string
+		var completedAt, deletedAt, tag sql.NullString
+
+		if err := rows.Scan(&id, &text, &due, &version, &status, &completedAt, &deletedAt, &owner, &tag); err != nil {
+			return nil, err
+		}
+
+		if len(tasks) == 0 || tasks[len(tasks)-1].ID != id {
+			dueTime, err := time.Parse(time.RFC3339Nano, due)
+
+			if err != nil {
+				return nil, err
+			}
+
+			completedAtTime, err := parseNullTime(completedAt)
+
+			if err != nil {
+				return nil, err
+			}
+
+			deletedAtTime, err := parseNullTime(deletedAt)
+
+			if err != nil {
+				return nil, err
+			}
+
+			tasks = append(tasks, taskstore.Task{ID: id, Text: text, Due: dueTime, Version: version,
+				Status: taskstore.Status(status), CompletedAt: completedAtTime, DeletedAt: deletedAtTime, Owner: owner})
+		}
+
+		if tag.Valid {
+			last := &tasks[len(tasks)-1]
+			last.Tags = append(last.Tags, tag.String)
+		}
+	}
+
+	return tasks, rows.Err()
+}
+
+// parseNullTime parses a nullable time column, like completed_at or deleted_at
+func parseNullTime(value sql.NullString) (*time.Time, error) {
+	if !value.Valid {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, value.String)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
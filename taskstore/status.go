@@ -0,0 +1,123 @@
+package taskstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Status is where a task is in its lifecycle
+type Status string
+
+const (
+	StatusOpen       Status = "open"
+	StatusInProgress Status = "in_progress"
+	StatusBlocked    Status = "blocked"
+	StatusDone       Status = "done"
+	StatusCancelled  Status = "cancelled"
+)
+
+// Statuses lists every status in lifecycle order
+var Statuses = []Status{StatusOpen, StatusInProgress, StatusBlocked, StatusDone, StatusCancelled}
+
+// transitions holds the statuses a task may move to from each status;
+// staying in the same status is always allowed. A blocked task has to be
+// unblocked before it is done, and a closed task can only be reopened.
+var transitions = map[Status][]Status{
+	StatusOpen:       {StatusInProgress, StatusBlocked, StatusDone, StatusCancelled},
+	StatusInProgress: {StatusOpen, StatusBlocked, StatusDone, StatusCancelled},
+	StatusBlocked:    {StatusOpen, StatusInProgress, StatusCancelled},
+	StatusDone:       {StatusOpen},
+	StatusCancelled:  {StatusOpen},
+}
+
+// Closed reports whether a task in this status needs no more work
+func (s Status) Closed() bool {
+	return s == StatusDone || s == StatusCancelled
+}
+
+// ErrInvalidTransition is returned (wrapped) when an update moves a task to a status it
+// cannot reach from its current one; check for it with errors.Is.
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// ParseStatus returns the status named s
+func ParseStatus(s string) (Status, error) {
+	status := Status(s)
+
+	if _, ok := transitions[status]; !ok {
+		return "", fmt.Errorf("unknown task status %q, expect one of %v", s, Statuses)
+	}
+
+	return status, nil
+}
+
+func (s *Status) UnmarshalJSON(data []byte) error {
+	var name string
+
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+
+	status, err := ParseStatus(name)
+
+	if err != nil {
+		return err
+	}
+
+	*s = status
+
+	return nil
+}
+
+// CheckTransition returns ErrInvalidTransition unless a task may move from one status to the other
+func CheckTransition(from, to Status) error {
+	if from == to {
+		return nil
+	}
+
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("cannot move a task from %s to %s: %w", from, to, ErrInvalidTransition)
+}
+
+// applyTransition moves update to its new status, defaulting to the current one, and
+// keeps CompletedAt in step: it is set when the task becomes done and cleared when
+// it is reopened.
+func applyTransition(current, update Task) (Task, error) {
+	current = Upgrade(current)
+
+	if update.Status == "" {
+		update.Status = current.Status
+	}
+
+	if err := CheckTransition(current.Status, update.Status); err != nil {
+		return Task{}, fmt.Errorf("task with id = %d: %w", current.ID, err)
+	}
+
+	switch {
+	case update.Status != StatusDone:
+		update.CompletedAt = nil
+	case current.Status == StatusDone:
+		update.CompletedAt = current.CompletedAt
+	default:
+		now := time.Now().UTC()
+		update.CompletedAt = &now
+	}
+
+	return update, nil
+}
+
+// Upgrade fills in the fields of a task stored before they existed:
+// tasks written before tasks had a status are open.
+func Upgrade(task Task) Task {
+	if task.Status == "" {
+		task.Status = StatusOpen
+	}
+
+	return task
+}
@@ -0,0 +1,341 @@
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shien/restserver/taskstore"
+)
+
+// BenchFactory returns a new, empty store for a benchmark.
+type BenchFactory func(b *testing.B) taskstore.Store
+
+// benchSizes are the store sizes the lookups are measured at; an indexed lookup
+// should cost about the same at every size, a scan grows with it.
+var benchSizes = []int{1000, 10000, 100000}
+
+var benchStart = time.Date(2021, time.January, 1, 9, 0, 0, 0, time.UTC)
+
+// fill creates n tasks spread over 100 tags, the 5 statuses and one due time per hour,
+// so a tag matches 1% of the store, a status 20% and a day 24 tasks. It returns their ids.
+func fill(b *testing.B, store taskstore.Store, n int) []int {
+	b.Helper()
+
+	ids := make([]int, 0, n)
+
+	for i := 0; i < n; i++ {
+		tag := fmt.Sprintf("tag%d", i%100)
+		due := benchStart.Add(time.Duration(i) * time.Hour)
+
+		id, err := store.CreateTask(ctx, "bench", []string{tag}, due)
+
+		if err != nil {
+			b.Fatalf("CreateTask: %v", err)
+		}
+
+		ids = append(ids, id)
+		status := taskstore.Statuses[i%len(taskstore.Statuses)]
+
+		if status == taskstore.StatusOpen {
+			continue
+		}
+
+		task, err := store.GetTask(ctx, id)
+
+		if err != nil {
+			b.Fatalf("GetTask(%d): %v", id, err)
+		}
+
+		// every status can be reached straight from open
+		task.Status = status
+
+		if _, err := store.UpdateTask(ctx, task); err != nil {
+			b.Fatalf("UpdateTask(%d): %v", id, err)
+		}
+	}
+
+	return ids
+}
+
+// Benchmark measures the tag, status and due date lookups of the stores built by
+// newStore, next to a scan of GetAllTasks answering the same query.
+func Benchmark(b *testing.B, newStore BenchFactory) {
+	for _, n := range benchSizes {
+		n := n
+		store := newStore(b)
+		fill(b, store, n)
+
+		day := benchStart.Add(time.Duration(n/2) * time.Hour)
+		from, to := day, day.Add(24*time.Hour)
+
+		lookups := []struct {
+			name   string
+			lookup func() ([]taskstore.Task, error)
+			scan   func(task taskstore.Task) bool
+		}{
+			{
+				"GetTaskByTag",
+				func() ([]taskstore.Task, error) { return store.GetTaskByTag(ctx, "tag7") },
+				func(task taskstore.Task) bool {
+					for _, tag := range task.Tags {
+						if tag == "tag7" {
+							return true
+						}
+					}
+					return false
+				},
+			},
+			{
+				"GetTaskByStatus",
+				func() ([]taskstore.Task, error) { return store.GetTaskByStatus(ctx, taskstore.StatusBlocked) },
+				func(task taskstore.Task) bool { return task.Status == taskstore.StatusBlocked },
+			},
+			{
+				"GetTaskByDueDate",
+				func() ([]taskstore.Task, error) {
+					return store.GetTaskByDueDate(ctx, day.Year(), day.Month(), day.Day())
+				},
+				func(task taskstore.Task) bool {
+					y, m, d := task.Due.Date()
+					return y == day.Year() && m == day.Month() && d == day.Day()
+				},
+			},
+			{
+				"GetTaskByDueRange",
+				func() ([]taskstore.Task, error) { return store.GetTaskByDueRange(ctx, from, to, taskstore.HalfOpen) },
+				func(task taskstore.Task) bool { return !task.Due.Before(from) && task.Due.Before(to) },
+			},
+		}
+
+		for _, l := range lookups {
+			l := l
+
+			b.Run(fmt.Sprintf("%s/n=%d", l.name, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := l.lookup(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+
+			b.Run(fmt.Sprintf("%s/scan/n=%d", l.name, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					all, err := store.GetAllTasks(ctx)
+
+					if err != nil {
+						b.Fatal(err)
+					}
+
+					var found []taskstore.Task
+
+					for _, task := range all {
+						if l.scan(task) {
+							found = append(found, task)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkParallel measures the throughput of the stores built by newStore under a
+// mixed load from parallel goroutines, at several shares of reads, next to the same
+// store with every call serialized behind one mutex as a baseline.
+func BenchmarkParallel(b *testing.B, newStore BenchFactory) {
+	const n = 10000
+
+	for _, readPercent := range []int{100, 90, 50} {
+		for _, serialize := range []bool{false, true} {
+			name := fmt.Sprintf("reads=%d%%", readPercent)
+
+			if serialize {
+				name += "/serialized"
+			}
+
+			readPercent := readPercent
+			store := newStore(b)
+			ids := fill(b, store, n)
+
+			if serialize {
+				store = &serialized{store: store}
+			}
+
+			b.Run(name, func(b *testing.B) {
+				var op int64
+
+				b.RunParallel(func(pb *testing.PB) {
+					for i := 0; pb.Next(); i++ {
+						k := int(atomic.AddInt64(&op, 1) % n)
+
+						if i%100 < readPercent {
+							benchRead(b, store, k, ids[k])
+						} else {
+							benchWrite(b, store, ids[k])
+						}
+					}
+				})
+			})
+		}
+	}
+}
+
+// benchRead is one read of the mixed load on the k-th task fill created, with the given id:
+// a get by id, and every few calls a lookup
+func benchRead(b *testing.B, store taskstore.Store, k, id int) {
+	var err error
+
+	switch k % 4 {
+	case 0:
+		_, err = store.GetTaskByTag(ctx, fmt.Sprintf("tag%d", k%100))
+	case 1:
+		due := benchStart.Add(time.Duration(k) * time.Hour)
+		_, err = store.GetTaskByDueRange(ctx, due, due.Add(24*time.Hour), taskstore.HalfOpen)
+	default:
+		_, err = store.GetTask(ctx, id)
+	}
+
+	if err != nil {
+		b.Error(err)
+	}
+}
+
+// benchWrite is one write of the mixed load: an unconditional update of the task's text
+func benchWrite(b *testing.B, store taskstore.Store, id int) {
+	task, err := store.GetTask(ctx, id)
+
+	if err != nil {
+		b.Error(err)
+		return
+	}
+
+	task.Text = "updated"
+	task.Version = 0
+
+	if _, err := store.UpdateTask(ctx, task); err != nil {
+		b.Error(err)
+	}
+}
+
+// serialized runs every call of store behind a single mutex, the way the in-memory
+// store used to, so BenchmarkParallel can show what shared reads gain over it.
+type serialized struct {
+	mu    sync.Mutex
+	store taskstore.Store
+}
+
+func (s *serialized) CreateTask(ctx context.Context, text string, tags []string, due time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store.CreateTask(ctx, text, tags, due)
+}
+
+func (s *serialized) GetTask(ctx context.Context, id int) (taskstore.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store.GetTask(ctx, id)
+}
+
+func (s *serialized) UpdateTask(ctx context.Context, task taskstore.Task) (taskstore.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store.UpdateTask(ctx, task)
+}
+
+func (s *serialized) DeleteTask(ctx context.Context, id int, version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store.DeleteTask(ctx, id, version)
+}
+
+func (s *serialized) DeleteAllTasks(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store.DeleteAllTasks(ctx)
+}
+
+func (s *serialized) GetAllTasks(ctx context.Context) ([]taskstore.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store.GetAllTasks(ctx)
+}
+
+func (s *serialized) GetTaskByTag(ctx context.Context, tag string) ([]taskstore.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store.GetTaskByTag(ctx, tag)
+}
+
+func (s *serialized) GetTaskByDueDate(ctx context.Context, year int, month time.Month, day int) ([]taskstore.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store.GetTaskByDueDate(ctx, year, month, day)
+}
+
+func (s *serialized) GetTaskByStatus(ctx context.Context, status taskstore.Status) ([]taskstore.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store.GetTaskByStatus(ctx, status)
+}
+
+func (s *serialized) GetTaskByDueRange(ctx context.Context, from, to time.Time, bounds taskstore.Bounds) ([]taskstore.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store.GetTaskByDueRange(ctx, from, to, bounds)
+}
+
+func (s *serialized) GetTrash(ctx context.Context) ([]taskstore.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store.GetTrash(ctx)
+}
+
+func (s *serialized) GetTrashedTask(ctx context.Context, id int) (taskstore.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store.GetTrashedTask(ctx, id)
+}
+
+func (s *serialized) RestoreTask(ctx context.Context, id int) (taskstore.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store.RestoreTask(ctx, id)
+}
+
+func (s *serialized) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store.PurgeTrash(ctx, before)
+}
+
+func (s *serialized) GetHistory(ctx context.Context, id int) ([]taskstore.Revision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store.GetHistory(ctx, id)
+}
+
+func (s *serialized) RevertTask(ctx context.Context, id int, number int, version int) (taskstore.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store.RevertTask(ctx, id, number, version)
+}
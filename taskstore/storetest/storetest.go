@@ -0,0 +1,1301 @@
+// Package storetest is a conformance suite for taskstore.Store implementations;
+// every backend runs the same behavioral checks by calling Run from its own tests, and
+// the same race stress tests by calling RunConcurrent.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+	_ "time/tzdata" // the zones below must load without a system zoneinfo database
+
+	"github.com/shien/restserver/taskstore"
+)
+
+// Factory returns a new, empty store; cleanup can be registered with t.Cleanup.
+type Factory func(t *testing.T) taskstore.Store
+
+// Run executes the whole suite against the stores built by newStore.
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store taskstore.Store)
+	}{
+		{"CreateAndGet", testCreateAndGet},
+		{"GetMissing", testGetMissing},
+		{"UpdateTask", testUpdateTask},
+		{"Versions", testVersions},
+		{"Status", testStatus},
+		{"DeleteTask", testDeleteTask},
+		{"DeleteAllTasks", testDeleteAllTasks},
+		{"Trash", testTrash},
+		{"History", testHistory},
+		{"Owners", testOwners},
+		{"Scoped", testScoped},
+		{"GetAllTasks", testGetAllTasks},
+		{"GetTaskByTag", testGetTaskByTag},
+		{"GetTaskByDueDate", testGetTaskByDueDate},
+		{"GetTaskByDueRange", testGetTaskByDueRange},
+		{"DueDateInZone", testDueDateInZone},
+		{"DueDateAcrossDST", testDueDateAcrossDST},
+		{"GetOverdueTasks", testGetOverdueTasks},
+		{"Search", testSearch},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.fn(t, newStore(t))
+		})
+	}
+}
+
+// RunConcurrent stresses the stores built by newStore with parallel readers and writers;
+// run it with -race.
+func RunConcurrent(t *testing.T, newStore Factory) {
+	t.Run("Create", func(t *testing.T) {
+		testConcurrentCreate(t, newStore(t))
+	})
+
+	t.Run("Mixed", func(t *testing.T) {
+		testConcurrentMixed(t, newStore(t))
+	})
+}
+
+var ctx = context.Background()
+
+func mustCreate(t *testing.T, store taskstore.Store, text string, tags []string, due time.Time) int {
+	t.Helper()
+
+	id, err := store.CreateTask(ctx, text, tags, due)
+
+	if err != nil {
+		t.Fatalf("CreateTask(%q): %v", text, err)
+	}
+
+	return id
+}
+
+func ids(tasks []taskstore.Task) []int {
+	result := make([]int, 0, len(tasks))
+
+	for _, task := range tasks {
+		result = append(result, task.ID)
+	}
+
+	sort.Ints(result)
+
+	return result
+}
+
+func expectIDs(t *testing.T, what string, tasks []taskstore.Task, err error, want ...int) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("%s: %v", what, err)
+	}
+
+	got := ids(tasks)
+	sort.Ints(want)
+
+	if len(got) != len(want) {
+		t.Fatalf("%s = %v, want %v", what, got, want)
+	}
+
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("%s = %v, want %v", what, got, want)
+		}
+	}
+}
+
+func testCreateAndGet(t *testing.T, store taskstore.Store) {
+	due := time.Date(2021, time.August, 1, 15, 4, 5, 0, time.UTC)
+
+	id0 := mustCreate(t, store, "first", []string{"a", "b"}, due)
+	id1 := mustCreate(t, store, "second", nil, due)
+
+	if id0 == id1 {
+		t.Fatalf("CreateTask returned the same id %d twice", id0)
+	}
+
+	task, err := store.GetTask(ctx, id0)
+
+	if err != nil {
+		t.Fatalf("GetTask(%d): %v", id0, err)
+	}
+
+	if task.ID != id0 || task.Text != "first" || !task.Due.Equal(due) {
+		t.Errorf("GetTask(%d) = %+v, want text %q due %v", id0, task, "first", due)
+	}
+
+	if len(task.Tags) != 2 || task.Tags[0] != "a" || task.Tags[1] != "b" {
+		t.Errorf("GetTask(%d).Tags = %v, want [a b]", id0, task.Tags)
+	}
+}
+
+func testGetMissing(t *testing.T, store taskstore.Store) {
+	if _, err := store.GetTask(ctx, 42); !errors.Is(err, taskstore.ErrNotFound) {
+		t.Errorf("GetTask on an empty store: err = %v, want ErrNotFound", err)
+	}
+}
+
+func testUpdateTask(t *testing.T, store taskstore.Store) {
+	id := mustCreate(t, store, "before", []string{"old"}, time.Date(2021, time.August, 1, 0, 0, 0, 0, time.UTC))
+
+	due := time.Date(2021, time.September, 2, 0, 0, 0, 0, time.UTC)
+	updated, err := store.UpdateTask(ctx, taskstore.Task{ID: id, Text: "after", Tags: []string{"new"}, Due: due})
+
+	if err != nil {
+		t.Fatalf("UpdateTask(%d): %v", id, err)
+	}
+
+	if updated.Text != "after" {
+		t.Errorf("UpdateTask(%d) returned %+v", id, updated)
+	}
+
+	task, err := store.GetTask(ctx, id)
+
+	if err != nil {
+		t.Fatalf("GetTask(%d): %v", id, err)
+	}
+
+	if task.Text != "after" || !task.Due.Equal(due) || len(task.Tags) != 1 || task.Tags[0] != "new" {
+		t.Errorf("GetTask(%d) after update = %+v", id, task)
+	}
+
+	tasks, err := store.GetTaskByTag(ctx, "old")
+	expectIDs(t, "GetTaskByTag(old) after update", tasks, err)
+
+	tasks, err = store.GetTaskByTag(ctx, "new")
+	expectIDs(t, "GetTaskByTag(new) after update", tasks, err, id)
+
+	tasks, err = store.GetTaskByDueDate(ctx, 2021, time.August, 1)
+	expectIDs(t, "GetTaskByDueDate(old due) after update", tasks, err)
+
+	if _, err := store.UpdateTask(ctx, taskstore.Task{ID: id + 100}); !errors.Is(err, taskstore.ErrNotFound) {
+		t.Errorf("UpdateTask of a missing task: err = %v, want ErrNotFound", err)
+	}
+}
+
+func testVersions(t *testing.T, store taskstore.Store) {
+	id := mustCreate(t, store, "v1", nil, time.Now())
+
+	task, err := store.GetTask(ctx, id)
+
+	if err != nil {
+		t.Fatalf("GetTask(%d): %v", id, err)
+	}
+
+	if task.Version != 1 {
+		t.Fatalf("version of a new task = %d, want 1", task.Version)
+	}
+
+	task.Text = "v2"
+	updated, err := store.UpdateTask(ctx, task)
+
+	if err != nil {
+		t.Fatalf("UpdateTask at the current version: %v", err)
+	}
+
+	if updated.Version != 2 {
+		t.Errorf("version after update = %d, want 2", updated.Version)
+	}
+
+	// task still carries version 1, which is stale now
+	if _, err := store.UpdateTask(ctx, task); !errors.Is(err, taskstore.ErrVersionConflict) {
+		t.Errorf("UpdateTask at a stale version: err = %v, want ErrVersionConflict", err)
+	}
+
+	if err := store.DeleteTask(ctx, id, 1); !errors.Is(err, taskstore.ErrVersionConflict) {
+		t.Errorf("DeleteTask at a stale version: err = %v, want ErrVersionConflict", err)
+	}
+
+	updated.Version = 0
+	updated.Text = "v3"
+
+	if updated, err = store.UpdateTask(ctx, updated); err != nil || updated.Version != 3 {
+		t.Errorf("unconditional UpdateTask = version %d, %v; want version 3", updated.Version, err)
+	}
+
+	if err := store.DeleteTask(ctx, id, 3); err != nil {
+		t.Errorf("DeleteTask at the current version: %v", err)
+	}
+}
+
+func testStatus(t *testing.T, store taskstore.Store) {
+	due := time.Date(2021, time.August, 1, 0, 0, 0, 0, time.UTC)
+	id := mustCreate(t, store, "work", nil, due)
+	other := mustCreate(t, store, "other", nil, due)
+
+	task, err := store.GetTask(ctx, id)
+
+	if err != nil {
+		t.Fatalf("GetTask(%d): %v", id, err)
+	}
+
+	if task.Status != taskstore.StatusOpen || task.CompletedAt != nil {
+		t.Fatalf("new task has status %q completed at %v, want open and nil", task.Status, task.CompletedAt)
+	}
+
+	task.Status = taskstore.StatusDone
+	task.Version = 0
+
+	if task, err = store.UpdateTask(ctx, task); err != nil {
+		t.Fatalf("UpdateTask(%d) to done: %v", id, err)
+	}
+
+	if task.Status != taskstore.StatusDone || task.CompletedAt == nil {
+		t.Fatalf("done task has status %q completed at %v", task.Status, task.CompletedAt)
+	}
+
+	completedAt := *task.CompletedAt
+
+	// an update without a status keeps the current one, and its completion time
+	task.Status = ""
+	task.Text = "work, done"
+	task.Version = 0
+
+	if task, err = store.UpdateTask(ctx, task); err != nil {
+		t.Fatalf("UpdateTask(%d): %v", id, err)
+	}
+
+	if task.Status != taskstore.StatusDone || task.CompletedAt == nil || !task.CompletedAt.Equal(completedAt) {
+		t.Fatalf("UpdateTask without status: status %q completed at %v, want done at %v", task.Status, task.CompletedAt, completedAt)
+	}
+
+	if stored, err := store.GetTask(ctx, id); err != nil || stored.CompletedAt == nil || !stored.CompletedAt.Equal(completedAt) {
+		t.Fatalf("GetTask(%d) = %+v, %v; want completed at %v", id, stored, err, completedAt)
+	}
+
+	tasks, err := store.GetTaskByStatus(ctx, taskstore.StatusDone)
+	expectIDs(t, "GetTaskByStatus(done)", tasks, err, id)
+
+	tasks, err = store.GetTaskByStatus(ctx, taskstore.StatusOpen)
+	expectIDs(t, "GetTaskByStatus(open)", tasks, err, other)
+
+	task.Status = taskstore.StatusInProgress
+	task.Version = 0
+
+	if _, err := store.UpdateTask(ctx, task); !errors.Is(err, taskstore.ErrInvalidTransition) {
+		t.Fatalf("UpdateTask(%d) from done to in_progress: err = %v, want ErrInvalidTransition", id, err)
+	}
+
+	task.Status = taskstore.StatusOpen
+
+	if task, err = store.UpdateTask(ctx, task); err != nil {
+		t.Fatalf("UpdateTask(%d) reopening: %v", id, err)
+	}
+
+	if task.Status != taskstore.StatusOpen || task.CompletedAt != nil {
+		t.Fatalf("reopened task has status %q completed at %v", task.Status, task.CompletedAt)
+	}
+
+	tasks, err = store.GetTaskByStatus(ctx, taskstore.StatusDone)
+	expectIDs(t, "GetTaskByStatus(done)", tasks, err)
+
+	tasks, err = store.GetTaskByStatus(ctx, taskstore.StatusOpen)
+	expectIDs(t, "GetTaskByStatus(open)", tasks, err, id, other)
+}
+
+func testDeleteTask(t *testing.T, store taskstore.Store) {
+	id := mustCreate(t, store, "doomed", nil, time.Now())
+	keep := mustCreate(t, store, "kept", nil, time.Now())
+
+	if err := store.DeleteTask(ctx, id, 0); err != nil {
+		t.Fatalf("DeleteTask(%d): %v", id, err)
+	}
+
+	if _, err := store.GetTask(ctx, id); !errors.Is(err, taskstore.ErrNotFound) {
+		t.Errorf("GetTask after delete: err = %v, want ErrNotFound", err)
+	}
+
+	if err := store.DeleteTask(ctx, id, 0); !errors.Is(err, taskstore.ErrNotFound) {
+		t.Errorf("second DeleteTask(%d): err = %v, want ErrNotFound", id, err)
+	}
+
+	if _, err := store.GetTask(ctx, keep); err != nil {
+		t.Errorf("GetTask(%d) of a kept task: %v", keep, err)
+	}
+}
+
+func testDeleteAllTasks(t *testing.T, store taskstore.Store) {
+	before := mustCreate(t, store, "one", nil, time.Now())
+	mustCreate(t, store, "two", nil, time.Now())
+
+	if err := store.DeleteAllTasks(ctx); err != nil {
+		t.Fatalf("DeleteAllTasks: %v", err)
+	}
+
+	all, err := store.GetAllTasks(ctx)
+	expectIDs(t, "GetAllTasks after DeleteAllTasks", all, err)
+
+	// ids are never reused, even after the store is emptied
+	after := mustCreate(t, store, "three", nil, time.Now())
+
+	if after <= before {
+		t.Errorf("id after DeleteAllTasks = %d, want greater than %d", after, before)
+	}
+}
+
+func testTrash(t *testing.T, store taskstore.Store) {
+	due := time.Date(2021, time.August, 1, 9, 0, 0, 0, time.UTC)
+	doomed := mustCreate(t, store, "Doomed errand", []string{"errand"}, due)
+	kept := mustCreate(t, store, "Kept errand", []string{"errand"}, due)
+	start := time.Now()
+
+	if err := store.DeleteTask(ctx, doomed, 0); err != nil {
+		t.Fatalf("DeleteTask(%d): %v", doomed, err)
+	}
+
+	// a deleted task is out of reach of every lookup
+	if _, err := store.GetTask(ctx, doomed); !errors.Is(err, taskstore.ErrNotFound) {
+		t.Errorf("GetTask of a deleted task: err = %v, want ErrNotFound", err)
+	}
+
+	if _, err := store.UpdateTask(ctx, taskstore.Task{ID: doomed, Text: "x", Due: due}); !errors.Is(err, taskstore.ErrNotFound) {
+		t.Errorf("UpdateTask of a deleted task: err = %v, want ErrNotFound", err)
+	}
+
+	tasks, err := store.GetAllTasks(ctx)
+	expectIDs(t, "GetAllTasks", tasks, err, kept)
+	tasks, err = store.GetTaskByTag(ctx, "errand")
+	expectIDs(t, "GetTaskByTag", tasks, err, kept)
+	tasks, err = store.GetTaskByStatus(ctx, taskstore.StatusOpen)
+	expectIDs(t, "GetTaskByStatus", tasks, err, kept)
+	tasks, err = store.GetTaskByDueDate(ctx, 2021, time.August, 1)
+	expectIDs(t, "GetTaskByDueDate", tasks, err, kept)
+	tasks, err = store.GetTaskByDueRange(ctx, time.Time{}, time.Time{}, taskstore.HalfOpen)
+	expectIDs(t, "GetTaskByDueRange", tasks, err, kept)
+
+	if results, err := taskstore.Search(ctx, store, "doomed", 0); err != nil || len(results) != 0 {
+		t.Errorf("Search for a deleted task = %d results, %v", len(results), err)
+	}
+
+	trash, err := store.GetTrash(ctx)
+	expectIDs(t, "GetTrash", trash, err, doomed)
+
+	if at := trash[0].DeletedAt; at == nil || at.Before(start.Add(-time.Second)) || at.After(time.Now().Add(time.Second)) {
+		t.Errorf("DeletedAt = %v, want about %v", at, start)
+	}
+
+	if task, err := store.GetTrashedTask(ctx, doomed); err != nil || task.ID != doomed || task.DeletedAt == nil {
+		t.Errorf("GetTrashedTask(%d) = %+v, %v; want it with its DeletedAt", doomed, task, err)
+	}
+
+	if _, err := store.GetTrashedTask(ctx, kept); !errors.Is(err, taskstore.ErrNotFound) {
+		t.Errorf("GetTrashedTask of a live task: err = %v, want ErrNotFound", err)
+	}
+
+	restored, err := store.RestoreTask(ctx, doomed)
+
+	if err != nil {
+		t.Fatalf("RestoreTask(%d): %v", doomed, err)
+	}
+
+	if restored.Version != 2 || restored.DeletedAt != nil || restored.Text != "Doomed errand" {
+		t.Errorf("RestoreTask(%d) = %+v, want version 2 and no DeletedAt", doomed, restored)
+	}
+
+	tasks, err = store.GetTaskByTag(ctx, "errand")
+	expectIDs(t, "GetTaskByTag after RestoreTask", tasks, err, doomed, kept)
+
+	if _, err := store.RestoreTask(ctx, doomed); !errors.Is(err, taskstore.ErrNotFound) {
+		t.Errorf("RestoreTask of a live task: err = %v, want ErrNotFound", err)
+	}
+
+	if err := store.DeleteAllTasks(ctx); err != nil {
+		t.Fatalf("DeleteAllTasks: %v", err)
+	}
+
+	trash, err = store.GetTrash(ctx)
+	expectIDs(t, "GetTrash after DeleteAllTasks", trash, err, doomed, kept)
+
+	if m, ok := store.(taskstore.Migrator); ok {
+		var all []taskstore.Task
+
+		err := m.ForEachTask(ctx, func(task taskstore.Task) error {
+			all = append(all, task)
+			return nil
+		})
+
+		expectIDs(t, "ForEachTask over the trash", all, err, doomed, kept)
+
+		if all[0].DeletedAt == nil {
+			t.Errorf("ForEachTask: task %d has no DeletedAt", all[0].ID)
+		}
+	}
+
+	if purged, err := store.PurgeTrash(ctx, start.Add(-time.Hour)); err != nil || purged != 0 {
+		t.Errorf("PurgeTrash before the deletions = %d, %v; want 0", purged, err)
+	}
+
+	if purged, err := store.PurgeTrash(ctx, time.Now().Add(time.Second)); err != nil || purged != 2 {
+		t.Errorf("PurgeTrash = %d, %v; want 2", purged, err)
+	}
+
+	trash, err = store.GetTrash(ctx)
+	expectIDs(t, "GetTrash after PurgeTrash", trash, err)
+
+	if _, err := store.RestoreTask(ctx, kept); !errors.Is(err, taskstore.ErrNotFound) {
+		t.Errorf("RestoreTask of a purged task: err = %v, want ErrNotFound", err)
+	}
+
+	if m, ok := store.(taskstore.Migrator); ok {
+		at := time.Date(2021, time.September, 1, 0, 0, 0, 0, time.UTC)
+		task := taskstore.Task{ID: 100, Text: "copied", Due: due, Version: 3, Status: taskstore.StatusOpen, DeletedAt: &at}
+
+		if err := m.PutTask(ctx, task); err != nil {
+			t.Fatalf("PutTask of a deleted task: %v", err)
+		}
+
+		trash, err = store.GetTrash(ctx)
+		expectIDs(t, "GetTrash after PutTask", trash, err, 100)
+
+		if !trash[0].DeletedAt.Equal(at) {
+			t.Errorf("DeletedAt after PutTask = %v, want %v", trash[0].DeletedAt, at)
+		}
+
+		if _, err := store.GetTask(ctx, 100); !errors.Is(err, taskstore.ErrNotFound) {
+			t.Errorf("GetTask of a task put in the trash: err = %v, want ErrNotFound", err)
+		}
+	}
+}
+
+func testHistory(t *testing.T, store taskstore.Store) {
+	due := time.Date(2021, time.August, 1, 9, 0, 0, 0, time.UTC)
+	alice := taskstore.WithAuthor(ctx, "alice")
+	start := time.Now()
+
+	id, err := store.CreateTask(alice, "Buy milk", []string{"errand"}, due)
+
+	if err != nil {
+		t.Fatalf("CreateTask: %v", err)
+	}
+
+	if _, err := store.UpdateTask(ctx, taskstore.Task{ID: id, Text: "Buy oat milk", Tags: []string{"errand"}, Due: due}); err != nil {
+		t.Fatalf("UpdateTask(%d): %v", id, err)
+	}
+
+	if err := store.DeleteTask(alice, id, 0); err != nil {
+		t.Fatalf("DeleteTask(%d): %v", id, err)
+	}
+
+	// the history of a task in the trash can still be read
+	if revs, err := store.GetHistory(ctx, id); err != nil || len(revs) != 3 {
+		t.Fatalf("GetHistory of a deleted task = %d revisions, %v; want 3", len(revs), err)
+	}
+
+	if _, err := store.RestoreTask(alice, id); err != nil {
+		t.Fatalf("RestoreTask(%d): %v", id, err)
+	}
+
+	revs, err := store.GetHistory(ctx, id)
+
+	if err != nil {
+		t.Fatalf("GetHistory(%d): %v", id, err)
+	}
+
+	want := []struct {
+		action  taskstore.Action
+		author  string
+		fields  []string
+		version int
+	}{
+		{taskstore.ActionCreated, "alice", []string{"text", "tags", "due", "status"}, 1},
+		{taskstore.ActionUpdated, "", []string{"text"}, 2},
+		{taskstore.ActionDeleted, "alice", []string{"deleted_at"}, 2},
+		{taskstore.ActionRestored, "alice", []string{"deleted_at"}, 3},
+	}
+
+	if len(revs) != len(want) {
+		t.Fatalf("GetHistory(%d) = %d revisions, want %d", id, len(revs), len(want))
+	}
+
+	for i, rev := range revs {
+		var fields []string
+
+		for _, change := range rev.Changes {
+			fields = append(fields, change.Field)
+		}
+
+		w := want[i]
+
+		if rev.TaskID != id || rev.Number != i+1 || rev.Action != w.action || rev.Author != w.author ||
+			fmt.Sprint(fields) != fmt.Sprint(w.fields) || rev.Task.Version != w.version {
+			t.Errorf("revision %d = %+v, want %s by %q changing %v at version %d", i+1, rev, w.action, w.author, w.fields, w.version)
+		}
+
+		if rev.At.Before(start.Add(-time.Second)) || rev.At.After(time.Now().Add(time.Second)) {
+			t.Errorf("revision %d At = %v, want about %v", i+1, rev.At, start)
+		}
+	}
+
+	if change := revs[1].Changes[0]; change.From != "Buy milk" || change.To != "Buy oat milk" {
+		t.Errorf("text change = %+v, want Buy milk -> Buy oat milk", change)
+	}
+
+	if _, err := store.RevertTask(ctx, id, 1, 2); !errors.Is(err, taskstore.ErrVersionConflict) {
+		t.Errorf("RevertTask at a stale version: err = %v, want ErrVersionConflict", err)
+	}
+
+	if _, err := store.RevertTask(ctx, id, 9, 0); !errors.Is(err, taskstore.ErrNotFound) {
+		t.Errorf("RevertTask to a missing revision: err = %v, want ErrNotFound", err)
+	}
+
+	reverted, err := store.RevertTask(alice, id, 1, 3)
+
+	if err != nil {
+		t.Fatalf("RevertTask(%d, 1): %v", id, err)
+	}
+
+	if reverted.Text != "Buy milk" || reverted.Version != 4 || reverted.DeletedAt != nil {
+		t.Errorf("RevertTask(%d, 1) = %+v, want text Buy milk at version 4", id, reverted)
+	}
+
+	if got, err := store.GetTask(ctx, id); err != nil || got.Text != "Buy milk" || got.Version != 4 {
+		t.Errorf("GetTask after RevertTask = %+v, %v", got, err)
+	}
+
+	revs, err = store.GetHistory(ctx, id)
+
+	if err != nil || len(revs) != 5 || revs[4].Action != taskstore.ActionReverted || revs[4].Number != 5 {
+		t.Fatalf("GetHistory after RevertTask = %+v, %v; want a fifth, reverted revision", revs, err)
+	}
+
+	if _, err := store.GetHistory(ctx, 9999); !errors.Is(err, taskstore.ErrNotFound) {
+		t.Errorf("GetHistory of a missing task: err = %v, want ErrNotFound", err)
+	}
+
+	// other tasks have their own numbering
+	other := mustCreate(t, store, "Other", nil, due)
+
+	if revs, err := store.GetHistory(ctx, other); err != nil || len(revs) != 1 || revs[0].Number != 1 {
+		t.Errorf("GetHistory of a new task = %+v, %v; want revision 1 alone", revs, err)
+	}
+
+	// purging a task drops its history
+	if err := store.DeleteTask(ctx, id, 0); err != nil {
+		t.Fatalf("DeleteTask(%d): %v", id, err)
+	}
+
+	if _, err := store.PurgeTrash(ctx, time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("PurgeTrash: %v", err)
+	}
+
+	if _, err := store.GetHistory(ctx, id); !errors.Is(err, taskstore.ErrNotFound) {
+		t.Errorf("GetHistory of a purged task: err = %v, want ErrNotFound", err)
+	}
+
+	if m, ok := store.(taskstore.Migrator); ok {
+		if err := m.PutTask(ctx, taskstore.Task{ID: 100, Text: "copied", Due: due, Version: 2, Status: taskstore.StatusOpen}); err != nil {
+			t.Fatalf("PutTask: %v", err)
+		}
+
+		at := time.Date(2021, time.September, 1, 0, 0, 0, 0, time.UTC)
+
+		// out of order, and the first one put again as a resumed migration would
+		for _, rev := range []taskstore.Revision{
+			{TaskID: 100, Number: 2, Action: taskstore.ActionUpdated, At: at, Changes: []taskstore.Change{}, Task: taskstore.Task{ID: 100, Text: "copied", Version: 2, Status: taskstore.StatusOpen}},
+			{TaskID: 100, Number: 1, Action: taskstore.ActionCreated, Author: "alice", At: at, Changes: []taskstore.Change{}, Task: taskstore.Task{ID: 100, Text: "first", Version: 1, Status: taskstore.StatusOpen}},
+			{TaskID: 100, Number: 1, Action: taskstore.ActionCreated, Author: "bob", At: at, Changes: []taskstore.Change{}, Task: taskstore.Task{ID: 100, Text: "first", Version: 1, Status: taskstore.StatusOpen}},
+		} {
+			if err := m.PutRevision(ctx, rev); err != nil {
+				t.Fatalf("PutRevision(%d): %v", rev.Number, err)
+			}
+		}
+
+		if err := m.PutRevision(ctx, taskstore.Revision{TaskID: 100}); err == nil {
+			t.Errorf("PutRevision without a number: err = nil")
+		}
+
+		revs, err := store.GetHistory(ctx, 100)
+
+		if err != nil || len(revs) != 2 || revs[0].Number != 1 || revs[0].Author != "bob" || !revs[0].At.Equal(at) || revs[1].Number != 2 || revs[1].Task.Text != "copied" {
+			t.Fatalf("GetHistory after PutRevision = %+v, %v", revs, err)
+		}
+
+		// a revision put past a gap leaves no empty ones in between
+		if err := m.PutRevision(ctx, taskstore.Revision{TaskID: 100, Number: 4, Action: taskstore.ActionUpdated, At: at, Changes: []taskstore.Change{}, Task: taskstore.Task{ID: 100, Text: "copied", Version: 2, Status: taskstore.StatusOpen}}); err != nil {
+			t.Fatalf("PutRevision(4): %v", err)
+		}
+
+		if revs, err := store.GetHistory(ctx, 100); err != nil || len(revs) != 3 || revs[2].Number != 4 {
+			t.Fatalf("GetHistory after PutRevision(4) = %+v, %v; want revisions 1, 2 and 4", revs, err)
+		}
+
+		if _, err := store.RevertTask(ctx, 100, 3, 0); !errors.Is(err, taskstore.ErrNotFound) {
+			t.Errorf("RevertTask to the missing revision 3: err = %v, want ErrNotFound", err)
+		}
+
+		// the next revision is numbered after the ones put
+		if _, err := store.UpdateTask(ctx, taskstore.Task{ID: 100, Text: "updated", Due: due}); err != nil {
+			t.Fatalf("UpdateTask(100): %v", err)
+		}
+
+		if revs, err := store.GetHistory(ctx, 100); err != nil || len(revs) != 4 || revs[3].Number != 5 {
+			t.Errorf("GetHistory after UpdateTask = %+v, %v; want revision 5", revs, err)
+		}
+	}
+}
+
+func testOwners(t *testing.T, store taskstore.Store) {
+	due := time.Date(2021, time.August, 1, 9, 0, 0, 0, time.UTC)
+	alice := taskstore.WithTenant(ctx, taskstore.Tenant{Owner: "alice"})
+
+	id, err := store.CreateTask(alice, "Buy milk", nil, due)
+
+	if err != nil {
+		t.Fatalf("CreateTask: %v", err)
+	}
+
+	nobodys := mustCreate(t, store, "Walk the dog", nil, due)
+
+	expectOwner := func(what string, id int, want string) {
+		t.Helper()
+
+		task, err := store.GetTask(ctx, id)
+
+		if err != nil {
+			t.Fatalf("GetTask(%d) after %s: %v", id, what, err)
+		}
+
+		if task.Owner != want {
+			t.Errorf("Owner after %s = %q, want %q", what, task.Owner, want)
+		}
+	}
+
+	expectOwner("CreateTask", id, "alice")
+	expectOwner("CreateTask without a tenant", nobodys, "")
+
+	// the owner stays whoever changes the task, and whatever the update says
+	if _, err := store.UpdateTask(ctx, taskstore.Task{ID: id, Text: "Buy oat milk", Due: due, Owner: "bob"}); err != nil {
+		t.Fatalf("UpdateTask(%d): %v", id, err)
+	}
+
+	expectOwner("UpdateTask", id, "alice")
+
+	if err := store.DeleteTask(ctx, id, 0); err != nil {
+		t.Fatalf("DeleteTask(%d): %v", id, err)
+	}
+
+	if _, err := store.RestoreTask(ctx, id); err != nil {
+		t.Fatalf("RestoreTask(%d): %v", id, err)
+	}
+
+	expectOwner("RestoreTask", id, "alice")
+
+	if _, err := store.RevertTask(ctx, id, 1, 0); err != nil {
+		t.Fatalf("RevertTask(%d): %v", id, err)
+	}
+
+	expectOwner("RevertTask", id, "alice")
+}
+
+// testScoped runs the store behind a taskstore.Scoped for two tenants and an admin
+func testScoped(t *testing.T, store taskstore.Store) {
+	scoped := taskstore.NewScoped(store)
+	due := time.Date(2021, time.August, 1, 9, 0, 0, 0, time.UTC)
+	alice := taskstore.WithTenant(ctx, taskstore.Tenant{Owner: "alice"})
+	bob := taskstore.WithTenant(ctx, taskstore.Tenant{Owner: "bob"})
+	admin := taskstore.WithTenant(ctx, taskstore.Tenant{Owner: "root", Admin: true})
+
+	create := func(ctx context.Context, text string) int {
+		t.Helper()
+
+		id, err := scoped.CreateTask(ctx, text, []string{"shared"}, due)
+
+		if err != nil {
+			t.Fatalf("CreateTask(%q): %v", text, err)
+		}
+
+		return id
+	}
+
+	a1 := create(alice, "alice 1")
+	a2 := create(alice, "alice 2")
+	b1 := create(bob, "bob 1")
+
+	all, err := scoped.GetAllTasks(alice)
+	expectIDs(t, "GetAllTasks of alice", all, err, a1, a2)
+
+	tagged, err := scoped.GetTaskByTag(bob, "shared")
+	expectIDs(t, "GetTaskByTag of bob", tagged, err, b1)
+
+	all, err = scoped.GetAllTasks(admin)
+	expectIDs(t, "GetAllTasks of an admin", all, err, a1, a2, b1)
+
+	// the tasks of others are not found, as if they did not exist
+	if _, err := scoped.GetTask(bob, a1); !errors.Is(err, taskstore.ErrNotFound) {
+		t.Errorf("GetTask of alice's task by bob: err = %v, want ErrNotFound", err)
+	}
+
+	if _, err := scoped.UpdateTask(bob, taskstore.Task{ID: a1, Text: "mine now", Due: due}); !errors.Is(err, taskstore.ErrNotFound) {
+		t.Errorf("UpdateTask of alice's task by bob: err = %v, want ErrNotFound", err)
+	}
+
+	if err := scoped.DeleteTask(bob, a1, 0); !errors.Is(err, taskstore.ErrNotFound) {
+		t.Errorf("DeleteTask of alice's task by bob: err = %v, want ErrNotFound", err)
+	}
+
+	if _, err := scoped.GetHistory(bob, a1); !errors.Is(err, taskstore.ErrNotFound) {
+		t.Errorf("GetHistory of alice's task by bob: err = %v, want ErrNotFound", err)
+	}
+
+	if _, err := scoped.GetTask(admin, a1); err != nil {
+		t.Errorf("GetTask of alice's task by an admin: %v", err)
+	}
+
+	// deleting everything only deletes the tenant's own tasks
+	if err := scoped.DeleteAllTasks(bob); err != nil {
+		t.Fatalf("DeleteAllTasks of bob: %v", err)
+	}
+
+	all, err = scoped.GetAllTasks(admin)
+	expectIDs(t, "GetAllTasks after bob deleted all", all, err, a1, a2)
+
+	trash, err := scoped.GetTrash(alice)
+	expectIDs(t, "GetTrash of alice", trash, err)
+
+	if _, err := scoped.GetTrashedTask(alice, b1); !errors.Is(err, taskstore.ErrNotFound) {
+		t.Errorf("GetTrashedTask of bob's task by alice: err = %v, want ErrNotFound", err)
+	}
+
+	if _, err := scoped.RestoreTask(alice, b1); !errors.Is(err, taskstore.ErrNotFound) {
+		t.Errorf("RestoreTask of bob's task by alice: err = %v, want ErrNotFound", err)
+	}
+
+	if _, err := scoped.RestoreTask(bob, b1); err != nil {
+		t.Errorf("RestoreTask of bob's task by bob: %v", err)
+	}
+
+	// searches find the tenant's own tasks, the limit counting those only
+	search := func(ctx context.Context, who, query string, limit int, want ...int) {
+		t.Helper()
+
+		results, err := taskstore.Search(ctx, scoped, query, limit)
+		found := make([]taskstore.Task, 0, len(results))
+
+		for _, result := range results {
+			found = append(found, result.Task)
+		}
+
+		expectIDs(t, fmt.Sprintf("Search(%q, %d) of %s", query, limit, who), found, err, want...)
+	}
+
+	search(alice, "alice", "alice", 0, a1, a2)
+	search(bob, "bob", "alice", 0)
+	search(bob, "bob", "1", 1, b1)
+	search(admin, "an admin", "1", 0, a1, b1)
+
+	if _, err := scoped.PurgeTrash(alice, time.Now()); !errors.Is(err, taskstore.ErrForbidden) {
+		t.Errorf("PurgeTrash by alice: err = %v, want ErrForbidden", err)
+	}
+}
+
+func testGetAllTasks(t *testing.T, store taskstore.Store) {
+	all, err := store.GetAllTasks(ctx)
+	expectIDs(t, "GetAllTasks on an empty store", all, err)
+
+	id0 := mustCreate(t, store, "one", nil, time.Now())
+	id1 := mustCreate(t, store, "two", nil, time.Now())
+
+	all, err = store.GetAllTasks(ctx)
+	expectIDs(t, "GetAllTasks", all, err, id0, id1)
+}
+
+func testGetTaskByTag(t *testing.T, store taskstore.Store) {
+	now := time.Now()
+
+	work := mustCreate(t, store, "work", []string{"work"}, now)
+	both := mustCreate(t, store, "both", []string{"home", "work", "work"}, now)
+	mustCreate(t, store, "home", []string{"home"}, now)
+
+	tasks, err := store.GetTaskByTag(ctx, "work")
+	expectIDs(t, "GetTaskByTag(work)", tasks, err, work, both)
+
+	tasks, err = store.GetTaskByTag(ctx, "nope")
+	expectIDs(t, "GetTaskByTag(nope)", tasks, err)
+}
+
+func testGetTaskByDueDate(t *testing.T, store taskstore.Store) {
+	morning := mustCreate(t, store, "morning", nil, time.Date(2021, time.August, 1, 8, 0, 0, 0, time.UTC))
+	evening := mustCreate(t, store, "evening", nil, time.Date(2021, time.August, 1, 23, 30, 0, 0, time.UTC))
+	mustCreate(t, store, "next day", nil, time.Date(2021, time.August, 2, 0, 0, 0, 0, time.UTC))
+
+	// the day is taken in each task's own offset, even where it is already another day in UTC
+	kiribati := mustCreate(t, store, "kiribati", nil, time.Date(2021, time.August, 1, 1, 0, 0, 0, time.FixedZone("+14", 14*60*60)))
+	baker := mustCreate(t, store, "baker island", nil, time.Date(2021, time.August, 1, 23, 0, 0, 0, time.FixedZone("-12", -12*60*60)))
+
+	tasks, err := store.GetTaskByDueDate(ctx, 2021, time.August, 1)
+	expectIDs(t, "GetTaskByDueDate(2021-08-01)", tasks, err, morning, evening, kiribati, baker)
+
+	tasks, err = store.GetTaskByDueDate(ctx, 2020, time.August, 1)
+	expectIDs(t, "GetTaskByDueDate(2020-08-01)", tasks, err)
+}
+
+// expectOrder checks the tasks come back with exactly these ids in this order
+func expectOrder(t *testing.T, what string, tasks []taskstore.Task, err error, want ...int) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("%s: %v", what, err)
+	}
+
+	got := make([]int, 0, len(tasks))
+
+	for _, task := range tasks {
+		got = append(got, task.ID)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("%s = %v, want %v", what, got, want)
+	}
+
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("%s = %v, want %v", what, got, want)
+		}
+	}
+}
+
+func testGetTaskByDueRange(t *testing.T, store taskstore.Store) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+
+	// created out of due order, with due times in different offsets
+	late := mustCreate(t, store, "late", nil, time.Date(2021, time.August, 8, 0, 0, 0, 0, time.UTC))
+	early := mustCreate(t, store, "early", nil, time.Date(2021, time.August, 1, 8, 0, 0, 0, tokyo)) // Jul 31 23:00 UTC
+	middleDue := time.Date(2021, time.August, 4, 12, 0, 0, 1, time.UTC)
+	middle := mustCreate(t, store, "middle", nil, middleDue)
+	undated := mustCreate(t, store, "undated", nil, time.Time{})
+
+	from := time.Date(2021, time.August, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2021, time.August, 8, 0, 0, 0, 0, time.UTC)
+
+	tasks, err := store.GetTaskByDueRange(ctx, from, to, taskstore.HalfOpen)
+	expectOrder(t, "GetTaskByDueRange[Aug 1, Aug 8)", tasks, err, middle)
+
+	tasks, err = store.GetTaskByDueRange(ctx, from.Add(-time.Hour), to.Add(time.Nanosecond), taskstore.HalfOpen)
+	expectOrder(t, "GetTaskByDueRange[Jul 31 23:00, Aug 8 +1ns)", tasks, err, early, middle, late)
+
+	tasks, err = store.GetTaskByDueRange(ctx, time.Time{}, from, taskstore.HalfOpen)
+	expectOrder(t, "GetTaskByDueRange(open, Aug 1)", tasks, err, undated, early)
+
+	tasks, err = store.GetTaskByDueRange(ctx, middleDue, time.Time{}, taskstore.HalfOpen)
+	expectOrder(t, "GetTaskByDueRange[middle, open)", tasks, err, middle, late)
+
+	tasks, err = store.GetTaskByDueRange(ctx, middleDue.Add(time.Nanosecond), time.Time{}, taskstore.HalfOpen)
+	expectOrder(t, "GetTaskByDueRange[middle +1ns, open)", tasks, err, late)
+
+	tasks, err = store.GetTaskByDueRange(ctx, to, from, taskstore.HalfOpen)
+	expectOrder(t, "GetTaskByDueRange[Aug 8, Aug 1)", tasks, err)
+
+	// bounds decide about the tasks due right at from or to
+	tasks, err = store.GetTaskByDueRange(ctx, from, to, taskstore.Bounds{IncludeFrom: true, IncludeTo: true})
+	expectOrder(t, "GetTaskByDueRange[Aug 1, Aug 8]", tasks, err, middle, late)
+
+	tasks, err = store.GetTaskByDueRange(ctx, middleDue, to, taskstore.Bounds{IncludeTo: true})
+	expectOrder(t, "GetTaskByDueRange(middle, Aug 8]", tasks, err, late)
+
+	tasks, err = store.GetTaskByDueRange(ctx, middleDue, middleDue, taskstore.Bounds{IncludeFrom: true, IncludeTo: true})
+	expectOrder(t, "GetTaskByDueRange[middle, middle]", tasks, err, middle)
+
+	tasks, err = store.GetTaskByDueRange(ctx, middleDue, middleDue, taskstore.HalfOpen)
+	expectOrder(t, "GetTaskByDueRange[middle, middle)", tasks, err)
+
+	tasks, err = store.GetTaskByDueRange(ctx, middleDue, time.Time{}, taskstore.Bounds{})
+	expectOrder(t, "GetTaskByDueRange(middle, open)", tasks, err, late)
+
+	// the bounds compare instants, whatever the offset of the due time
+	tasks, err = store.GetTaskByDueRange(ctx, time.Time{}, from.Add(-time.Hour), taskstore.Bounds{IncludeTo: true})
+	expectOrder(t, "GetTaskByDueRange(open, Jul 31 23:00]", tasks, err, undated, early)
+
+	// the index follows updates and deletes
+	if _, err := store.UpdateTask(ctx, taskstore.Task{ID: late, Text: "late", Due: from}); err != nil {
+		t.Fatalf("UpdateTask(%d): %v", late, err)
+	}
+
+	if err := store.DeleteTask(ctx, middle, 0); err != nil {
+		t.Fatalf("DeleteTask(%d): %v", middle, err)
+	}
+
+	tasks, err = store.GetTaskByDueRange(ctx, time.Time{}, time.Time{}, taskstore.HalfOpen)
+	expectOrder(t, "GetTaskByDueRange(open, open)", tasks, err, undated, early, late)
+}
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	loc, err := time.LoadLocation(name)
+
+	if err != nil {
+		t.Fatalf("LoadLocation(%q): %v", name, err)
+	}
+
+	return loc
+}
+
+func testDueDateInZone(t *testing.T, store taskstore.Store) {
+	la := mustLoadLocation(t, "America/Los_Angeles")
+
+	// Aug 1 in Los Angeles, but Aug 2 06:30 in UTC
+	evening := mustCreate(t, store, "evening", nil, time.Date(2021, time.August, 1, 23, 30, 0, 0, time.FixedZone("PDT", -7*60*60)))
+	// Aug 1 in UTC, but Jul 31 in Los Angeles
+	early := mustCreate(t, store, "early", nil, time.Date(2021, time.August, 1, 3, 0, 0, 0, time.UTC))
+
+	tasks, err := taskstore.GetTaskByDueDateIn(ctx, store, 2021, time.August, 1, la)
+	expectOrder(t, "GetTaskByDueDateIn(Aug 1, Los Angeles)", tasks, err, evening)
+
+	tasks, err = taskstore.GetTaskByDueDateIn(ctx, store, 2021, time.August, 1, time.UTC)
+	expectOrder(t, "GetTaskByDueDateIn(Aug 1, UTC)", tasks, err, early)
+
+	tasks, err = taskstore.GetTaskByDueDateIn(ctx, store, 2021, time.August, 2, time.UTC)
+	expectOrder(t, "GetTaskByDueDateIn(Aug 2, UTC)", tasks, err, evening)
+
+	tasks, err = taskstore.GetTaskByDueDateIn(ctx, store, 2021, time.July, 31, la)
+	expectOrder(t, "GetTaskByDueDateIn(Jul 31, Los Angeles)", tasks, err, early)
+
+	// without a zone, days are matched in the offset each task was given with
+	tasks, err = taskstore.GetTaskByDueDateIn(ctx, store, 2021, time.August, 1, nil)
+	expectIDs(t, "GetTaskByDueDateIn(Aug 1, nil)", tasks, err, evening, early)
+}
+
+func testDueDateAcrossDST(t *testing.T, store taskstore.Store) {
+	ny := mustLoadLocation(t, "America/New_York")
+	est := time.FixedZone("EST", -5*60*60)
+	edt := time.FixedZone("EDT", -4*60*60)
+
+	// 2021-03-14 springs forward at 02:00 EST: the day lasts 23 hours
+	beforeSpring := mustCreate(t, store, "before spring", nil, time.Date(2021, time.March, 13, 23, 30, 0, 0, est))
+	springMidnight := mustCreate(t, store, "spring midnight", nil, time.Date(2021, time.March, 14, 0, 0, 0, 0, est))
+	afterJump := mustCreate(t, store, "after the jump", nil, time.Date(2021, time.March, 14, 3, 30, 0, 0, edt))
+	springLate := mustCreate(t, store, "spring late", nil, time.Date(2021, time.March, 15, 3, 30, 0, 0, time.UTC)) // 23:30 EDT
+	mustCreate(t, store, "after spring", nil, time.Date(2021, time.March, 15, 0, 0, 0, 0, edt))
+
+	// 2021-11-07 falls back at 02:00 EDT: 01:30 happens twice and the day lasts 25 hours
+	firstOneThirty := mustCreate(t, store, "first 01:30", nil, time.Date(2021, time.November, 7, 1, 30, 0, 0, edt))
+	secondOneThirty := mustCreate(t, store, "second 01:30", nil, time.Date(2021, time.November, 7, 1, 30, 0, 0, est))
+	fallLate := mustCreate(t, store, "fall late", nil, time.Date(2021, time.November, 7, 23, 30, 0, 0, est))
+	mustCreate(t, store, "after fall", nil, time.Date(2021, time.November, 8, 0, 0, 0, 0, est))
+
+	if from, to := taskstore.DayRange(2021, time.March, 14, ny); to.Sub(from) != 23*time.Hour {
+		t.Errorf("DayRange(Mar 14, New York) lasts %v, want 23h", to.Sub(from))
+	}
+
+	if from, to := taskstore.DayRange(2021, time.November, 7, ny); to.Sub(from) != 25*time.Hour {
+		t.Errorf("DayRange(Nov 7, New York) lasts %v, want 25h", to.Sub(from))
+	}
+
+	tasks, err := taskstore.GetTaskByDueDateIn(ctx, store, 2021, time.March, 13, ny)
+	expectOrder(t, "GetTaskByDueDateIn(Mar 13, New York)", tasks, err, beforeSpring)
+
+	tasks, err = taskstore.GetTaskByDueDateIn(ctx, store, 2021, time.March, 14, ny)
+	expectOrder(t, "GetTaskByDueDateIn(Mar 14, New York)", tasks, err, springMidnight, afterJump, springLate)
+
+	tasks, err = taskstore.GetTaskByDueDateIn(ctx, store, 2021, time.November, 7, ny)
+	expectOrder(t, "GetTaskByDueDateIn(Nov 7, New York)", tasks, err, firstOneThirty, secondOneThirty, fallLate)
+}
+
+func testGetOverdueTasks(t *testing.T, store taskstore.Store) {
+	now := time.Date(2021, time.August, 4, 12, 0, 0, 0, time.UTC)
+
+	overdue := mustCreate(t, store, "overdue", nil, now.Add(-48*time.Hour))
+	done := mustCreate(t, store, "done", nil, now.Add(-24*time.Hour))
+	blocked := mustCreate(t, store, "blocked", nil, now.Add(-time.Hour))
+	mustCreate(t, store, "due now", nil, now)
+	mustCreate(t, store, "later", nil, now.Add(time.Hour))
+
+	for id, status := range map[int]taskstore.Status{done: taskstore.StatusDone, blocked: taskstore.StatusBlocked} {
+		task, err := store.GetTask(ctx, id)
+
+		if err != nil {
+			t.Fatalf("GetTask(%d): %v", id, err)
+		}
+
+		task.Status = status
+
+		if _, err := store.UpdateTask(ctx, task); err != nil {
+			t.Fatalf("UpdateTask(%d) to %s: %v", id, status, err)
+		}
+	}
+
+	tasks, err := taskstore.GetOverdueTasks(ctx, store, now)
+	expectOrder(t, "GetOverdueTasks", tasks, err, overdue, blocked)
+}
+
+func testSearch(t *testing.T, store taskstore.Store) {
+	due := time.Date(2021, time.August, 1, 0, 0, 0, 0, time.UTC)
+	report := mustCreate(t, store, "Write the quarterly report", nil, due)
+	reports := mustCreate(t, store, "Reports, reports: reporting & reported", nil, due)
+	milk := mustCreate(t, store, "Buy milk", nil, due)
+
+	search := func(query string, want ...int) []taskstore.SearchResult {
+		t.Helper()
+
+		results, err := taskstore.Search(ctx, store, query, 0)
+
+		if err != nil {
+			t.Fatalf("Search(%q): %v", query, err)
+		}
+
+		var got []int
+
+		for _, result := range results {
+			got = append(got, result.Task.ID)
+		}
+
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("Search(%q) = %v, want %v", query, got, want)
+		}
+
+		return results
+	}
+
+	// every inflection of report counts, so the second task ranks first
+	results := search("REPORTING", reports, report)
+
+	if results[0].Snippet != "<mark>Reports</mark>, <mark>reports</mark>: <mark>reporting</mark> &amp; <mark>reported</mark>" {
+		t.Errorf("snippet = %q", results[0].Snippet)
+	}
+
+	search("rep", reports, report)
+	search("quarterly report", report)
+	search("report milk")
+	search("MILK", milk)
+
+	if _, err := taskstore.Search(ctx, store, " ,. ", 0); !errors.Is(err, taskstore.ErrEmptyQuery) {
+		t.Errorf("Search without words: err = %v, want ErrEmptyQuery", err)
+	}
+
+	if _, err := store.UpdateTask(ctx, taskstore.Task{ID: milk, Text: "Buy oat milk", Due: due}); err != nil {
+		t.Fatalf("UpdateTask(%d): %v", milk, err)
+	}
+
+	search("oat", milk)
+
+	if err := store.DeleteTask(ctx, report, 0); err != nil {
+		t.Fatalf("DeleteTask(%d): %v", report, err)
+	}
+
+	search("report", reports)
+
+	if results, err := taskstore.Search(ctx, store, "report", 1); err != nil || len(results) != 1 {
+		t.Errorf("Search with limit 1 = %d results, %v", len(results), err)
+	}
+
+	if _, err := store.RestoreTask(ctx, report); err != nil {
+		t.Fatalf("RestoreTask(%d): %v", report, err)
+	}
+
+	search("quarterly", report)
+
+	mustCreate(t, store, "Report the milk delivery", nil, due)
+
+	// a store keeping its own index ranks its tasks as indexing them at each search does
+	for _, query := range []string{"report", "rep", "buy milk", "nothing"} {
+		indexed, err := taskstore.Search(ctx, store, query, 0)
+
+		if err != nil {
+			t.Fatalf("Search(%q): %v", query, err)
+		}
+
+		scanned, err := taskstore.Search(ctx, struct{ taskstore.Store }{store}, query, 0)
+
+		if err != nil {
+			t.Fatalf("Search(%q) without the store's index: %v", query, err)
+		}
+
+		if len(indexed) != len(scanned) {
+			t.Fatalf("Search(%q) = %d results, %d without the store's index", query, len(indexed), len(scanned))
+		}
+
+		for i := range indexed {
+			if indexed[i].Task.ID != scanned[i].Task.ID || math.Abs(indexed[i].Score-scanned[i].Score) > 1e-9 || indexed[i].Snippet != scanned[i].Snippet {
+				t.Errorf("Search(%q)[%d] = %+v, %+v without the store's index", query, i, indexed[i], scanned[i])
+			}
+		}
+	}
+}
+
+func testConcurrentCreate(t *testing.T, store taskstore.Store) {
+	const workers, perWorker = 8, 25
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	seen := make(map[int]bool)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < perWorker; i++ {
+				id, err := store.CreateTask(ctx, "concurrent", nil, time.Now())
+
+				if err != nil {
+					t.Errorf("CreateTask: %v", err)
+					return
+				}
+
+				mu.Lock()
+				if seen[id] {
+					t.Errorf("id %d handed out twice", id)
+				}
+				seen[id] = true
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	all, err := store.GetAllTasks(ctx)
+
+	if err != nil {
+		t.Fatalf("GetAllTasks: %v", err)
+	}
+
+	if len(all) != workers*perWorker {
+		t.Errorf("GetAllTasks returned %d tasks, want %d", len(all), workers*perWorker)
+	}
+}
+
+// testConcurrentMixed has writers create, update and delete tasks while readers query
+// them, then checks that every lookup agrees with the tasks left; run it with -race.
+func testConcurrentMixed(t *testing.T, store taskstore.Store) {
+	const writers, readers, perWriter = 4, 4, 24
+
+	due := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+	done := make(chan struct{})
+
+	var writing, reading sync.WaitGroup
+
+	for r := 0; r < readers; r++ {
+		reading.Add(1)
+
+		go func() {
+			defer reading.Done()
+
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				tasks, err := store.GetTaskByStatus(ctx, taskstore.StatusDone)
+
+				if err != nil {
+					t.Errorf("GetTaskByStatus: %v", err)
+					return
+				}
+
+				for _, task := range tasks {
+					if task.Status != taskstore.StatusDone {
+						t.Errorf("GetTaskByStatus(done) returned task %d in status %s", task.ID, task.Status)
+						return
+					}
+				}
+
+				if _, err := store.GetTaskByDueRange(ctx, due, due.Add(time.Hour), taskstore.HalfOpen); err != nil {
+					t.Errorf("GetTaskByDueRange: %v", err)
+					return
+				}
+			}
+		}()
+	}
+
+	for w := 0; w < writers; w++ {
+		tag := fmt.Sprintf("writer%d", w)
+		writing.Add(1)
+
+		go func() {
+			defer writing.Done()
+
+			for i := 0; i < perWriter; i++ {
+				id, err := store.CreateTask(ctx, "mixed", []string{tag}, due)
+
+				if err != nil {
+					t.Errorf("CreateTask: %v", err)
+					return
+				}
+
+				task, err := store.GetTask(ctx, id)
+
+				if err != nil {
+					t.Errorf("GetTask(%d): %v", id, err)
+					return
+				}
+
+				task.Status = taskstore.StatusDone
+
+				if _, err := store.UpdateTask(ctx, task); err != nil {
+					t.Errorf("UpdateTask(%d): %v", id, err)
+					return
+				}
+
+				if i%2 == 1 {
+					if err := store.DeleteTask(ctx, id, 0); err != nil {
+						t.Errorf("DeleteTask(%d): %v", id, err)
+						return
+					}
+				}
+
+				if _, err := store.GetTaskByTag(ctx, tag); err != nil {
+					t.Errorf("GetTaskByTag(%q): %v", tag, err)
+					return
+				}
+			}
+		}()
+	}
+
+	writing.Wait()
+	close(done)
+	reading.Wait()
+
+	all, err := store.GetAllTasks(ctx)
+
+	if err != nil {
+		t.Fatalf("GetAllTasks: %v", err)
+	}
+
+	if len(all) != writers*perWriter/2 {
+		t.Errorf("GetAllTasks returned %d tasks, want %d", len(all), writers*perWriter/2)
+	}
+
+	want := ids(all)
+
+	tasks, err := store.GetTaskByStatus(ctx, taskstore.StatusDone)
+	expectIDs(t, "GetTaskByStatus(done)", tasks, err, want...)
+
+	tasks, err = store.GetTaskByDueRange(ctx, due, due.Add(time.Hour), taskstore.HalfOpen)
+	expectIDs(t, "GetTaskByDueRange", tasks, err, want...)
+
+	var tagged []int
+
+	for w := 0; w < writers; w++ {
+		tasks, err := store.GetTaskByTag(ctx, fmt.Sprintf("writer%d", w))
+
+		if err != nil {
+			t.Fatalf("GetTaskByTag: %v", err)
+		}
+
+		if len(tasks) != perWriter/2 {
+			t.Errorf("GetTaskByTag(writer%d) returned %d tasks, want %d", w, len(tasks), perWriter/2)
+		}
+
+		tagged = append(tagged, ids(tasks)...)
+	}
+
+	sort.Ints(tagged)
+
+	if fmt.Sprint(tagged) != fmt.Sprint(want) {
+		t.Errorf("tasks by tag are %v, want %v", tagged, want)
+	}
+}
@@ -3,8 +3,12 @@
 package taskstore
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,82 +17,685 @@ type Task struct {
 	Text string    `json:"text"`
 	Tags []string  `json:"tags"`
 	Due  time.Time `json:"due"`
+
+	// Version starts at 1 and grows by one with every update of the task
+	Version int `json:"version"`
+
+	Status Status `json:"status"`
+	// CompletedAt is when the task was last marked done, nil unless it is done;
+	// stores maintain it, see ApplyUpdate.
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	// DeletedAt is when the task was moved to the trash, nil for a live task
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+
+	// Owner is the tenant the task was created for (see WithTenant), "" for nobody;
+	// it never changes.
+	Owner string `json:"owner,omitempty"`
+}
+
+// HasTag reports whether the task is tagged tag
+func (task Task) HasTag(tag string) bool {
+	for _, t := range task.Tags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ErrNotFound is returned (wrapped) by every Store when a task does not exist;
+// check for it with errors.Is.
+var ErrNotFound = errors.New("not found")
+
+// NotFound builds the error a Store returns when the task with the given id does not exist.
+func NotFound(id int) error {
+	return fmt.Errorf("task with id = %d %w", id, ErrNotFound)
+}
+
+// ErrVersionConflict is returned (wrapped) when a mutation expected another version of
+// the task than the stored one; check for it with errors.Is.
+var ErrVersionConflict = errors.New("version conflict")
+
+// CheckVersion returns ErrVersionConflict unless the task is at the expected version;
+// an expected version of 0 accepts any.
+func CheckVersion(task Task, expected int) error {
+	if expected != 0 && expected != task.Version {
+		return fmt.Errorf("task with id = %d is at version %d, not %d: %w", task.ID, task.Version, expected, ErrVersionConflict)
+	}
+
+	return nil
+}
+
+// ApplyUpdate returns the task a Store keeps when update replaces current:
+// update.Version is the version the caller expects to replace (0 for any),
+// and the stored task gets the next version. An empty update.Status keeps the
+// current status, any other one must be reachable from it (see CheckTransition);
+// update.CompletedAt, update.DeletedAt and update.Owner are ignored: an update
+// neither moves a task to the trash nor gives it to another owner.
+func ApplyUpdate(current, update Task) (Task, error) {
+	if err := CheckVersion(current, update.Version); err != nil {
+		return Task{}, err
+	}
+
+	update, err := applyTransition(current, update)
+
+	if err != nil {
+		return Task{}, err
+	}
+
+	update.Version = current.Version + 1
+	update.Owner = current.Owner
+	update.DeletedAt = current.DeletedAt
+
+	return update, nil
+}
+
+// Store is the storage abstraction shared by all the task servers;
+// implementations must be safe to call concurrently.
+//
+// Deleted tasks are not gone at once: they move to a trash, out of reach of every
+// lookup, until they are restored or purged. Every mutation of a task but PutTask is
+// recorded as a Revision, made by the Author of its context.
+type Store interface {
+	CreateTask(ctx context.Context, text string, tags []string, due time.Time) (int, error)
+	GetTask(ctx context.Context, id int) (Task, error)
+	// UpdateTask replaces the task with the same ID and returns it as stored,
+	// see ApplyUpdate for how task.Version is handled.
+	UpdateTask(ctx context.Context, task Task) (Task, error)
+	// DeleteTask moves the task to the trash if it is at version (0 for any version)
+	DeleteTask(ctx context.Context, id int, version int) error
+	// DeleteAllTasks moves every task to the trash
+	DeleteAllTasks(ctx context.Context) error
+	GetAllTasks(ctx context.Context) ([]Task, error)
+	GetTaskByTag(ctx context.Context, tag string) ([]Task, error)
+	// GetTaskByDueDate matches the calendar day of each due time in the offset it was given
+	// with; GetTaskByDueDateIn matches days in a given zone instead.
+	GetTaskByDueDate(ctx context.Context, year int, month time.Month, day int) ([]Task, error)
+	GetTaskByStatus(ctx context.Context, status Status) ([]Task, error)
+	// GetTaskByDueRange returns the tasks due from from to to, ordered by due time; bounds
+	// tells whether from and to themselves are in the range, a zero from or to leaves that
+	// end of it open.
+	GetTaskByDueRange(ctx context.Context, from, to time.Time, bounds Bounds) ([]Task, error)
+
+	// GetTrash returns the deleted tasks, most recently deleted first
+	GetTrash(ctx context.Context) ([]Task, error)
+	// GetTrashedTask returns the task with id from the trash; ErrNotFound when it is not there
+	GetTrashedTask(ctx context.Context, id int) (Task, error)
+	// RestoreTask moves a task back out of the trash and returns it as stored, with the
+	// next version; ErrNotFound when it is not in the trash.
+	RestoreTask(ctx context.Context, id int) (Task, error)
+	// PurgeTrash deletes the tasks moved to the trash before before for good
+	// and returns how many there were.
+	PurgeTrash(ctx context.Context, before time.Time) (int, error)
+
+	// GetHistory returns the revisions of a task, live or in the trash, oldest first;
+	// purging a task drops its history too.
+	GetHistory(ctx context.Context, id int) ([]Revision, error)
+	// RevertTask puts a live task back in the state revision number left it in (see
+	// ApplyRevert) if it is at version (0 for any version), and returns it as stored.
+	RevertTask(ctx context.Context, id int, number int, version int) (Task, error)
+}
+
+// DayRange returns the bounds [from, to) of a calendar day in loc. Days are not always
+// 24 hours long: across daylight saving time changes they last 23 or 25 hours.
+func DayRange(year int, month time.Month, day int, loc *time.Location) (time.Time, time.Time) {
+	return time.Date(year, month, day, 0, 0, 0, 0, loc), time.Date(year, month, day+1, 0, 0, 0, 0, loc)
+}
+
+// GetTaskByDueDateIn returns the tasks due on a calendar day in loc, ordered by due time.
+// A nil loc keeps the behavior of Store.GetTaskByDueDate, which matches the day in the
+// offset each task was given with.
+func GetTaskByDueDateIn(ctx context.Context, store Store, year int, month time.Month, day int, loc *time.Location) ([]Task, error) {
+	if loc == nil {
+		return store.GetTaskByDueDate(ctx, year, month, day)
+	}
+
+	from, to := DayRange(year, month, day, loc)
+
+	return store.GetTaskByDueRange(ctx, from, to, HalfOpen)
+}
+
+// GetOverdueTasks returns the tasks due before now that are neither done nor cancelled,
+// ordered by due time.
+func GetOverdueTasks(ctx context.Context, store Store, now time.Time) ([]Task, error) {
+	tasks, err := store.GetTaskByDueRange(ctx, time.Time{}, now, HalfOpen)
+
+	if err != nil {
+		return nil, err
+	}
+
+	overdue := tasks[:0]
+
+	for _, task := range tasks {
+		if !task.Status.Closed() {
+			overdue = append(overdue, task)
+		}
+	}
+
+	return overdue, nil
+}
+
+// Migrator is implemented by the stores that can be copied task by task with their ids
+// preserved; the taskstore-migrate command moves tasks between backends through it.
+type Migrator interface {
+	Store
+
+	// ForEachTask calls fn with every task in ascending id order, the ones in the trash
+	// included, stopping at the first error.
+	ForEachTask(ctx context.Context, fn func(Task) error) error
+
+	// PutTask stores task under its own id, replacing any task with that id,
+	// and moves the id counter past it; a task with DeletedAt set goes to the trash.
+	PutTask(ctx context.Context, task Task) error
+
+	// PutRevision stores rev under its task id and number, replacing any revision there,
+	// so histories can be copied along with their tasks.
+	PutRevision(ctx context.Context, rev Revision) error
+
+	// NextID returns the id the next CreateTask will hand out
+	NextID(ctx context.Context) (int, error)
+
+	// SetNextID raises the id counter to next; it never moves backwards,
+	// so ids are never reused.
+	SetNextID(ctx context.Context, next int) error
 }
 
 // In-memory database;
-// TaskStore methods are safe to call concurrently.
+// TaskStore methods are safe to call concurrently: reads share the lock and run in
+// parallel, only mutations take it exclusively, and ids are handed out without it.
+// Tags, statuses and due times are indexed, so lookups by them never scan every task,
+// and so are the words of task texts, for SearchTasks. Tasks in the trash are kept apart
+// and left out of the indexes. The history of every task is kept in memory along with it.
 type TaskStore struct {
-	sync.Mutex
-	tasks  map[int]Task
-	nextId int
+	// nextId is only accessed atomically (and kept first, so it is 64-bit aligned
+	// on 32-bit platforms); a task's id is below it by the time the task is visible.
+	nextId int64
+
+	mu       sync.RWMutex // guards tasks, trash, history and the indexes
+	tasks    map[int]Task
+	trash    map[int]Task
+	history  map[int][]Revision // by task id, oldest first
+	tags     idIndex
+	statuses idIndex
+	due      DueIndex
+	text     TextIndex
+}
+
+// idIndex maps a key (a tag, a status) to the set of ids of the tasks that have it
+type idIndex map[string]map[int]struct{}
+
+func (ix idIndex) add(key string, id int) {
+	ids, ok := ix[key]
+
+	if !ok {
+		ids = make(map[int]struct{})
+		ix[key] = ids
+	}
+
+	ids[id] = struct{}{}
+}
+
+func (ix idIndex) remove(key string, id int) {
+	if ids, ok := ix[key]; ok {
+		delete(ids, id)
+
+		if len(ids) == 0 {
+			delete(ix, key)
+		}
+	}
 }
 
+// lookup returns the ids with key in ascending order
+func (ix idIndex) lookup(key string) []int {
+	ids := make([]int, 0, len(ix[key]))
+
+	for id := range ix[key] {
+		ids = append(ids, id)
+	}
+
+	sort.Ints(ids)
+
+	return ids
+}
+
+var _ Migrator = (*TaskStore)(nil)
+var _ Searcher = (*TaskStore)(nil)
+
 // constructor
 func New() *TaskStore {
-	ts := &TaskStore{}
-	ts.tasks = make(map[int]Task)
-	ts.nextId = 0
+	ts := &TaskStore{trash: make(map[int]Task), history: make(map[int][]Revision)}
+	ts.reset()
 
 	return ts
 }
 
 // API
-func (ts *TaskStore) CreateTask(text string, tags []string, due time.Time) int {
-	ts.Lock()
-	defer ts.Unlock()
+func (ts *TaskStore) CreateTask(ctx context.Context, text string, tags []string, due time.Time) (int, error) {
+	id := int(atomic.AddInt64(&ts.nextId, 1) - 1)
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
 
 	task := Task{
-		ID:   ts.nextId,
-		Text: text,
-		Due:  due}
+		ID:      id,
+		Text:    text,
+		Due:     due,
+		Version: 1,
+		Status:  StatusOpen,
+		Owner:   TenantOf(ctx).Owner}
 
 	task.Tags = tags
 	// copy(task.Tags, tags)
 
-	ts.tasks[ts.nextId] = task
-	ts.nextId++
+	ts.put(task)
+	ts.record(ctx, ActionCreated, Task{}, task)
+
+	return task.ID, nil
+}
+
+// PutTask is also how persistent stores rebuild the in-memory state
+func (ts *TaskStore) PutTask(ctx context.Context, task Task) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.put(Upgrade(task))
+	ts.raiseNextID(task.ID + 1)
+
+	return nil
+}
+
+// raiseNextID moves the id counter up to next unless it is already past it
+func (ts *TaskStore) raiseNextID(next int) {
+	for {
+		current := atomic.LoadInt64(&ts.nextId)
+
+		if int64(next) <= current || atomic.CompareAndSwapInt64(&ts.nextId, current, int64(next)) {
+			return
+		}
+	}
+}
+
+func (ts *TaskStore) ForEachTask(ctx context.Context, fn func(Task) error) error {
+	tasks, _ := ts.Dump()
+
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+
+	for _, task := range tasks {
+		if err := fn(task); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ts *TaskStore) NextID(ctx context.Context) (int, error) {
+	return int(atomic.LoadInt64(&ts.nextId)), nil
+}
+
+func (ts *TaskStore) SetNextID(ctx context.Context, next int) error {
+	ts.raiseNextID(next)
+
+	return nil
+}
+
+// Dump returns every task, the ones in the trash included, together with the next id to
+// be handed out, so persistent stores can snapshot the whole state.
+func (ts *TaskStore) Dump() ([]Task, int) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	tasks := make([]Task, 0, len(ts.tasks)+len(ts.trash))
+
+	for _, task := range ts.tasks {
+		tasks = append(tasks, task)
+	}
+
+	for _, task := range ts.trash {
+		tasks = append(tasks, task)
+	}
+
+	return tasks, int(atomic.LoadInt64(&ts.nextId))
+}
+
+// Load replaces the whole content of the store with a previous Dump; the history starts
+// out empty, for LoadHistory to fill.
+func (ts *TaskStore) Load(tasks []Task, nextId int) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
 
-	return task.ID
+	ts.reset()
+	ts.trash = make(map[int]Task)
+	ts.history = make(map[int][]Revision)
+
+	for _, task := range tasks {
+		ts.put(Upgrade(task))
+	}
+
+	atomic.StoreInt64(&ts.nextId, int64(nextId))
 }
 
-func (ts *TaskStore) GetTask(id int) (Task, error) {
-	ts.Lock()
-	defer ts.Unlock()
+func (ts *TaskStore) GetTask(ctx context.Context, id int) (Task, error) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
 
 	task, ok := ts.tasks[id]
 
 	if ok {
 		return task, nil
 	} else {
-		return Task{}, fmt.Errorf("task with id = %d not found", id)
+		return Task{}, NotFound(id)
 	}
 }
 
-func (ts *TaskStore) DeleteTask(id int) error {
-	ts.Lock()
-	defer ts.Unlock()
+func (ts *TaskStore) UpdateTask(ctx context.Context, task Task) (Task, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	current, ok := ts.tasks[task.ID]
 
-	if _, ok := ts.tasks[id]; !ok {
-		return fmt.Errorf("task with id = %d not found", id)
+	if !ok {
+		return Task{}, NotFound(task.ID)
 	}
 
-	delete(ts.tasks, id)
+	task, err := ApplyUpdate(current, task)
+
+	if err != nil {
+		return Task{}, err
+	}
+
+	ts.put(task)
+	ts.record(ctx, ActionUpdated, current, task)
+
+	return task, nil
+}
+
+func (ts *TaskStore) DeleteTask(ctx context.Context, id int, version int) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	task, ok := ts.tasks[id]
+
+	if !ok {
+		return NotFound(id)
+	}
+
+	if err := CheckVersion(task, version); err != nil {
+		return err
+	}
+
+	trashed := Trashed(task, time.Now())
+	ts.put(trashed)
+	ts.record(ctx, ActionDeleted, task, trashed)
 
 	return nil
 }
 
-func (ts *TaskStore) DeleteAllTasks() error {
-	ts.Lock()
-	defer ts.Unlock()
+func (ts *TaskStore) DeleteAllTasks(ctx context.Context) error {
+	ts.TrashAllTasks(ctx, time.Now())
 
-	ts.tasks = make(map[int]Task)
+	return nil
+}
+
+// TrashAllTasks moves every task to the trash as deleted at at, recording revisions
+// made by the author of ctx, so persistent stores can replay a DeleteAllTasks.
+func (ts *TaskStore) TrashAllTasks(ctx context.Context, at time.Time) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	for id, task := range ts.tasks {
+		trashed := Trashed(task, at)
+		ts.trash[id] = trashed
+		ts.recordAt(ctx, ActionDeleted, task, trashed, at)
+	}
+
+	ts.reset()
+}
+
+func (ts *TaskStore) GetTrashedTask(ctx context.Context, id int) (Task, error) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	task, ok := ts.trash[id]
+
+	if !ok {
+		return Task{}, NotFound(id)
+	}
+
+	return task, nil
+}
+
+func (ts *TaskStore) GetTrash(ctx context.Context) ([]Task, error) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	trash := make([]Task, 0, len(ts.trash))
+
+	for _, task := range ts.trash {
+		trash = append(trash, task)
+	}
+
+	SortTrash(trash)
+
+	return trash, nil
+}
+
+func (ts *TaskStore) RestoreTask(ctx context.Context, id int) (Task, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	task, ok := ts.trash[id]
+
+	if !ok {
+		return Task{}, NotFound(id)
+	}
+
+	restored := Restored(task)
+	ts.put(restored)
+	ts.record(ctx, ActionRestored, task, restored)
+
+	return restored, nil
+}
+
+func (ts *TaskStore) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	purged := 0
+
+	for id, task := range ts.trash {
+		if task.DeletedAt.Before(before) {
+			delete(ts.trash, id)
+			delete(ts.history, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (ts *TaskStore) GetHistory(ctx context.Context, id int) ([]Revision, error) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	_, live := ts.tasks[id]
+	_, trashed := ts.trash[id]
+
+	if !live && !trashed {
+		return nil, NotFound(id)
+	}
+
+	return append([]Revision{}, ts.history[id]...), nil
+}
+
+func (ts *TaskStore) RevertTask(ctx context.Context, id int, number int, version int) (Task, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	current, ok := ts.tasks[id]
+
+	if !ok {
+		return Task{}, NotFound(id)
+	}
+
+	rev, err := FindRevision(ts.history[id], id, number)
+
+	if err != nil {
+		return Task{}, err
+	}
+
+	task, err := ApplyRevert(current, rev, version)
+
+	if err != nil {
+		return Task{}, err
+	}
+
+	ts.put(task)
+	ts.record(ctx, ActionReverted, current, task)
+
+	return task, nil
+}
+
+func (ts *TaskStore) PutRevision(ctx context.Context, rev Revision) error {
+	if err := CheckRevision(rev); err != nil {
+		return err
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.putRevision(rev)
 
 	return nil
 }
 
-func (ts *TaskStore) GetAllTasks() []Task {
-	ts.Lock()
-	defer ts.Unlock()
+// NextRevision returns the number the next revision of the task with id gets,
+// so persistent stores can log revisions before they apply them.
+func (ts *TaskStore) NextRevision(id int) int {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	return ts.nextRevision(id)
+}
+
+// DumpHistory returns the revisions of every task, for persistent stores to snapshot
+// along with a Dump.
+func (ts *TaskStore) DumpHistory() []Revision {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	var history []Revision
+
+	for _, revs := range ts.history {
+		history = append(history, revs...)
+	}
+
+	return history
+}
+
+// LoadHistory adds the revisions of a previous DumpHistory
+func (ts *TaskStore) LoadHistory(history []Revision) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	for _, rev := range history {
+		ts.putRevision(rev)
+	}
+}
+
+// record adds the revision of a mutation made now; the caller holds the write lock.
+func (ts *TaskStore) record(ctx context.Context, action Action, before, after Task) {
+	ts.recordAt(ctx, action, before, after, time.Now())
+}
+
+func (ts *TaskStore) recordAt(ctx context.Context, action Action, before, after Task, at time.Time) {
+	rev := NewRevision(ctx, action, before, after, at)
+	rev.Number = ts.nextRevision(rev.TaskID)
+
+	ts.history[rev.TaskID] = append(ts.history[rev.TaskID], rev)
+}
+
+// nextRevision numbers the revision after the last one of the task with id;
+// the caller holds the lock.
+func (ts *TaskStore) nextRevision(id int) int {
+	history := ts.history[id]
+
+	if len(history) == 0 {
+		return 1
+	}
+
+	return history[len(history)-1].Number + 1
+}
+
+// putRevision stores rev in the history of its task, which stays ordered by number,
+// in place of a revision with the same number; numbers put out of order leave no
+// empty revisions behind. The caller holds the write lock.
+func (ts *TaskStore) putRevision(rev Revision) {
+	history := ts.history[rev.TaskID]
+	i := sort.Search(len(history), func(i int) bool { return history[i].Number >= rev.Number })
+
+	if i < len(history) && history[i].Number == rev.Number {
+		history[i] = rev
+		return
+	}
+
+	history = append(history, Revision{})
+	copy(history[i+1:], history[i:])
+	history[i] = rev
+	ts.history[rev.TaskID] = history
+}
+
+// reset empties the live tasks and the indexes, leaving the trash alone;
+// the caller holds the write lock.
+func (ts *TaskStore) reset() {
+	ts.tasks = make(map[int]Task)
+	ts.tags = make(idIndex)
+	ts.statuses = make(idIndex)
+	ts.due.Reset()
+	ts.text.Reset()
+}
+
+// put stores task, replacing any task with its id, and keeps the indexes in step;
+// a task with DeletedAt set goes to the trash instead. The caller holds the write lock.
+func (ts *TaskStore) put(task Task) {
+	ts.remove(task.ID)
+	delete(ts.trash, task.ID)
+
+	if task.DeletedAt != nil {
+		ts.trash[task.ID] = task
+		return
+	}
+
+	ts.tasks[task.ID] = task
+	ts.due.Insert(task.Due, task.ID)
+	ts.text.Add(task.ID, task.Text)
+	ts.statuses.add(string(task.Status), task.ID)
+
+	for _, tag := range task.Tags {
+		ts.tags.add(tag, task.ID)
+	}
+}
+
+// remove deletes the live task with id, if any, from the map and the indexes;
+// the caller holds the write lock.
+func (ts *TaskStore) remove(id int) {
+	if task, ok := ts.tasks[id]; ok {
+		ts.due.Remove(task.Due, id)
+		ts.text.Remove(id, task.Text)
+		ts.statuses.remove(string(task.Status), id)
+
+		for _, tag := range task.Tags {
+			ts.tags.remove(tag, id)
+		}
+
+		delete(ts.tasks, id)
+	}
+}
+
+func (ts *TaskStore) GetAllTasks(ctx context.Context) ([]Task, error) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
 
 	var allTasks []Task
 	// allTasks := make([]Task, 0, len(ts.tasks))
@@ -97,35 +704,40 @@ func (ts *TaskStore) GetAllTasks() []Task {
 		allTasks = append(allTasks, task)
 	}
 
-	return allTasks
+	return allTasks, nil
 }
 
-func (ts *TaskStore) GetTaskByTag(tag string) []Task {
-	ts.Lock()
-	defer ts.Unlock()
+func (ts *TaskStore) GetTaskByTag(ctx context.Context, tag string) ([]Task, error) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	return ts.byID(ts.tags.lookup(tag)), nil
+}
 
+// byID returns the tasks with the given ids; the caller holds the lock.
+func (ts *TaskStore) byID(ids []int) []Task {
 	var tasks []Task
 
-TaskLoop:
-	for _, task := range ts.tasks {
-		for _, taskTag := range task.Tags {
-			if taskTag == tag {
-				tasks = append(tasks, task)
-				continue TaskLoop
-			}
-		}
+	for _, id := range ids {
+		tasks = append(tasks, ts.tasks[id])
 	}
 
 	return tasks
 }
 
-func (ts *TaskStore) GetTaskByDueDate(year int, month time.Month, day int) []Task {
-	ts.Lock()
-	defer ts.Unlock()
+func (ts *TaskStore) GetTaskByDueDate(ctx context.Context, year int, month time.Month, day int) ([]Task, error) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	// The day is matched in each task's own offset, so candidates are the tasks due around
+	// it in UTC; offsets are far below the two days of margin.
+	from := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1)
 
 	var tasks []Task
 
-	for _, task := range ts.tasks {
+	for _, id := range ts.due.Between(from.Add(-48*time.Hour), to.Add(48*time.Hour), HalfOpen) {
+		task := ts.tasks[id]
 		y, m, d := task.Due.Date()
 
 		if y == year && m == month && d == day {
@@ -133,5 +745,26 @@ func (ts *TaskStore) GetTaskByDueDate(year int, month time.Month, day int) []Tas
 		}
 	}
 
-	return tasks
+	return tasks, nil
+}
+
+func (ts *TaskStore) GetTaskByStatus(ctx context.Context, status Status) ([]Task, error) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	return ts.byID(ts.statuses.lookup(string(status))), nil
+}
+
+func (ts *TaskStore) GetTaskByDueRange(ctx context.Context, from, to time.Time, bounds Bounds) ([]Task, error) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	return ts.byID(ts.due.Between(from, to, bounds)), nil
+}
+
+func (ts *TaskStore) SearchTasks(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	return ts.text.Results(query, limit, func(id int) Task { return ts.tasks[id] })
 }
@@ -0,0 +1,40 @@
+package taskstore_test
+
+import (
+	"testing"
+
+	"github.com/shien/restserver/taskstore"
+	"github.com/shien/restserver/taskstore/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) taskstore.Store {
+		return taskstore.New()
+	})
+}
+
+func TestFeedConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) taskstore.Store {
+		return taskstore.NewFeed(taskstore.New(), taskstore.DefaultFeedOptions)
+	})
+}
+
+func TestConcurrent(t *testing.T) {
+	storetest.RunConcurrent(t, func(t *testing.T) taskstore.Store {
+		return taskstore.New()
+	})
+}
+
+// BenchmarkLookups compares the indexed tag, status and due date lookups with scans
+func BenchmarkLookups(b *testing.B) {
+	storetest.Benchmark(b, func(b *testing.B) taskstore.Store {
+		return taskstore.New()
+	})
+}
+
+// BenchmarkParallel compares parallel reads and writes with the same calls serialized
+func BenchmarkParallel(b *testing.B) {
+	storetest.BenchmarkParallel(b, func(b *testing.B) taskstore.Store {
+		return taskstore.New()
+	})
+}
@@ -0,0 +1,306 @@
+package taskstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrForbidden is returned (wrapped) for a call the tenant of its context is not allowed
+// to make; check for it with errors.Is.
+var ErrForbidden = errors.New("forbidden")
+
+// Tenant is who the store calls made with a context are made for, see WithTenant
+type Tenant struct {
+	// Owner is the owner of the tasks the tenant creates, "" for anonymous callers
+	Owner string
+	// Admin lets the tenant reach the tasks of every owner through a Scoped store
+	Admin bool
+}
+
+// Reaches reports whether the tenant may see and change task
+func (tenant Tenant) Reaches(task Task) bool {
+	return tenant.Admin || task.Owner == tenant.Owner
+}
+
+type tenantContextKey struct{}
+
+// WithTenant returns a context in which the tasks created belong to tenant.Owner, and a
+// Scoped store keeps every call to them; authentication middleware uses it with the
+// signed in user.
+func WithTenant(ctx context.Context, tenant Tenant) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+// TenantOf returns the tenant of ctx, the anonymous one when there is none
+func TenantOf(ctx context.Context) Tenant {
+	tenant, _ := ctx.Value(tenantContextKey{}).(Tenant)
+
+	return tenant
+}
+
+// Scoped is a Store that keeps every call to the tasks of the tenant of its context: the
+// tasks of other owners are left out of the listings, and looking one up, changing it,
+// restoring it or reading its history fails with ErrNotFound as for a task that does not
+// exist. Admin tenants reach every task. The wrapped store records the owner of the tasks
+// it creates.
+type Scoped struct {
+	Store
+}
+
+// scopedWatcher is a Scoped Watcher, sending each subscriber the events of the tasks its
+// tenant reaches
+type scopedWatcher struct {
+	*Scoped
+	watcher Watcher
+}
+
+var (
+	_ Watcher  = scopedWatcher{}
+	_ Searcher = (*Scoped)(nil)
+)
+
+// NewScoped returns store scoped to the tenant of each call; it is a Watcher when store is one
+func NewScoped(store Store) Store {
+	scoped := &Scoped{Store: store}
+
+	if watcher, ok := store.(Watcher); ok {
+		return scopedWatcher{Scoped: scoped, watcher: watcher}
+	}
+
+	return scoped
+}
+
+// scope keeps the tasks the tenant of ctx reaches
+func scope(ctx context.Context, tasks []Task, err error) ([]Task, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	tenant := TenantOf(ctx)
+
+	if tenant.Admin {
+		return tasks, nil
+	}
+
+	kept := make([]Task, 0, len(tasks))
+
+	for _, task := range tasks {
+		if tenant.Reaches(task) {
+			kept = append(kept, task)
+		}
+	}
+
+	return kept, nil
+}
+
+// reach returns ErrNotFound unless the tenant of ctx reaches the task id, live or in the trash
+func (s *Scoped) reach(ctx context.Context, id int) error {
+	tenant := TenantOf(ctx)
+
+	if tenant.Admin {
+		return nil
+	}
+
+	task, err := s.Store.GetTask(ctx, id)
+
+	if errors.Is(err, ErrNotFound) {
+		task, err = s.Store.GetTrashedTask(ctx, id)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !tenant.Reaches(task) {
+		return NotFound(id)
+	}
+
+	return nil
+}
+
+func (s *Scoped) GetTask(ctx context.Context, id int) (Task, error) {
+	task, err := s.Store.GetTask(ctx, id)
+
+	if err != nil {
+		return Task{}, err
+	}
+
+	if !TenantOf(ctx).Reaches(task) {
+		return Task{}, NotFound(id)
+	}
+
+	return task, nil
+}
+
+func (s *Scoped) UpdateTask(ctx context.Context, task Task) (Task, error) {
+	if err := s.reach(ctx, task.ID); err != nil {
+		return Task{}, err
+	}
+
+	return s.Store.UpdateTask(ctx, task)
+}
+
+func (s *Scoped) DeleteTask(ctx context.Context, id int, version int) error {
+	if err := s.reach(ctx, id); err != nil {
+		return err
+	}
+
+	return s.Store.DeleteTask(ctx, id, version)
+}
+
+// DeleteAllTasks moves the tasks of the tenant to the trash. Unless the tenant is an admin
+// they go one DeleteTask at a time, so it is not atomic: a failure leaves those before it
+// in the trash, and a persistent store commits each on its own.
+func (s *Scoped) DeleteAllTasks(ctx context.Context) error {
+	if TenantOf(ctx).Admin {
+		return s.Store.DeleteAllTasks(ctx)
+	}
+
+	tasks, err := s.GetAllTasks(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		// one deleted meanwhile is as good as deleted here
+		if err := s.Store.DeleteTask(ctx, task.ID, 0); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Scoped) GetAllTasks(ctx context.Context) ([]Task, error) {
+	tasks, err := s.Store.GetAllTasks(ctx)
+
+	return scope(ctx, tasks, err)
+}
+
+func (s *Scoped) GetTaskByTag(ctx context.Context, tag string) ([]Task, error) {
+	tasks, err := s.Store.GetTaskByTag(ctx, tag)
+
+	return scope(ctx, tasks, err)
+}
+
+func (s *Scoped) GetTaskByDueDate(ctx context.Context, year int, month time.Month, day int) ([]Task, error) {
+	tasks, err := s.Store.GetTaskByDueDate(ctx, year, month, day)
+
+	return scope(ctx, tasks, err)
+}
+
+func (s *Scoped) GetTaskByStatus(ctx context.Context, status Status) ([]Task, error) {
+	tasks, err := s.Store.GetTaskByStatus(ctx, status)
+
+	return scope(ctx, tasks, err)
+}
+
+func (s *Scoped) GetTaskByDueRange(ctx context.Context, from, to time.Time, bounds Bounds) ([]Task, error) {
+	tasks, err := s.Store.GetTaskByDueRange(ctx, from, to, bounds)
+
+	return scope(ctx, tasks, err)
+}
+
+func (s *Scoped) GetTrash(ctx context.Context) ([]Task, error) {
+	tasks, err := s.Store.GetTrash(ctx)
+
+	return scope(ctx, tasks, err)
+}
+
+func (s *Scoped) GetTrashedTask(ctx context.Context, id int) (Task, error) {
+	task, err := s.Store.GetTrashedTask(ctx, id)
+
+	if err != nil {
+		return Task{}, err
+	}
+
+	if !TenantOf(ctx).Reaches(task) {
+		return Task{}, NotFound(id)
+	}
+
+	return task, nil
+}
+
+func (s *Scoped) RestoreTask(ctx context.Context, id int) (Task, error) {
+	if err := s.reach(ctx, id); err != nil {
+		return Task{}, err
+	}
+
+	return s.Store.RestoreTask(ctx, id)
+}
+
+// PurgeTrash is for admins, it empties the trash of every tenant
+func (s *Scoped) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	if !TenantOf(ctx).Admin {
+		return 0, fmt.Errorf("only admins purge the trash: %w", ErrForbidden)
+	}
+
+	return s.Store.PurgeTrash(ctx, before)
+}
+
+func (s *Scoped) GetHistory(ctx context.Context, id int) ([]Revision, error) {
+	if err := s.reach(ctx, id); err != nil {
+		return nil, err
+	}
+
+	return s.Store.GetHistory(ctx, id)
+}
+
+func (s *Scoped) RevertTask(ctx context.Context, id int, number int, version int) (Task, error) {
+	if err := s.reach(ctx, id); err != nil {
+		return Task{}, err
+	}
+
+	return s.Store.RevertTask(ctx, id, number, version)
+}
+
+// SearchTasks searches the wrapped store, through its own index when it is a Searcher, and
+// keeps the tasks the tenant of ctx reaches
+func (s *Scoped) SearchTasks(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	tenant := TenantOf(ctx)
+
+	if tenant.Admin {
+		return Search(ctx, s.Store, query, limit)
+	}
+
+	// the limit applies to the tenant's results, not to those of every owner
+	results, err := Search(ctx, s.Store, query, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	kept := make([]SearchResult, 0, len(results))
+
+	for _, result := range results {
+		if tenant.Reaches(result.Task) {
+			kept = append(kept, result)
+		}
+
+		if limit > 0 && len(kept) == limit {
+			break
+		}
+	}
+
+	return kept, nil
+}
+
+func (s scopedWatcher) Subscribe(ctx context.Context, after uint64) (*Subscription, error) {
+	return s.SubscribeFunc(ctx, after, nil)
+}
+
+// Seq is that of the wrapped watcher, events of other tenants included
+func (s scopedWatcher) Seq() uint64 {
+	return s.watcher.Seq()
+}
+
+func (s scopedWatcher) SubscribeFunc(ctx context.Context, after uint64, keep func(Event) bool) (*Subscription, error) {
+	tenant := TenantOf(ctx)
+
+	return s.watcher.SubscribeFunc(ctx, after, func(event Event) bool {
+		return tenant.Reaches(event.Task) && (keep == nil || keep(event))
+	})
+}
@@ -0,0 +1,60 @@
+package taskstore
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+)
+
+// DefaultTrashRetention is how long deleted tasks stay in the trash before they are purged
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// Trashed returns task as it is kept in the trash once deleted at at
+func Trashed(task Task, at time.Time) Task {
+	at = at.UTC()
+	task.DeletedAt = &at
+
+	return task
+}
+
+// Restored returns a task of the trash as it is kept once restored:
+// live again, with the next version.
+func Restored(task Task) Task {
+	task.DeletedAt = nil
+	task.Version++
+
+	return task
+}
+
+// ByDeleted is the order of Store.GetTrash, most recently deleted first
+var ByDeleted = Order{Field: SortByDeleted, Desc: true}
+
+// SortTrash sorts deleted tasks in the order of Store.GetTrash
+func SortTrash(tasks []Task) {
+	sort.Slice(tasks, func(i, j int) bool { return ByDeleted.Less(tasks[i].SortKey(), tasks[j].SortKey()) })
+}
+
+// PurgeTrashEvery purges the tasks that have been in the trash of store for longer than
+// retention, right away and then every interval, until ctx is done. Failures are logged
+// and retried at the next tick.
+func PurgeTrashEvery(ctx context.Context, store Store, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := store.PurgeTrash(ctx, time.Now().Add(-retention))
+
+		if err != nil {
+			log.Printf("purging the trash: %v", err)
+		} else if purged > 0 {
+			log.Printf("purged %d tasks deleted more than %v ago", purged, retention)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package taskstore
+
+import (
+	"context"
+	"time"
+)
+
+type zoneContextKey struct{}
+
+// WithDefaultZone returns a context in which due dates are matched in loc when the request
+// names no zone of its own; authentication middleware uses it to apply the user's zone.
+func WithDefaultZone(ctx context.Context, loc *time.Location) context.Context {
+	return context.WithValue(ctx, zoneContextKey{}, loc)
+}
+
+// DefaultZone returns the zone set by WithDefaultZone, nil if there is none.
+func DefaultZone(ctx context.Context) *time.Location {
+	loc, _ := ctx.Value(zoneContextKey{}).(*time.Location)
+
+	return loc
+}
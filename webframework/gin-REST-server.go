@@ -1,17 +1,42 @@
 package main
 
 import (
+	"flag"
+	"log"
+
 	"github.com/gin-gonic/gin"
+	"github.com/shien/restserver/auth/taskstore-auth/middleware"
+	"github.com/shien/restserver/taskstore/backend"
 	"github.com/shien/restserver/webframework/taskserver"
 )
 
 func main() {
+	policyFile := middleware.RegisterPolicyFlag()
+	storeFlags := backend.RegisterFlags()
+	flag.Parse()
+
+	store, err := storeFlags.Open()
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	auth, err := middleware.LoadAuthorization(*policyFile)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// router := gin.Default()
 	router := gin.New()
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
 
-	server := taskserver.NewTaskServerForWebFramework()
+	if auth != nil {
+		router.Use(auth.Gin())
+	}
+
+	server := taskserver.NewTaskServerForWebFramework(store)
 
 	// register, unlike Router package, there is no regexp support in Gin(Web framework)
 	router.GET("/task/", server.GetAllTasksHandler)
@@ -20,9 +45,21 @@ func main() {
 
 	router.GET("/task/:id", server.GetTaskHandler)
 	router.DELETE("/task/:id", server.DeleteTaskHandler)
+	router.PUT("/task/:id", server.UpdateTaskHandler)
+	router.PATCH("/task/:id", server.PatchTaskHandler)
+	router.POST("/task/:id/complete", server.CompleteTaskHandler)
+	router.POST("/task/:id/reopen", server.ReopenTaskHandler)
+	router.GET("/task/:id/history", server.GetHistoryHandler)
+	router.POST("/task/:id/revert", server.RevertTaskHandler)
 
 	router.GET("/tag/:tag", server.TagHandler)
 	router.GET("/due/:year/:month/:day", server.DueHandler)
+	router.GET("/due/", server.DueRangeHandler)
+	router.GET("/overdue/", server.OverdueHandler)
+	router.GET("/search/", server.SearchHandler)
+
+	router.GET("/trash/", server.GetTrashHandler)
+	router.POST("/trash/:id/restore", server.RestoreTaskHandler)
 
 	const PORT = "9090"
 
@@ -7,17 +7,16 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/shien/restserver/stdlib-REST-server/taskserver"
 	"github.com/shien/restserver/taskstore"
 )
 
 // Backend server wraps the database like taskstore
 type TaskServerForWebFramework struct {
-	Datastore *taskstore.TaskStore
+	Datastore taskstore.Store
 }
 
-func NewTaskServerForWebFramework() *TaskServerForWebFramework {
-	store := taskstore.New()
-
+func NewTaskServerForWebFramework(store taskstore.Store) *TaskServerForWebFramework {
 	return &TaskServerForWebFramework{Datastore: store}
 }
 
@@ -37,13 +36,25 @@ func (ts *TaskServerForWebFramework) CreateTaskHandler(context *gin.Context) {
 		return
 	}
 
-	id := ts.Datastore.CreateTask(rt.Text, rt.Tags, rt.Due)
+	id, err := ts.Datastore.CreateTask(context.Request.Context(), rt.Text, rt.Tags, rt.Due)
+
+	if err != nil {
+		context.String(http.StatusInternalServerError, err.Error())
+		return
+	}
 
 	context.JSON(http.StatusOK, gin.H{"Id": id})
 }
 
 func (ts *TaskServerForWebFramework) DeleteAllTasksHandler(context *gin.Context) {
-	ts.Datastore.DeleteAllTasks()
+	if err := taskserver.ConfirmDeleteAll(context.Request); err != nil {
+		context.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := ts.Datastore.DeleteAllTasks(context.Request.Context()); err != nil {
+		context.String(taskserver.StatusForStoreError(err), err.Error())
+	}
 }
 
 func (ts *TaskServerForWebFramework) DeleteTaskHandler(context *gin.Context) {
@@ -54,14 +65,30 @@ func (ts *TaskServerForWebFramework) DeleteTaskHandler(context *gin.Context) {
 		return
 	}
 
-	if err = ts.Datastore.DeleteTask(id); err != nil {
-		context.String(http.StatusNotFound, err.Error())
+	version, status, err := taskserver.ExpectedVersion(context.Request.Context(), ts.Datastore, id, context.Request)
+
+	if err != nil {
+		context.String(status, err.Error())
+		return
+	}
+
+	if err = ts.Datastore.DeleteTask(context.Request.Context(), id, version); err != nil {
+		context.String(taskserver.StatusForStoreError(err), err.Error())
 		return
 	}
 }
 
 func (ts *TaskServerForWebFramework) GetAllTasksHandler(context *gin.Context) {
-	tasks := ts.Datastore.GetAllTasks()
+	tasks, status, err := taskserver.ListTasks(context.Request.Context(), ts.Datastore, context.Request)
+
+	if err == nil {
+		tasks, status, err = taskserver.PageTasks(context.Writer, context.Request, tasks, taskserver.ByID)
+	}
+
+	if err != nil {
+		context.String(status, err.Error())
+		return
+	}
 
 	context.JSON(http.StatusOK, tasks)
 }
@@ -74,20 +101,210 @@ func (ts *TaskServerForWebFramework) GetTaskHandler(context *gin.Context) {
 		return
 	}
 
-	task, err := ts.Datastore.GetTask(id)
+	task, err := ts.Datastore.GetTask(context.Request.Context(), id)
+
+	if err != nil {
+		context.String(taskserver.StatusForStoreError(err), err.Error())
+		return
+	}
+
+	context.Header("ETag", taskserver.ETag(task))
+
+	if taskserver.NotModified(context.Request, task) {
+		context.Status(http.StatusNotModified)
+		return
+	}
+
+	context.JSON(http.StatusOK, task)
+}
+
+func (ts *TaskServerForWebFramework) UpdateTaskHandler(context *gin.Context) {
+	type RequestTask struct {
+		Text   string           `json:"text"`
+		Tags   []string         `json:"tags"`
+		Due    time.Time        `json:"due"`
+		Status taskstore.Status `json:"status"` // optional, keeps the current status when left out
+	}
+
+	id, err := strconv.Atoi(context.Params.ByName("id"))
+
+	if err != nil {
+		context.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var rt RequestTask
+
+	if err := context.ShouldBindJSON(&rt); err != nil {
+		context.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	version, status, err := taskserver.ExpectedVersion(context.Request.Context(), ts.Datastore, id, context.Request)
+
+	if err != nil {
+		context.String(status, err.Error())
+		return
+	}
+
+	task, err := ts.Datastore.UpdateTask(context.Request.Context(), taskstore.Task{ID: id, Text: rt.Text, Tags: rt.Tags, Due: rt.Due, Version: version, Status: rt.Status})
+
+	if err != nil {
+		context.String(taskserver.StatusForStoreError(err), err.Error())
+		return
+	}
+
+	context.Header("ETag", taskserver.ETag(task))
+	context.JSON(http.StatusOK, task)
+}
+
+func (ts *TaskServerForWebFramework) PatchTaskHandler(context *gin.Context) {
+	id, err := strconv.Atoi(context.Params.ByName("id"))
+
+	if err != nil {
+		context.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	task, status, err := taskserver.PatchStoredTask(context.Request.Context(), ts.Datastore, id, context.Request)
 
 	if err != nil {
-		context.String(http.StatusNotFound, err.Error())
+		context.String(status, err.Error())
 		return
 	}
 
+	context.Header("ETag", taskserver.ETag(task))
+	context.JSON(http.StatusOK, task)
+}
+
+func (ts *TaskServerForWebFramework) SearchHandler(context *gin.Context) {
+	results, status, err := taskserver.SearchTasks(context.Request.Context(), ts.Datastore, context.Request)
+
+	if err != nil {
+		context.String(status, err.Error())
+		return
+	}
+
+	context.JSON(http.StatusOK, results)
+}
+
+func (ts *TaskServerForWebFramework) GetTrashHandler(context *gin.Context) {
+	tasks, err := ts.Datastore.GetTrash(context.Request.Context())
+
+	if err != nil {
+		context.String(taskserver.StatusForStoreError(err), err.Error())
+		return
+	}
+
+	tasks, status, err := taskserver.PageTasks(context.Writer, context.Request, tasks, taskserver.ByDeleted)
+
+	if err != nil {
+		context.String(status, err.Error())
+		return
+	}
+
+	context.JSON(http.StatusOK, tasks)
+}
+
+func (ts *TaskServerForWebFramework) RestoreTaskHandler(context *gin.Context) {
+	id, err := strconv.Atoi(context.Params.ByName("id"))
+
+	if err != nil {
+		context.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	task, err := ts.Datastore.RestoreTask(context.Request.Context(), id)
+
+	if err != nil {
+		context.String(taskserver.StatusForStoreError(err), err.Error())
+		return
+	}
+
+	context.Header("ETag", taskserver.ETag(task))
+	context.JSON(http.StatusOK, task)
+}
+
+func (ts *TaskServerForWebFramework) GetHistoryHandler(context *gin.Context) {
+	id, err := strconv.Atoi(context.Params.ByName("id"))
+
+	if err != nil {
+		context.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	revs, err := ts.Datastore.GetHistory(context.Request.Context(), id)
+
+	if err != nil {
+		context.String(taskserver.StatusForStoreError(err), err.Error())
+		return
+	}
+
+	context.JSON(http.StatusOK, revs)
+}
+
+func (ts *TaskServerForWebFramework) RevertTaskHandler(context *gin.Context) {
+	id, err := strconv.Atoi(context.Params.ByName("id"))
+
+	if err != nil {
+		context.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	task, status, err := taskserver.RevertStoredTask(context.Request.Context(), ts.Datastore, id, context.Request)
+
+	if err != nil {
+		context.String(status, err.Error())
+		return
+	}
+
+	context.Header("ETag", taskserver.ETag(task))
+	context.JSON(http.StatusOK, task)
+}
+
+func (ts *TaskServerForWebFramework) CompleteTaskHandler(context *gin.Context) {
+	ts.transitionTask(context, taskstore.StatusDone)
+}
+
+func (ts *TaskServerForWebFramework) ReopenTaskHandler(context *gin.Context) {
+	ts.transitionTask(context, taskstore.StatusOpen)
+}
+
+func (ts *TaskServerForWebFramework) transitionTask(context *gin.Context, status taskstore.Status) {
+	id, err := strconv.Atoi(context.Params.ByName("id"))
+
+	if err != nil {
+		context.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	task, code, err := taskserver.TransitionStoredTask(context.Request.Context(), ts.Datastore, id, status, context.Request)
+
+	if err != nil {
+		context.String(code, err.Error())
+		return
+	}
+
+	context.Header("ETag", taskserver.ETag(task))
 	context.JSON(http.StatusOK, task)
 }
 
 func (ts *TaskServerForWebFramework) TagHandler(context *gin.Context) {
 	tag := context.Params.ByName("tag")
 
-	tasks := ts.Datastore.GetTaskByTag(tag)
+	tasks, err := ts.Datastore.GetTaskByTag(context.Request.Context(), tag)
+
+	if err != nil {
+		context.String(taskserver.StatusForStoreError(err), err.Error())
+		return
+	}
+
+	tasks, status, err := taskserver.PageTasks(context.Writer, context.Request, tasks, taskserver.ByID)
+
+	if err != nil {
+		context.String(status, err.Error())
+		return
+	}
 
 	context.JSON(http.StatusOK, tasks)
 }
@@ -123,7 +340,49 @@ func (ts *TaskServerForWebFramework) DueHandler(context *gin.Context) {
 	// validate the date from client
 	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
 
-	tasks := ts.Datastore.GetTaskByDueDate(date.Year(), date.Month(), date.Day())
+	tasks, status, err := taskserver.ListTasksDueOn(context.Request.Context(), ts.Datastore, context.Request, date.Year(), date.Month(), date.Day())
+
+	if err == nil {
+		tasks, status, err = taskserver.PageTasks(context.Writer, context.Request, tasks, taskserver.ByDue)
+	}
+
+	if err != nil {
+		context.String(status, err.Error())
+		return
+	}
+
+	context.JSON(http.StatusOK, tasks)
+}
+
+func (ts *TaskServerForWebFramework) DueRangeHandler(context *gin.Context) {
+	tasks, status, err := taskserver.ListTasksDue(context.Request.Context(), ts.Datastore, context.Request)
+
+	if err == nil {
+		tasks, status, err = taskserver.PageTasks(context.Writer, context.Request, tasks, taskserver.ByDue)
+	}
+
+	if err != nil {
+		context.String(status, err.Error())
+		return
+	}
+
+	context.JSON(http.StatusOK, tasks)
+}
+
+func (ts *TaskServerForWebFramework) OverdueHandler(context *gin.Context) {
+	tasks, err := taskstore.GetOverdueTasks(context.Request.Context(), ts.Datastore, time.Now())
+
+	if err != nil {
+		context.String(taskserver.StatusForStoreError(err), err.Error())
+		return
+	}
+
+	tasks, status, err := taskserver.PageTasks(context.Writer, context.Request, tasks, taskserver.ByDue)
+
+	if err != nil {
+		context.String(status, err.Error())
+		return
+	}
 
 	context.JSON(http.StatusOK, tasks)
 }